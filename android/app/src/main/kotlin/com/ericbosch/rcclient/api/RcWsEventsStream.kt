@@ -144,6 +144,8 @@ class RcWsEventsStream(
         } else {
             b.addQueryParameter("last_n", "256")
         }
+        // The timeline renders raw output events, not the terminal screen snapshot.
+        b.addQueryParameter("screen", "0")
         b.addQueryParameter("ticket", ticket)
         return b.build().toString()
     }
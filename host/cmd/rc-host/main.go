@@ -10,9 +10,14 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/ericbosch/cli-remote-control/host/internal/holder"
+	"github.com/ericbosch/cli-remote-control/host/internal/limits"
+	"github.com/ericbosch/cli-remote-control/host/internal/logrotate"
 	"github.com/ericbosch/cli-remote-control/host/internal/policy"
 	"github.com/ericbosch/cli-remote-control/host/internal/server"
+	"github.com/ericbosch/cli-remote-control/host/internal/session"
 	"github.com/spf13/cobra"
 )
 
@@ -72,10 +77,44 @@ func main() {
 	serveCmd.Flags().String("token", "", "Bearer token for API/WS auth (overrides env RC_TOKEN)")
 	serveCmd.Flags().String("token-file", "", "Path to token file (overrides env RC_TOKEN_FILE). Used for --generate-dev-token and for loading an existing token.")
 	serveCmd.Flags().String("log-dir", "logs", "Directory for session logs (rotated)")
+	serveCmd.Flags().String("state-dir", ".run", "Directory for host state: session registry and events, attachments, holders, share links and templates")
+	serveCmd.Flags().Int64("log-max-size", 50, "Rotate a session log once it reaches this many MB (0 = no size limit)")
+	serveCmd.Flags().Duration("log-max-age", 24*time.Hour, "Rotate a session log once it is this old (0 = no age limit)")
+	serveCmd.Flags().Bool("log-compress", true, "Gzip rotated session logs")
+	serveCmd.Flags().Int64("log-retention-size", 0, "Delete the oldest files in --log-dir while it exceeds this many MB (0 = keep all)")
+	serveCmd.Flags().Duration("log-retention-age", 0, "Delete files in --log-dir not modified for this long, e.g. 720h (0 = keep all)")
 	serveCmd.Flags().Bool("generate-dev-token", false, "Generate and write dev token to .dev-token if no token set")
 	serveCmd.Flags().String("web-dir", "", "Serve static web from this directory at / (empty = no static)")
+	serveCmd.Flags().Bool("detach-sessions", false, "Run PTY sessions under detached holder processes so they survive rc-host restarts")
+	serveCmd.Flags().String("engines-config", "", "JSON file with additional engine definitions (see docs/engines.md)")
+	serveCmd.Flags().StringArray("workspace-root", nil, "Allow session workspaces only under this directory (repeatable; default: any directory)")
+	serveCmd.Flags().Float64("limit-cpu", 0, "Default CPU limit per session, in cores (0 = unlimited; sessions can override with args.limits)")
+	serveCmd.Flags().Int64("limit-memory", 0, "Default memory limit per session, in MB (0 = unlimited)")
+	serveCmd.Flags().Int64("limit-pids", 0, "Default limit on processes and threads per session (0 = unlimited)")
+	serveCmd.Flags().Uint64("limit-nofile", 0, "Default open-file limit per session process (0 = unlimited)")
+	serveCmd.Flags().String("cgroup-parent", "auto", `cgroup v2 directory to create session cgroups under ("auto" = rc-host's own cgroup, "" = rlimits only)`)
+	serveCmd.Flags().String("sandbox", "off", `Sandbox sessions with bubblewrap: "off" (sessions may opt in), "on" (sessions may opt out) or "enforce"`)
+	serveCmd.Flags().Int64("attachment-max-size", 20, "Largest file a client may attach to a message, in MB")
+	serveCmd.Flags().Int64("attachment-quota", 100, "Total size of the attachments of one session, in MB")
+	serveCmd.Flags().StringArray("codex-model", nil, "Allow codex sessions only this model (repeatable; the first is the default; default: any model)")
+	serveCmd.Flags().StringArray("codex-effort", nil, "Allow codex sessions only this reasoning effort: minimal, low, medium or high (repeatable; default: any)")
+	serveCmd.Flags().StringArray("codex-approval-policy", nil, "Allow codex sessions only this approval policy: never, on-request, on-failure or untrusted (repeatable; default: any)")
+	serveCmd.Flags().StringArray("codex-sandbox-mode", nil, "Allow codex sessions only this sandbox mode: read-only, workspace-write or danger-full-access (repeatable; default: any)")
 	root.AddCommand(serveCmd)
 
+	// Internal: per-session PTY holder spawned by `serve --detach-sessions`.
+	holderCmd := &cobra.Command{
+		Use:    "holder",
+		Short:  "Run a detached PTY holder for one session (internal)",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			spec, _ := cmd.Flags().GetString("spec")
+			return holder.RunSpecFile(spec)
+		},
+	}
+	holderCmd.Flags().String("spec", "", "Path to the holder spec file")
+	root.AddCommand(holderCmd)
+
 	if err := root.Execute(); err != nil {
 		os.Exit(1)
 	}
@@ -87,8 +126,29 @@ func runServe(cmd *cobra.Command, _ []string) error {
 	token, _ := cmd.Flags().GetString("token")
 	tokenFile, _ := cmd.Flags().GetString("token-file")
 	logDir, _ := cmd.Flags().GetString("log-dir")
+	stateDir, _ := cmd.Flags().GetString("state-dir")
 	generateDevToken, _ := cmd.Flags().GetBool("generate-dev-token")
 	webDir, _ := cmd.Flags().GetString("web-dir")
+	detachSessions, _ := cmd.Flags().GetBool("detach-sessions")
+	enginesConfig, _ := cmd.Flags().GetString("engines-config")
+	logMaxSize, _ := cmd.Flags().GetInt64("log-max-size")
+	logMaxAge, _ := cmd.Flags().GetDuration("log-max-age")
+	logCompress, _ := cmd.Flags().GetBool("log-compress")
+	logRetentionSize, _ := cmd.Flags().GetInt64("log-retention-size")
+	logRetentionAge, _ := cmd.Flags().GetDuration("log-retention-age")
+	workspaceRoots, _ := cmd.Flags().GetStringArray("workspace-root")
+	limitCPU, _ := cmd.Flags().GetFloat64("limit-cpu")
+	limitMemory, _ := cmd.Flags().GetInt64("limit-memory")
+	limitPids, _ := cmd.Flags().GetInt64("limit-pids")
+	limitNoFile, _ := cmd.Flags().GetUint64("limit-nofile")
+	cgroupParent, _ := cmd.Flags().GetString("cgroup-parent")
+	sandboxMode, _ := cmd.Flags().GetString("sandbox")
+	attachmentMaxSize, _ := cmd.Flags().GetInt64("attachment-max-size")
+	attachmentQuota, _ := cmd.Flags().GetInt64("attachment-quota")
+	codexModels, _ := cmd.Flags().GetStringArray("codex-model")
+	codexEfforts, _ := cmd.Flags().GetStringArray("codex-effort")
+	codexApprovalPolicies, _ := cmd.Flags().GetStringArray("codex-approval-policy")
+	codexSandboxModes, _ := cmd.Flags().GetStringArray("codex-sandbox-mode")
 
 	if token == "" {
 		token = os.Getenv("RC_TOKEN")
@@ -140,12 +200,47 @@ func runServe(cmd *cobra.Command, _ []string) error {
 		log.Printf("WARNING: Binding to 0.0.0.0 — service is exposed to the network. Use only on trusted LAN or VPN.")
 	}
 
+	if len(workspaceRoots) == 0 {
+		log.Printf("Warning: no --workspace-root set; sessions may use any directory as their workspace.")
+	}
+
 	cfg := server.Config{
 		Bind:   bind,
 		Port:   port,
 		Token:  token,
 		LogDir: logDir,
 		WebDir: webDir,
+
+		StateDir:           stateDir,
+		DetachSessions:     detachSessions,
+		EnginesConfig:      enginesConfig,
+		WorkspaceRoots:     workspaceRoots,
+		CgroupParent:       cgroupParent,
+		Sandbox:            sandboxMode,
+		SandboxHide:        []string{tokenFile},
+		AttachmentMaxBytes: attachmentMaxSize << 20,
+		AttachmentQuota:    attachmentQuota << 20,
+		Codex: session.CodexPolicy{
+			Models:           codexModels,
+			Efforts:          codexEfforts,
+			ApprovalPolicies: codexApprovalPolicies,
+			SandboxModes:     codexSandboxModes,
+		},
+		Limits: limits.Limits{
+			CPU:      limitCPU,
+			MemoryMB: limitMemory,
+			Pids:     limitPids,
+			NoFile:   limitNoFile,
+		},
+		LogRotation: logrotate.Options{
+			MaxBytes: logMaxSize << 20,
+			MaxAge:   logMaxAge,
+			Compress: logCompress,
+		},
+		LogRetention: logrotate.Retention{
+			MaxTotalBytes: logRetentionSize << 20,
+			MaxAge:        logRetentionAge,
+		},
 	}
 	srv, err := server.New(cfg)
 	if err != nil {
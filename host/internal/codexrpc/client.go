@@ -43,9 +43,13 @@ type Client struct {
 	mu      sync.Mutex
 	pending map[int64]chan Message
 	onNotif func(method string, params json.RawMessage)
+	onReq   func(id json.RawMessage, method string, params json.RawMessage) bool
+
+	writeMu sync.Mutex
 }
 
-func Start(ctx context.Context) (*Client, error) {
+// Start runs `codex app-server`; prepare, if set, may adjust the command before it starts.
+func Start(ctx context.Context, prepare func(*exec.Cmd) error) (*Client, error) {
 	bin, err := findCodexBinary()
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrCodexUnavailable, err)
@@ -54,6 +58,11 @@ func Start(ctx context.Context) (*Client, error) {
 	if env, _ := policy.EngineEnv(os.Environ()); len(env) > 0 {
 		cmd.Env = env
 	}
+	if prepare != nil {
+		if err := prepare(cmd); err != nil {
+			return nil, err
+		}
+	}
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
@@ -89,6 +98,36 @@ func (c *Client) SetNotificationHandler(fn func(method string, params json.RawMe
 	c.mu.Unlock()
 }
 
+// SetRequestHandler sets the handler of server-initiated requests (e.g. approval requests). It
+// returns false for methods it does not implement, which are answered with "method not
+// implemented"; for the others it must eventually answer with Respond.
+func (c *Client) SetRequestHandler(fn func(id json.RawMessage, method string, params json.RawMessage) bool) {
+	c.mu.Lock()
+	c.onReq = fn
+	c.mu.Unlock()
+}
+
+// Respond answers the server-initiated request id with result.
+func (c *Client) Respond(id json.RawMessage, result any) error {
+	return c.write(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	})
+}
+
+// write sends one message; writes are serialized so concurrent messages do not interleave.
+func (c *Client) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.stdin.Write(append(b, '\n'))
+	return err
+}
+
 func (c *Client) Call(ctx context.Context, method string, params any, out any) error {
 	id := c.nextID.Add(1)
 	ch := make(chan Message, 1)
@@ -103,15 +142,7 @@ func (c *Client) Call(ctx context.Context, method string, params any, out any) e
 		"method":  method,
 		"params":  params,
 	}
-	b, err := json.Marshal(req)
-	if err != nil {
-		c.mu.Lock()
-		delete(c.pending, id)
-		c.mu.Unlock()
-		return err
-	}
-	b = append(b, '\n')
-	if _, err := c.stdin.Write(b); err != nil {
+	if err := c.write(req); err != nil {
 		c.mu.Lock()
 		delete(c.pending, id)
 		c.mu.Unlock()
@@ -154,7 +185,12 @@ func (c *Client) readLoop() {
 		}
 
 		if len(msg.ID) > 0 && msg.Method != "" {
-			c.replyUnsupportedRequest(msg)
+			c.mu.Lock()
+			fn := c.onReq
+			c.mu.Unlock()
+			if fn == nil || !fn(msg.ID, msg.Method, msg.Params) {
+				c.replyUnsupportedRequest(msg)
+			}
 			continue
 		}
 
@@ -206,19 +242,14 @@ func (c *Client) replyUnsupportedRequest(msg Message) {
 	if len(msg.ID) == 0 {
 		return
 	}
-	resp := map[string]any{
+	_ = c.write(map[string]any{
 		"jsonrpc": "2.0",
 		"id":      json.RawMessage(msg.ID),
 		"error": map[string]any{
 			"code":    -32601,
 			"message": "method not implemented by client",
 		},
-	}
-	b, err := json.Marshal(resp)
-	if err != nil {
-		return
-	}
-	_, _ = c.stdin.Write(append(b, '\n'))
+	})
 }
 
 func (c *Client) drainStderr() {
@@ -227,6 +258,11 @@ func (c *Client) drainStderr() {
 
 var ErrCodexUnavailable = errors.New("codex app-server unavailable")
 
+// FindBinary returns the path of the codex CLI, looking at PATH and common install locations.
+func FindBinary() (string, error) {
+	return findCodexBinary()
+}
+
 func findCodexBinary() (string, error) {
 	if p, err := exec.LookPath("codex"); err == nil && p != "" {
 		return p, nil
@@ -45,6 +45,27 @@ func (b *Buffer) Append(ev SessionEvent) SessionEvent {
 	return ev
 }
 
+// Restore loads previously persisted events (e.g. from JSONLStore.LoadTail) keeping their seqs,
+// so that events appended afterwards continue the same sequence.
+func (b *Buffer) Restore(evs []SessionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ev := range evs {
+		if ev.Seq <= b.nextSeq {
+			continue
+		}
+		b.nextSeq = ev.Seq
+		if b.size < b.cap {
+			b.buf[(b.start+b.size)%b.cap] = ev
+			b.size++
+			continue
+		}
+		b.buf[b.start] = ev
+		b.start = (b.start + 1) % b.cap
+	}
+}
+
 func (b *Buffer) LastSeq() uint64 {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
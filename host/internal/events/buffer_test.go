@@ -29,3 +29,24 @@ func TestBufferBoundsAndReplay(t *testing.T) {
 		t.Fatalf("ReplayLastN(2) unexpected: %+v", last2)
 	}
 }
+
+func TestBufferRestoreContinuesSeq(t *testing.T) {
+	b := NewBuffer(2)
+	b.Restore([]SessionEvent{
+		{SessionID: "s1", Engine: "shell", Seq: 7, Kind: EventKindStatus},
+		{SessionID: "s1", Engine: "shell", Seq: 8, Kind: EventKindAssistant},
+		{SessionID: "s1", Engine: "shell", Seq: 9, Kind: EventKindStatus},
+	})
+	if got := b.LastSeq(); got != 9 {
+		t.Fatalf("LastSeq=%d want=9", got)
+	}
+	replay := b.ReplayFromSeq(0)
+	if len(replay) != 2 || replay[0].Seq != 8 || replay[1].Seq != 9 {
+		t.Fatalf("ReplayFromSeq(0) unexpected: %+v", replay)
+	}
+
+	ev := b.Append(SessionEvent{SessionID: "s1", Engine: "shell", Kind: EventKindStatus})
+	if ev.Seq != 10 {
+		t.Fatalf("Append seq=%d want=10", ev.Seq)
+	}
+}
@@ -19,6 +19,12 @@ const (
 	EventKindStatus        EventKind = "status"
 	EventKindError         EventKind = "error"
 	EventKindMetrics       EventKind = "metrics"
+	// EventKindApproval is an agent asking the user to approve an action (status "pending"), and
+	// later its outcome under the same approval_id.
+	EventKindApproval EventKind = "approval"
+	// EventKindScreen carries a rendered terminal snapshot. It is only sent to a client when it
+	// attaches and is never stored; its seq is that of the last event the snapshot reflects.
+	EventKindScreen EventKind = "screen"
 )
 
 type SessionEvent struct {
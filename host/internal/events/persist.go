@@ -26,6 +26,19 @@ func (s *JSONLStore) pathForSession(sessionID string) string {
 	return filepath.Join(s.dir, sessionID+".jsonl")
 }
 
+// Create creates the empty event log of a new session. It fails with an error matching
+// fs.ErrExist if the session already has one.
+func (s *JSONLStore) Create(sessionID string) error {
+	if sessionID == "" {
+		return errors.New("sessionID required")
+	}
+	f, err := os.OpenFile(s.pathForSession(sessionID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 func (s *JSONLStore) Append(sessionID string, ev SessionEvent) error {
 	if sessionID == "" {
 		return errors.New("sessionID required")
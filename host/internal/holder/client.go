@@ -0,0 +1,188 @@
+package holder
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrNotRunning is returned by Dial when no holder is listening on the socket.
+var ErrNotRunning = errors.New("holder not running")
+
+// Conn is a client connection to a holder. Read returns PTY output and io.EOF once the child has
+// exited; Wait then reports the exit code. Closing a Conn detaches without stopping the child.
+type Conn struct {
+	pid      int // holder process; 0 when connected with Dial
+	conn     net.Conn
+	exitPath string
+	replay   []byte
+
+	wmu sync.Mutex
+
+	rmu     sync.Mutex
+	pending []byte
+
+	exitOnce sync.Once
+	exited   chan struct{}
+	code     int
+}
+
+// Spawn starts a detached holder process for spec using the rc-host executable at exe, waits for
+// its socket to appear and connects to it. The holder runs in its own session so it outlives the
+// calling process.
+func Spawn(exe string, spec Spec) (*Conn, error) {
+	if err := os.MkdirAll(spec.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	sockPath, _, specPath := Paths(spec.Dir, spec.ID)
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(specPath, b, 0o600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(exe, "holder", "--spec", specPath)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		_ = os.Remove(specPath)
+		return nil, err
+	}
+	// Reap the holder if it exits while we are still running; otherwise init adopts it.
+	go func() { _ = cmd.Wait() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c, err := Dial(sockPath)
+		if err == nil {
+			c.pid = cmd.Process.Pid
+			return c, nil
+		}
+		if time.Now().After(deadline) {
+			_ = cmd.Process.Kill()
+			return nil, err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Dial connects to a running holder and fetches its replay buffer (see Replay).
+func Dial(sockPath string) (*Conn, error) {
+	nc, err := net.Dial("unix", sockPath)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	c := &Conn{
+		conn:     nc,
+		exitPath: sockPath[:len(sockPath)-len(".sock")] + ".exit",
+		exited:   make(chan struct{}),
+	}
+	if err := writeFrame(nc, frameAttach, nil); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	_ = nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	typ, payload, err := readFrame(nc)
+	_ = nc.SetReadDeadline(time.Time{})
+	if err != nil || typ != frameReplay {
+		nc.Close()
+		return nil, ErrNotRunning
+	}
+	c.replay = payload
+	return c, nil
+}
+
+// Pid returns the holder process ID when c was created by Spawn, or 0.
+func (c *Conn) Pid() int { return c.pid }
+
+// Replay returns the output the holder buffered before this connection was attached.
+func (c *Conn) Replay() []byte {
+	return c.replay
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for len(c.pending) == 0 {
+		typ, payload, err := readFrame(c.conn)
+		if err != nil {
+			c.finish(c.exitFromFile())
+			return 0, io.EOF
+		}
+		switch typ {
+		case frameOutput:
+			c.pending = payload
+		case frameExit:
+			c.finish(decodeExit(payload))
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.send(frameInput, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resize sets the holder's PTY window size.
+func (c *Conn) Resize(cols, rows int) error {
+	return c.send(frameResize, encodeSize(cols, rows))
+}
+
+// Kill asks the holder to kill the child.
+func (c *Conn) Kill() error {
+	return c.send(frameKill, nil)
+}
+
+// Interrupt asks the holder to send SIGINT to the PTY's foreground process group.
+func (c *Conn) Interrupt() error {
+	return c.send(frameInterrupt, nil)
+}
+
+// Wait blocks until the child has exited (observed through Read) and returns its exit code.
+func (c *Conn) Wait() (int, error) {
+	<-c.exited
+	return c.code, nil
+}
+
+// Close detaches from the holder; the child keeps running.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) send(typ byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return writeFrame(c.conn, typ, payload)
+}
+
+func (c *Conn) finish(code int) {
+	c.exitOnce.Do(func() {
+		c.code = code
+		close(c.exited)
+	})
+}
+
+// exitFromFile is used when the connection drops without an exit frame.
+func (c *Conn) exitFromFile() int {
+	// The holder writes the exit file just before notifying clients; allow a short grace period.
+	for i := 0; i < 10; i++ {
+		if code, err := ReadExitFile(c.exitPath); err == nil {
+			return code
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return -1
+}
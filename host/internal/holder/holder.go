@@ -0,0 +1,115 @@
+// Package holder implements a small per-session supervisor process that owns a PTY and exposes it
+// over a local unix socket (tmux/dtach-like). Sessions started through a holder keep running when
+// rc-host restarts; the daemon reconnects to the socket on startup.
+package holder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Spec describes the process a holder runs. It is written as JSON to a spec file by Spawn and read
+// back by the holder process.
+type Spec struct {
+	ID   string   `json:"id"`
+	Dir  string   `json:"dir"` // holder state directory (socket, exit file)
+	Path string   `json:"path"`
+	Args []string `json:"args"` // argv without argv[0]
+	Env  []string `json:"env"`
+	Cwd  string   `json:"cwd,omitempty"`
+	Cols int      `json:"cols,omitempty"`
+	Rows int      `json:"rows,omitempty"`
+}
+
+// Paths returns the socket, exit-status and spec file paths for a holder in dir.
+func Paths(dir, id string) (sock, exit, spec string) {
+	base := filepath.Join(dir, id)
+	return base + ".sock", base + ".exit", base + ".spec.json"
+}
+
+// Frame types. Every frame is: type (1 byte) | payload length (uint32, big endian) | payload.
+const (
+	frameAttach byte = 'a' // client → holder: request the replay buffer
+	frameReplay byte = 'p' // holder → client: buffered output, sent in response to attach
+	frameOutput byte = 'o' // holder → client: PTY output
+	frameExit   byte = 'x' // holder → client: child exited; payload is the exit code (int32)
+	frameInput  byte = 'i' // client → holder: PTY input
+	frameResize byte = 'r' // client → holder: cols, rows (uint16 each)
+	frameKill   byte = 'k' // client → holder: kill the child
+	// client → holder: SIGINT the PTY's foreground process group (older holders ignore it)
+	frameInterrupt byte = 'c'
+)
+
+const maxFrameLen = 4 << 20
+
+var errFrameTooLarge = errors.New("holder frame too large")
+
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	hdr := make([]byte, 5, 5+len(payload))
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+	_, err := w.Write(append(hdr, payload...))
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxFrameLen {
+		return 0, nil, errFrameTooLarge
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], payload, nil
+}
+
+func encodeExit(code int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(int32(code)))
+	return b
+}
+
+func decodeExit(b []byte) int {
+	if len(b) < 4 {
+		return -1
+	}
+	return int(int32(binary.BigEndian.Uint32(b)))
+}
+
+func encodeSize(cols, rows int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint16(b[0:], uint16(cols))
+	binary.BigEndian.PutUint16(b[2:], uint16(rows))
+	return b
+}
+
+func decodeSize(b []byte) (cols, rows int, ok bool) {
+	if len(b) < 4 {
+		return 0, 0, false
+	}
+	return int(binary.BigEndian.Uint16(b[0:])), int(binary.BigEndian.Uint16(b[2:])), true
+}
+
+// ReadExitFile returns the exit code recorded by a holder whose child has exited.
+func ReadExitFile(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid holder exit file %s: %w", path, err)
+	}
+	return code, nil
+}
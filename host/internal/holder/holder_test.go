@@ -0,0 +1,195 @@
+package holder
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+func requirePTY(t *testing.T) {
+	t.Helper()
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("pty unavailable: %v", err)
+		return
+	}
+	_ = ptmx.Close()
+	_ = tty.Close()
+}
+
+func dialRetry(t *testing.T, sock string) *Conn {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c, err := Dial(sock)
+		if err == nil {
+			return c
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dial: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func readUntil(t *testing.T, r io.Reader, want string) string {
+	t.Helper()
+	var got bytes.Buffer
+	buf := make([]byte, 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for !strings.Contains(got.String(), want) {
+			n, err := r.Read(buf)
+			got.Write(buf[:n])
+			if err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for %q", want)
+	}
+	if !strings.Contains(got.String(), want) {
+		t.Fatalf("output %q does not contain %q", got.String(), want)
+	}
+	return got.String()
+}
+
+func TestHolderSurvivesDetachAndReportsExit(t *testing.T) {
+	requirePTY(t)
+
+	dir := t.TempDir()
+	spec := Spec{
+		ID:   "h1",
+		Dir:  dir,
+		Path: "/bin/sh",
+		Args: []string{"-c", "echo ready; read line; echo got-$line; exit 3"},
+		Env:  os.Environ(),
+	}
+	runErr := make(chan error, 1)
+	go func() { runErr <- Run(spec) }()
+
+	sock, exitPath, _ := Paths(dir, "h1")
+	c1 := dialRetry(t, sock)
+	if !strings.Contains(string(c1.Replay()), "ready") {
+		readUntil(t, c1, "ready")
+	}
+	// Detaching must not stop the child.
+	_ = c1.Close()
+
+	c2 := dialRetry(t, sock)
+	if !strings.Contains(string(c2.Replay()), "ready") {
+		t.Fatalf("replay after reattach=%q want to contain ready", c2.Replay())
+	}
+	if _, err := c2.Write([]byte("abc\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readUntil(t, c2, "got-abc")
+	_, _ = io.Copy(io.Discard, c2)
+	code, err := c2.Wait()
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if code != 3 {
+		t.Fatalf("exit code=%d want=3", code)
+	}
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("holder did not exit")
+	}
+	if code, err := ReadExitFile(exitPath); err != nil || code != 3 {
+		t.Fatalf("exit file code=%d err=%v", code, err)
+	}
+	if _, err := Dial(sock); err != ErrNotRunning {
+		t.Fatalf("dial after exit err=%v want ErrNotRunning", err)
+	}
+}
+
+func TestHolderInterruptSignalsForeground(t *testing.T) {
+	requirePTY(t)
+
+	dir := t.TempDir()
+	spec := Spec{
+		ID:   "h2",
+		Dir:  dir,
+		Path: "/bin/sh",
+		Args: []string{"-c", "trap 'echo got-int; exit 4' INT; echo ready; while :; do sleep 0.05; done"},
+		Env:  os.Environ(),
+	}
+	go func() { _ = Run(spec) }()
+
+	sock, _, _ := Paths(dir, "h2")
+	c := dialRetry(t, sock)
+	if !strings.Contains(string(c.Replay()), "ready") {
+		readUntil(t, c, "ready")
+	}
+	if err := c.Interrupt(); err != nil {
+		t.Fatalf("interrupt: %v", err)
+	}
+	readUntil(t, c, "got-int")
+	_, _ = io.Copy(io.Discard, c)
+	if code, _ := c.Wait(); code != 4 {
+		t.Fatalf("exit code=%d want=4", code)
+	}
+}
+
+func TestHolderStalledClientDoesNotBlockOutput(t *testing.T) {
+	requirePTY(t)
+
+	dir := t.TempDir()
+	spec := Spec{
+		ID:   "h3",
+		Dir:  dir,
+		Path: "/bin/sh",
+		Args: []string{"-c", "read line; yes spam | head -c 4000000; echo spam-done; read line; echo got-$line"},
+		Env:  os.Environ(),
+	}
+	go func() { _ = Run(spec) }()
+
+	// The first client attaches and then never reads, while the child writes far more than the
+	// socket buffers hold.
+	sock, _, _ := Paths(dir, "h3")
+	stalled := dialRetry(t, sock)
+	defer stalled.Close()
+	if _, err := stalled.Write([]byte("go\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	attached := make(chan *Conn, 1)
+	go func() {
+		c, err := Dial(sock)
+		if err != nil {
+			t.Errorf("dial: %v", err)
+		}
+		attached <- c
+	}()
+	var c *Conn
+	select {
+	case c = <-attached:
+	case <-time.After(5 * time.Second):
+		t.Fatal("attach blocked behind the stalled client")
+	}
+	if c == nil {
+		return
+	}
+	readUntil(t, io.MultiReader(bytes.NewReader(c.Replay()), c), "spam-done")
+	if _, err := c.Write([]byte("abc\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readUntil(t, c, "got-abc")
+	_, _ = io.Copy(io.Discard, c)
+}
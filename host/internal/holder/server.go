@@ -0,0 +1,268 @@
+package holder
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+const replayBytes = 64 * 1024
+
+// clientQueue is the number of frames buffered for the attached client. A client that falls
+// further behind is disconnected; it gets the replay buffer when it attaches again.
+const clientQueue = 256
+
+// RunSpecFile reads a spec written by Spawn, removes the file and runs the holder.
+func RunSpecFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	var spec Spec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return err
+	}
+	return Run(spec)
+}
+
+// Run starts the child described by spec in a PTY and serves it on the holder socket until the
+// child exits. At most one client is attached at a time; a new connection replaces the old one.
+// The exit code is sent to the attached client and written to the exit file for clients that
+// reconnect later.
+func Run(spec Spec) error {
+	if spec.ID == "" || spec.Dir == "" || spec.Path == "" {
+		return errors.New("holder spec requires id, dir and path")
+	}
+	if err := os.MkdirAll(spec.Dir, 0o700); err != nil {
+		return err
+	}
+	sockPath, exitPath, _ := Paths(spec.Dir, spec.ID)
+	_ = os.Remove(sockPath)
+	_ = os.Remove(exitPath)
+
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sockPath)
+	defer ln.Close()
+	_ = os.Chmod(sockPath, 0o600)
+
+	cmd := exec.Command(spec.Path, spec.Args...)
+	cmd.Env = spec.Env
+	cmd.Dir = spec.Cwd
+	var ws *pty.Winsize
+	if spec.Cols > 0 && spec.Rows > 0 {
+		ws = &pty.Winsize{Cols: uint16(spec.Cols), Rows: uint16(spec.Rows)}
+	}
+	ptmx, err := pty.StartWithSize(cmd, ws)
+	if err != nil {
+		return err
+	}
+	defer ptmx.Close()
+
+	h := &server{ptmx: ptmx, cmd: cmd}
+	go h.acceptLoop(ln)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		h.readPTY()
+	}()
+
+	code := exitCode(cmd.Wait())
+	// Drain whatever the child wrote before exiting; the PTY read returns EIO once it is empty.
+	select {
+	case <-readDone:
+	case <-time.After(2 * time.Second):
+	}
+	if err := os.WriteFile(exitPath, []byte(strconv.Itoa(code)+"\n"), 0o600); err != nil {
+		log.Printf("holder %s: write exit file: %v", spec.ID, err)
+	}
+	h.exit(code)
+	return nil
+}
+
+type server struct {
+	ptmx *os.File
+	cmd  *exec.Cmd
+
+	mu     sync.Mutex
+	ring   []byte
+	client *client
+	exited bool
+}
+
+// client is the attached connection. Its frames are written by a goroutine of its own, so a
+// client that stops reading never blocks the PTY reader while it holds the server lock.
+type client struct {
+	conn net.Conn
+	out  chan frame
+	done chan struct{}
+}
+
+type frame struct {
+	typ     byte
+	payload []byte
+}
+
+func newClient(conn net.Conn) *client {
+	c := &client{conn: conn, out: make(chan frame, clientQueue), done: make(chan struct{})}
+	go c.writeLoop()
+	return c
+}
+
+func (c *client) writeLoop() {
+	defer close(c.done)
+	defer c.conn.Close()
+	for f := range c.out {
+		if err := writeFrame(c.conn, f.typ, f.payload); err != nil {
+			return
+		}
+	}
+}
+
+// send queues a frame and reports false if the client's queue is full.
+func (c *client) send(typ byte, payload []byte) bool {
+	select {
+	case c.out <- frame{typ, payload}:
+		return true
+	default:
+		return false
+	}
+}
+
+// close drops the client without waiting for queued frames. The caller holds the server lock.
+func (c *client) close() {
+	close(c.out)
+	c.conn.Close()
+}
+
+func (h *server) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go h.serveClient(conn)
+	}
+}
+
+func (h *server) serveClient(conn net.Conn) {
+	for {
+		typ, payload, err := readFrame(conn)
+		if err != nil {
+			h.mu.Lock()
+			if h.client != nil && h.client.conn == conn {
+				h.client.close()
+				h.client = nil
+			}
+			h.mu.Unlock()
+			conn.Close()
+			return
+		}
+		switch typ {
+		case frameAttach:
+			// Replay and switch the live stream to this client atomically, so no output is lost
+			// or duplicated between the two.
+			h.mu.Lock()
+			if h.exited {
+				h.mu.Unlock()
+				conn.Close()
+				return
+			}
+			if h.client == nil || h.client.conn != conn {
+				if h.client != nil {
+					h.client.close()
+				}
+				h.client = newClient(conn)
+			}
+			if !h.client.send(frameReplay, append([]byte(nil), h.ring...)) {
+				h.client.close()
+				h.client = nil
+			}
+			h.mu.Unlock()
+		case frameInput:
+			_, err = h.ptmx.Write(payload)
+		case frameResize:
+			if cols, rows, ok := decodeSize(payload); ok {
+				err = pty.Setsize(h.ptmx, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+			}
+		case frameKill:
+			if h.cmd.Process != nil {
+				// The child is a session leader (pty.Start sets Setsid); kill its whole group.
+				_ = syscall.Kill(-h.cmd.Process.Pid, syscall.SIGKILL)
+				_ = h.cmd.Process.Kill()
+			}
+		case frameInterrupt:
+			err = SignalForeground(h.ptmx, syscall.SIGINT)
+		}
+		if err != nil {
+			log.Printf("holder client frame %q: %v", typ, err)
+		}
+	}
+}
+
+func (h *server) readPTY() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := h.ptmx.Read(buf)
+		if n > 0 {
+			chunk := append([]byte(nil), buf[:n]...)
+			h.mu.Lock()
+			h.ring = append(h.ring, chunk...)
+			if len(h.ring) > replayBytes {
+				h.ring = h.ring[len(h.ring)-replayBytes:]
+			}
+			// Output is buffered while no client is attached; the next attach gets it as replay.
+			if h.client != nil && !h.client.send(frameOutput, chunk) {
+				h.client.close()
+				h.client = nil
+			}
+			h.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// exit tells the attached client the child's exit code and waits briefly for it to be written.
+func (h *server) exit(code int) {
+	h.mu.Lock()
+	h.exited = true
+	c := h.client
+	h.client = nil
+	if c != nil {
+		c.send(frameExit, encodeExit(code))
+		close(c.out)
+	}
+	h.mu.Unlock()
+	if c != nil {
+		select {
+		case <-c.done:
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exit, ok := err.(*exec.ExitError); ok {
+		if status, ok := exit.Sys().(interface{ ExitStatus() int }); ok {
+			return status.ExitStatus()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package holder
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// SignalForeground sends sig to the foreground process group of the terminal whose master is
+// ptmx, like typing the terminal's interrupt character would, but also for programs that put the
+// terminal in raw mode.
+func SignalForeground(ptmx *os.File, sig syscall.Signal) error {
+	rc, err := ptmx.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var pgid int32
+	var errno syscall.Errno
+	// Control rather than Fd, which would switch the PTY to blocking mode.
+	if err := rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgid)))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return syscall.Kill(-int(pgid), sig)
+}
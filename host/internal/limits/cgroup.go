@@ -0,0 +1,127 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cpuPeriod is the cpu.max period in microseconds; the quota is CPU cores times this.
+const cpuPeriod = 100000
+
+// wantControllers are the cgroup v2 controllers limits use.
+var wantControllers = []string{"cpu", "memory", "pids"}
+
+// newCgroupController prepares <parent>/sessions for per-session cgroups. cgroup v2 only allows
+// processes in leaf cgroups once controllers are enabled for children, so when the host itself
+// runs in parent it first moves into <parent>/host. Empty session cgroups left by a previous run
+// are removed.
+func newCgroupController(parent string) (*Controller, error) {
+	if parent == "" {
+		own, err := ownCgroup()
+		if err != nil {
+			return nil, err
+		}
+		parent = filepath.Join(cgroupMount, own)
+	}
+	avail, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a cgroup v2 directory", parent)
+	}
+	var enable []string
+	for _, c := range wantControllers {
+		for _, a := range strings.Fields(string(avail)) {
+			if a == c {
+				enable = append(enable, c)
+			}
+		}
+	}
+	if err := moveSelfToLeaf(parent); err != nil {
+		return nil, err
+	}
+	sessions := filepath.Join(parent, "sessions")
+	if err := os.Mkdir(sessions, 0o755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	for _, dir := range []string{parent, sessions} {
+		if err := enableControllers(dir, enable); err != nil {
+			return nil, fmt.Errorf("enable controllers in %s: %w", dir, err)
+		}
+	}
+	if entries, err := os.ReadDir(sessions); err == nil {
+		for _, e := range entries {
+			if e.IsDir() {
+				// Fails (and is kept) while a detached session still runs in it.
+				_ = os.Remove(filepath.Join(sessions, e.Name()))
+			}
+		}
+	}
+	return &Controller{sessions: sessions, enabled: enable}, nil
+}
+
+// ownCgroup returns the cgroup v2 path of this process, relative to the mount point.
+func ownCgroup() (string, error) {
+	b, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if rest, ok := strings.CutPrefix(line, "0::"); ok {
+			if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+				return "", errors.New("no cgroup v2 hierarchy mounted at " + cgroupMount)
+			}
+			return rest, nil
+		}
+	}
+	return "", errors.New("not in a cgroup v2 hierarchy")
+}
+
+// moveSelfToLeaf moves this process from parent into parent/host. Other processes in parent are
+// left alone; enabling controllers then fails and limits fall back to rlimits.
+func moveSelfToLeaf(parent string) error {
+	procs, err := os.ReadFile(filepath.Join(parent, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	self := strconv.Itoa(os.Getpid())
+	for _, p := range strings.Fields(string(procs)) {
+		if p != self {
+			continue
+		}
+		leaf := filepath.Join(parent, "host")
+		if err := os.Mkdir(leaf, 0o755); err != nil && !os.IsExist(err) {
+			return err
+		}
+		return writeFile(filepath.Join(leaf, "cgroup.procs"), self)
+	}
+	return nil
+}
+
+func enableControllers(dir string, ctrls []string) error {
+	if len(ctrls) == 0 {
+		return nil
+	}
+	return writeFile(filepath.Join(dir, "cgroup.subtree_control"), "+"+strings.Join(ctrls, " +"))
+}
+
+// removeCgroup removes a cgroup, waiting briefly (while rmdir reports EBUSY) for killed processes
+// to leave it.
+func removeCgroup(dir string) error {
+	var err error
+	for i := 0; i < 50; i++ {
+		err = os.Remove(dir)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return err
+}
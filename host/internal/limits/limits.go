@@ -0,0 +1,456 @@
+// Package limits caps the CPU, memory, process count and open files of session processes. It
+// uses a cgroup v2 sub-tree when the host has a delegated, writable cgroup and falls back to
+// per-process rlimits (set with ulimit before the program starts) otherwise.
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalid is returned by Parse for malformed limits.
+var ErrInvalid = errors.New("invalid limits")
+
+// MaxNoFile is the highest open-file limit accepted: the kernel's default fs.nr_open, above which
+// "ulimit -n" fails.
+const MaxNoFile = 1 << 20
+
+// Enforcement modes.
+const (
+	ModeCgroup = "cgroup"
+	ModeRlimit = "rlimit"
+)
+
+// Limits are the resource limits of one session. Zero fields are unlimited.
+type Limits struct {
+	CPU      float64 `json:"cpu,omitempty"`       // CPU cores, e.g. 1.5
+	MemoryMB int64   `json:"memory_mb,omitempty"` // memory in MiB
+	Pids     int64   `json:"pids,omitempty"`      // processes and threads
+	NoFile   uint64  `json:"nofile,omitempty"`    // open files per process
+}
+
+// IsZero reports whether no limit is set.
+func (l Limits) IsZero() bool { return l == Limits{} }
+
+// Merge returns l with the non-zero fields of over applied.
+func (l Limits) Merge(over Limits) Limits {
+	if over.CPU != 0 {
+		l.CPU = over.CPU
+	}
+	if over.MemoryMB != 0 {
+		l.MemoryMB = over.MemoryMB
+	}
+	if over.Pids != 0 {
+		l.Pids = over.Pids
+	}
+	if over.NoFile != 0 {
+		l.NoFile = over.NoFile
+	}
+	return l
+}
+
+// Validate checks that no limit is negative and that nofile can be set.
+func (l Limits) Validate() error {
+	if l.CPU < 0 || l.MemoryMB < 0 || l.Pids < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalid)
+	}
+	if l.NoFile > MaxNoFile {
+		return fmt.Errorf("%w: nofile must be at most %d", ErrInvalid, MaxNoFile)
+	}
+	return nil
+}
+
+// Parse reads limits from a decoded JSON object such as the "limits" session arg:
+// {"cpu":1.5,"memory_mb":2048,"pids":256,"nofile":1024}. A nil v yields no limits.
+func Parse(v interface{}) (Limits, error) {
+	var l Limits
+	if v == nil {
+		return l, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return l, fmt.Errorf("%w: limits must be an object", ErrInvalid)
+	}
+	for k, raw := range m {
+		n, ok := raw.(float64)
+		if !ok || n < 0 {
+			return l, fmt.Errorf("%w: %s must be a non-negative number", ErrInvalid, k)
+		}
+		switch k {
+		case "cpu":
+			l.CPU = n
+		case "memory_mb":
+			l.MemoryMB = int64(n)
+		case "pids":
+			l.Pids = int64(n)
+		case "nofile":
+			if n > MaxNoFile || n != math.Trunc(n) {
+				return l, fmt.Errorf("%w: nofile must be a whole number up to %d", ErrInvalid, MaxNoFile)
+			}
+			l.NoFile = uint64(n)
+		default:
+			return l, fmt.Errorf("%w: unknown limit %q", ErrInvalid, k)
+		}
+	}
+	return l, nil
+}
+
+// Usage is a sample of a group's resource usage. The counters only grow; a change between two
+// samples means a limit was hit in between.
+type Usage struct {
+	MemoryBytes int64 `json:"memory_bytes"`
+	Pids        int64 `json:"pids"`
+	CPUUsec     int64 `json:"cpu_usec"`
+	// Cgroup mode only.
+	CPUThrottled int64 `json:"cpu_throttled,omitempty"` // periods the group was throttled
+	MemoryMax    int64 `json:"memory_max,omitempty"`    // times usage reached memory.max
+	OOMKills     int64 `json:"oom_kills,omitempty"`     // processes killed by the OOM killer
+	PidsMax      int64 `json:"pids_max,omitempty"`      // forks refused by pids.max
+}
+
+// Controller creates the groups sessions run in. A nil *Controller, or one whose cgroup could not
+// be set up, enforces limits with rlimits only.
+type Controller struct {
+	parent   string    // cgroup set up on first use; see NewLazyController
+	setup    sync.Once // guards the lazy setup of sessions and enabled
+	sessions string    // cgroup directory holding one child per session
+	enabled  []string  // controllers enabled in sessions, e.g. "cpu", "memory", "pids"
+}
+
+// cgroupMount is where the cgroup v2 hierarchy is mounted.
+var cgroupMount = "/sys/fs/cgroup"
+
+// NewController sets up a cgroup v2 sub-tree for sessions under parent (default: the host's own
+// cgroup). When that is not possible it logs why and returns nil, so limits fall back to rlimits.
+func NewController(parent string) *Controller {
+	c, err := newCgroupController(parent)
+	if err != nil {
+		log.Printf("resource limits: cgroup v2 unavailable (%v); using rlimits", err)
+		return nil
+	}
+	c.setup.Do(func() {}) // already set up
+	return c
+}
+
+// NewLazyController is NewController, except that the cgroup sub-tree is only set up when the
+// first group is created or opened. Until a session asks for limits, the host's cgroup is left
+// alone.
+func NewLazyController(parent string) *Controller {
+	return &Controller{parent: parent}
+}
+
+// ready sets up a lazy controller's cgroup and reports whether groups use it.
+func (c *Controller) ready() bool {
+	if c == nil {
+		return false
+	}
+	c.setup.Do(func() {
+		ready := NewController(c.parent)
+		if ready != nil {
+			c.sessions, c.enabled = ready.sessions, ready.enabled
+		}
+	})
+	return c.sessions != ""
+}
+
+// Mode returns ModeCgroup or ModeRlimit.
+func (c *Controller) Mode() string {
+	if !c.ready() {
+		return ModeRlimit
+	}
+	return ModeCgroup
+}
+
+// Group is the set of processes of one session and the limits they run under.
+type Group struct {
+	limits Limits
+	dir    string // cgroup directory; "" in rlimit mode
+	pids   []int  // processes tracked in rlimit mode (usage is summed over their trees)
+	unenf  []string
+}
+
+// NewGroup creates the group for session id.
+func (c *Controller) NewGroup(id string, l Limits) (*Group, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	g := &Group{limits: l}
+	if !c.ready() {
+		// rlimits are per process: CPU time is not a rate and RLIMIT_NPROC counts every process of
+		// the user, so neither can express a session's CPU or pids budget.
+		if l.CPU > 0 {
+			g.unenf = append(g.unenf, "cpu")
+		}
+		if l.Pids > 0 {
+			g.unenf = append(g.unenf, "pids")
+		}
+		return g, nil
+	}
+	dir := filepath.Join(c.sessions, id)
+	if err := os.Mkdir(dir, 0o755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	g.dir = dir
+	has := func(ctrl string) bool {
+		for _, e := range c.enabled {
+			if e == ctrl {
+				return true
+			}
+		}
+		return false
+	}
+	writes := []struct {
+		ctrl, name, file, value string
+		set                     bool
+	}{
+		{"cpu", "cpu", "cpu.max", fmt.Sprintf("%d %d", int64(l.CPU*cpuPeriod), cpuPeriod), l.CPU > 0},
+		{"memory", "memory_mb", "memory.max", strconv.FormatInt(l.MemoryMB<<20, 10), l.MemoryMB > 0},
+		{"pids", "pids", "pids.max", strconv.FormatInt(l.Pids, 10), l.Pids > 0},
+	}
+	for _, w := range writes {
+		if !w.set {
+			continue
+		}
+		if !has(w.ctrl) {
+			g.unenf = append(g.unenf, w.name)
+			continue
+		}
+		if err := writeFile(filepath.Join(dir, w.file), w.value); err != nil {
+			_ = g.Close()
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Open returns the existing group of session id (e.g. a detached session reattached after a host
+// restart), or nil if there is none. Its limits are already in place and are not reported.
+func (c *Controller) Open(id string) *Group {
+	if !c.ready() {
+		return nil
+	}
+	dir := filepath.Join(c.sessions, id)
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		return nil
+	}
+	return &Group{dir: dir}
+}
+
+// Mode returns ModeCgroup or ModeRlimit.
+func (g *Group) Mode() string {
+	if g.dir != "" {
+		return ModeCgroup
+	}
+	return ModeRlimit
+}
+
+// Info describes the group for engine_meta: the mode, the limits, which of them cannot be
+// enforced in this mode and whether hitting one is reported (rlimit mode cannot tell).
+func (g *Group) Info() map[string]any {
+	out := map[string]any{"mode": g.Mode(), "hits_reported": g.dir != ""}
+	if g.limits.CPU > 0 {
+		out["cpu"] = g.limits.CPU
+	}
+	if g.limits.MemoryMB > 0 {
+		out["memory_mb"] = g.limits.MemoryMB
+	}
+	if g.limits.Pids > 0 {
+		out["pids"] = g.limits.Pids
+	}
+	if g.limits.NoFile > 0 {
+		out["nofile"] = g.limits.NoFile
+	}
+	if len(g.unenf) > 0 {
+		out["unenforced"] = g.unenf
+	}
+	return out
+}
+
+// Wrap makes cmd (not yet started) run under the group's limits from its first instruction: it
+// is started through a short sh prologue that joins the group's cgroup and sets the rlimits, then
+// execs the original program with the same pid. Processes it starts inherit the limits.
+func (g *Group) Wrap(cmd *exec.Cmd) error {
+	if cmd.Process != nil {
+		return errors.New("limits: command already started")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return err
+	}
+	procs := "/dev/null"
+	var script []string
+	if g.dir != "" {
+		procs = filepath.Join(g.dir, "cgroup.procs")
+		script = append(script, `echo $$ > "$1" || exit 126`)
+	}
+	// ulimit never raises a hard limit; failing to lower one past it is harmless.
+	if g.limits.NoFile > 0 {
+		script = append(script, fmt.Sprintf("ulimit -n %d 2>/dev/null", g.limits.NoFile))
+	}
+	if g.dir == "" && g.limits.MemoryMB > 0 {
+		script = append(script, fmt.Sprintf("ulimit -d %d 2>/dev/null", g.limits.MemoryMB<<10))
+	}
+	script = append(script, "shift", `exec "$@"`)
+	args := []string{"sh", "-c", strings.Join(script, "; "), "rc-limits", procs, cmd.Path}
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	cmd.Path, cmd.Args = sh, args
+	return nil
+}
+
+// Track records a started process for usage sampling in rlimit mode (cgroups account for their
+// processes themselves).
+func (g *Group) Track(pid int) {
+	if g.dir == "" && pid > 0 {
+		g.pids = append(g.pids, pid)
+	}
+}
+
+// Usage samples the group's current usage.
+func (g *Group) Usage() (Usage, error) {
+	if g.dir == "" {
+		return treeUsage(g.pids), nil
+	}
+	var u Usage
+	var err error
+	if u.MemoryBytes, err = readInt(filepath.Join(g.dir, "memory.current")); err != nil && !os.IsNotExist(err) {
+		return u, err
+	}
+	u.Pids, _ = readInt(filepath.Join(g.dir, "pids.current"))
+	cpu := readKeyed(filepath.Join(g.dir, "cpu.stat"))
+	u.CPUUsec, u.CPUThrottled = cpu["usage_usec"], cpu["nr_throttled"]
+	mem := readKeyed(filepath.Join(g.dir, "memory.events"))
+	u.MemoryMax, u.OOMKills = mem["max"], mem["oom_kill"]
+	u.PidsMax = readKeyed(filepath.Join(g.dir, "pids.events"))["max"]
+	return u, nil
+}
+
+// Close kills processes left in the group and removes it. It is a no-op in rlimit mode.
+func (g *Group) Close() error {
+	if g.dir == "" {
+		return nil
+	}
+	_ = writeFile(filepath.Join(g.dir, "cgroup.kill"), "1")
+	return removeCgroup(g.dir)
+}
+
+func writeFile(path, value string) error {
+	return os.WriteFile(path, []byte(value), 0o644)
+}
+
+func readInt(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "max" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// readKeyed parses a flat keyed cgroup file ("key value" per line).
+func readKeyed(path string) map[string]int64 {
+	out := map[string]int64{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return out
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseInt(f[1], 10, 64); err == nil {
+			out[f[0]] = n
+		}
+	}
+	return out
+}
+
+// descendants returns the live descendants of pid, found by scanning /proc.
+func descendants(pid int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	children := map[int][]int{}
+	for _, e := range entries {
+		p, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if pp := parentOf(p); pp > 0 {
+			children[pp] = append(children[pp], p)
+		}
+	}
+	var out []int
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		out = append(out, children[p]...)
+		queue = append(queue, children[p]...)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// procStat returns the fields of /proc/<pid>/stat after the command name.
+func procStat(pid int) []string {
+	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil
+	}
+	// The command name is in parentheses and may contain spaces.
+	i := strings.LastIndexByte(string(b), ')')
+	if i < 0 {
+		return nil
+	}
+	return strings.Fields(string(b[i+1:]))
+}
+
+func parentOf(pid int) int {
+	f := procStat(pid)
+	if len(f) < 2 {
+		return 0
+	}
+	pp, _ := strconv.Atoi(f[1])
+	return pp
+}
+
+// clockTicksUsec is the length of a /proc clock tick (USER_HZ is 100 on Linux).
+const clockTicksUsec = 10000
+
+// treeUsage sums the usage of the live process trees rooted at pids.
+func treeUsage(pids []int) Usage {
+	var u Usage
+	page := int64(os.Getpagesize())
+	for _, root := range pids {
+		for _, p := range append([]int{root}, descendants(root)...) {
+			f := procStat(p)
+			// After the name: state(0) ppid(1) ... utime(11) stime(12) ... rss(21).
+			if len(f) < 22 {
+				continue
+			}
+			u.Pids++
+			utime, _ := strconv.ParseInt(f[11], 10, 64)
+			stime, _ := strconv.ParseInt(f[12], 10, 64)
+			rss, _ := strconv.ParseInt(f[21], 10, 64)
+			u.CPUUsec += (utime + stime) * clockTicksUsec
+			u.MemoryBytes += rss * page
+		}
+	}
+	return u
+}
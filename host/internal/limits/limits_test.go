@@ -0,0 +1,201 @@
+package limits
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAndMerge(t *testing.T) {
+	l, err := Parse(map[string]interface{}{"cpu": 1.5, "memory_mb": float64(512), "nofile": float64(64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != (Limits{CPU: 1.5, MemoryMB: 512, NoFile: 64}) {
+		t.Fatalf("parsed %+v", l)
+	}
+	got := Limits{CPU: 2, Pids: 100}.Merge(l)
+	if got != (Limits{CPU: 1.5, MemoryMB: 512, Pids: 100, NoFile: 64}) {
+		t.Fatalf("merged %+v", got)
+	}
+	for _, bad := range []interface{}{
+		"1",
+		map[string]interface{}{"cpu": -1.0},
+		map[string]interface{}{"memory": 1.0},
+		map[string]interface{}{"pids": "10"},
+		map[string]interface{}{"nofile": float64(MaxNoFile + 1)},
+		map[string]interface{}{"nofile": 1e30},
+		map[string]interface{}{"nofile": 64.5},
+	} {
+		if _, err := Parse(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%v) err=%v", bad, err)
+		}
+	}
+	if l, err := Parse(nil); err != nil || !l.IsZero() {
+		t.Fatalf("Parse(nil)=%+v,%v", l, err)
+	}
+	if err := (Limits{NoFile: MaxNoFile + 1}).Validate(); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Validate of nofile over the maximum err=%v", err)
+	}
+}
+
+// fakeCgroup lays out the files of a delegated cgroup v2 directory.
+func fakeCgroup(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"cgroup.controllers":     "cpuset cpu io memory pids\n",
+		"cgroup.procs":           "",
+		"cgroup.subtree_control": "",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCgroupController(t *testing.T) {
+	parent := fakeCgroup(t)
+	stale := filepath.Join(parent, "sessions", "old")
+	if err := os.MkdirAll(stale, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := NewController(parent)
+	if c.Mode() != ModeCgroup {
+		t.Fatal("fake cgroup not used")
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatal("empty session cgroup from a previous run kept")
+	}
+	if b, _ := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control")); string(b) != "+cpu +memory +pids" {
+		t.Fatalf("subtree_control=%q", b)
+	}
+
+	g, err := c.NewGroup("s1", Limits{CPU: 0.5, MemoryMB: 256, Pids: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(parent, "sessions", "s1")
+	for file, want := range map[string]string{
+		"cpu.max":    "50000 100000",
+		"memory.max": strconv.Itoa(256 << 20),
+		"pids.max":   "64",
+	} {
+		if b, _ := os.ReadFile(filepath.Join(dir, file)); string(b) != want {
+			t.Errorf("%s=%q want %q", file, b, want)
+		}
+	}
+	// The wrapped program joins the cgroup before it runs, keeping its pid.
+	cmd := exec.Command("sh", "-c", "echo $$")
+	if err := g.Wrap(cmd); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "cgroup.procs")); strings.TrimSpace(string(b)) != strings.TrimSpace(string(out)) {
+		t.Fatalf("cgroup.procs=%q, program pid %q", b, out)
+	}
+
+	for file, content := range map[string]string{
+		"memory.current": "1048576\n",
+		"pids.current":   "3\n",
+		"cpu.stat":       "usage_usec 2500\nnr_throttled 4\n",
+		"memory.events":  "low 0\nhigh 0\nmax 7\noom 1\noom_kill 1\n",
+		"pids.events":    "max 2\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, err := g.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Usage{MemoryBytes: 1 << 20, Pids: 3, CPUUsec: 2500, CPUThrottled: 4, MemoryMax: 7, OOMKills: 1, PidsMax: 2}
+	if u != want {
+		t.Fatalf("usage=%+v want %+v", u, want)
+	}
+	if c.Open("s1") == nil || c.Open("missing") != nil {
+		t.Fatal("Open")
+	}
+}
+
+func TestLazyCgroupController(t *testing.T) {
+	parent := fakeCgroup(t)
+	c := NewLazyController(parent)
+	if _, err := os.Stat(filepath.Join(parent, "sessions")); !os.IsNotExist(err) {
+		t.Fatal("cgroup set up before the first group")
+	}
+	if b, _ := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control")); len(b) != 0 {
+		t.Fatalf("subtree_control=%q before the first group", b)
+	}
+	g, err := c.NewGroup("s1", Limits{Pids: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Mode() != ModeCgroup {
+		t.Fatal("fake cgroup not used")
+	}
+	if b, _ := os.ReadFile(filepath.Join(parent, "sessions", "s1", "pids.max")); string(b) != "8" {
+		t.Fatalf("pids.max=%q", b)
+	}
+
+	if c := NewLazyController(t.TempDir()); c.Mode() != ModeRlimit {
+		t.Fatal("lazy controller for a directory that is not a cgroup")
+	}
+}
+
+func TestCgroupControllerUnavailable(t *testing.T) {
+	if c := NewController(t.TempDir()); c != nil {
+		t.Fatal("controller for a directory that is not a cgroup")
+	}
+}
+
+func TestRlimitGroup(t *testing.T) {
+	var c *Controller
+	g, err := c.NewGroup("s1", Limits{CPU: 1, Pids: 10, NoFile: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := g.Info(); info["mode"] != ModeRlimit || info["hits_reported"] != false || strings.Join(info["unenforced"].([]string), ",") != "cpu,pids" {
+		t.Fatalf("info=%v", info)
+	}
+	cmd := exec.Command("sh", "-c", `ulimit -n; echo "$@"`, "sh", "a b", "c")
+	if err := g.Wrap(cmd); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "64\na b c\n" {
+		t.Fatalf("output=%q", out)
+	}
+
+	sleep := exec.Command("sleep", "5")
+	if err := sleep.Start(); err != nil {
+		t.Skip("sleep unavailable")
+	}
+	defer sleep.Process.Kill()
+	g.Track(sleep.Process.Pid)
+	// Right after Start the child may not have exec'd yet and reports no memory.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		u, _ := g.Usage()
+		if u.Pids == 1 && u.MemoryBytes > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("usage=%+v", u)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
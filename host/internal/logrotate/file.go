@@ -0,0 +1,192 @@
+// Package logrotate implements size- and age-based rotation of session logs and a janitor that
+// enforces a retention policy on the log directory.
+package logrotate
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options controls when a File is rotated. Zero values disable the corresponding limit.
+type Options struct {
+	MaxBytes int64         // rotate once the current file reaches this size
+	MaxAge   time.Duration // rotate once the current file is older than this
+	Compress bool          // gzip rotated files
+}
+
+// File is an append-only log file that rotates itself according to Options. Rotated files are
+// renamed to <name>.<UTC timestamp><ext> next to the original (e.g. 01H….20261017T101500.000Z.log)
+// and, with Compress, gzipped in the background.
+type File struct {
+	path string
+	opts Options
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	opened  time.Time
+	pending sync.WaitGroup // background compressions
+}
+
+// Open opens path for appending, creating it if needed.
+func Open(path string, opts Options) (*File, error) {
+	lf := &File{path: path, opts: opts}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	lf.f = f
+	lf.size = 0
+	lf.opened = time.Now()
+	if st, err := f.Stat(); err == nil {
+		lf.size = st.Size()
+		if st.Size() > 0 {
+			// The creation time of an existing file is not portable to get; its last modification
+			// underestimates the age, which at worst delays an age-based rotation.
+			lf.opened = st.ModTime()
+		}
+	}
+	return nil
+}
+
+// Path returns the path of the current (unrotated) file.
+func (lf *File) Path() string {
+	return lf.path
+}
+
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if lf.due(int64(len(p))) {
+		if err := lf.rotate(); err != nil {
+			log.Printf("log rotation failed (%s): %v", lf.path, err)
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+func (lf *File) due(next int64) bool {
+	if lf.size == 0 {
+		return false
+	}
+	if lf.opts.MaxBytes > 0 && lf.size+next > lf.opts.MaxBytes {
+		return true
+	}
+	return lf.opts.MaxAge > 0 && time.Since(lf.opened) >= lf.opts.MaxAge
+}
+
+// rotate must be called with lf.mu held. If the rename fails the current file keeps growing.
+func (lf *File) rotate() error {
+	if err := lf.f.Close(); err != nil {
+		return err
+	}
+	lf.f = nil
+	rotated := uniqueName(RotatedName(lf.path, time.Now()))
+	renameErr := os.Rename(lf.path, rotated)
+	if err := lf.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	if lf.opts.Compress {
+		lf.pending.Add(1)
+		go func() {
+			defer lf.pending.Done()
+			if err := compressFile(rotated); err != nil {
+				log.Printf("log compression failed (%s): %v", rotated, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// Close closes the current file and waits for background compression to finish.
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	var err error
+	if lf.f != nil {
+		err = lf.f.Close()
+		lf.f = nil
+	}
+	lf.mu.Unlock()
+	lf.pending.Wait()
+	return err
+}
+
+// RotatedName returns the name a file at path is rotated to at time t.
+func RotatedName(path string, t time.Time) string {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	return filepath.Join(dir, stem+"."+t.UTC().Format("20060102T150405.000Z")+ext)
+}
+
+// uniqueName appends -1, -2, … before the extension when name (or its compressed form) is taken,
+// which happens when a file rotates more than once per millisecond.
+func uniqueName(name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; exists(candidate) || exists(candidate+".gz"); i++ {
+		candidate = stem + "-" + strconv.Itoa(i) + ext
+	}
+	return candidate
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := path + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
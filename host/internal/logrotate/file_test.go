@@ -0,0 +1,79 @@
+package logrotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileRotatesBySizeAndCompresses(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s1.log")
+	f, err := Open(path, Options{MaxBytes: 10, Compress: true})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, chunk := range []string{"aaaaaa", "bbbbbb", "cccccc"} {
+		if _, err := f.Write([]byte(chunk)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	cur, _ := os.ReadFile(path)
+	if string(cur) != "cccccc" {
+		t.Fatalf("current=%q", cur)
+	}
+	rotated, _ := filepath.Glob(filepath.Join(dir, "s1.*.log.gz"))
+	if len(rotated) != 2 {
+		t.Fatalf("rotated=%v", rotated)
+	}
+	var got []string
+	for _, r := range rotated {
+		zf, _ := os.Open(r)
+		zr, err := gzip.NewReader(zf)
+		if err != nil {
+			t.Fatalf("gzip %s: %v", r, err)
+		}
+		b, _ := io.ReadAll(zr)
+		zf.Close()
+		got = append(got, string(b))
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "aaaaaa,bbbbbb" {
+		t.Fatalf("rotated contents=%v", got)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "s1.*.log")); len(left) != 0 {
+		t.Fatalf("uncompressed rotated files left: %v", left)
+	}
+}
+
+func TestFileRotatesByAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s2.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(path, past, past)
+
+	f, err := Open(path, Options{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, _ = f.Write([]byte("new\n"))
+	_ = f.Close()
+
+	cur, _ := os.ReadFile(path)
+	rotated, _ := filepath.Glob(filepath.Join(dir, "s2.*.log"))
+	if string(cur) != "new\n" || len(rotated) != 1 {
+		t.Fatalf("current=%q rotated=%v", cur, rotated)
+	}
+}
@@ -0,0 +1,126 @@
+package logrotate
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retention limits the log directory. Zero values disable the corresponding limit.
+type Retention struct {
+	MaxTotalBytes int64         // delete the oldest files until the directory is below this size
+	MaxAge        time.Duration // delete files not modified for this long
+}
+
+// Enabled reports whether any limit is set.
+func (r Retention) Enabled() bool {
+	return r.MaxTotalBytes > 0 || r.MaxAge > 0
+}
+
+// Janitor enforces a Retention on the session files in Dir (<id>.log, rotated logs and <id>.cast).
+// The live <id>.log and <id>.cast of the sessions Active returns are counted but never deleted;
+// their rotated files are. Sweep calls Active after listing Dir, so a session that creates its
+// files while a sweep runs is in the set.
+type Janitor struct {
+	Dir       string
+	Retention Retention
+	Active    func() map[string]bool
+}
+
+type dirFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	active  bool
+}
+
+// Run sweeps every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	if !j.Retention.Enabled() {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if removed, err := j.Sweep(); err != nil {
+			log.Printf("log janitor: %v", err)
+		} else if len(removed) > 0 {
+			log.Printf("log janitor: removed %d file(s) from %s", len(removed), j.Dir)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sweep deletes files that exceed the retention policy and returns their paths.
+func (j *Janitor) Sweep() ([]string, error) {
+	entries, err := os.ReadDir(j.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var active map[string]bool
+	if j.Active != nil {
+		active = j.Active()
+	}
+	var files []dirFile
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() || !isSessionFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		id, rest, _ := strings.Cut(e.Name(), ".")
+		live := !strings.Contains(rest, ".")
+		files = append(files, dirFile{
+			path:    filepath.Join(j.Dir, e.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			active:  live && active[id],
+		})
+		total += info.Size()
+	}
+	sort.Slice(files, func(a, b int) bool { return files[a].modTime.Before(files[b].modTime) })
+
+	var removed []string
+	now := time.Now()
+	for _, f := range files {
+		if f.active {
+			continue
+		}
+		expired := j.Retention.MaxAge > 0 && now.Sub(f.modTime) > j.Retention.MaxAge
+		overSize := j.Retention.MaxTotalBytes > 0 && total > j.Retention.MaxTotalBytes
+		if !expired && !overSize {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			log.Printf("log janitor: remove %s: %v", f.path, err)
+			continue
+		}
+		total -= f.size
+		removed = append(removed, f.path)
+	}
+	return removed, nil
+}
+
+// isSessionFile matches live and rotated session logs and recordings, but not in-progress
+// compression output.
+func isSessionFile(name string) bool {
+	if strings.HasSuffix(name, ".tmp") {
+		return false
+	}
+	name = strings.TrimSuffix(name, ".gz")
+	return strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".cast")
+}
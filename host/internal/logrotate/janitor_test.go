@@ -0,0 +1,63 @@
+package logrotate
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJanitorSweep(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"old.log", 10, 48 * time.Hour},                          // expired
+		{"live.log", 10, 72 * time.Hour},                         // live file of a running session
+		{"live.20260101T000000.000Z.log.gz", 10, 72 * time.Hour}, // rotated file of a running session
+		{"a.log", 40, 3 * time.Hour},                             // oldest within max age
+		{"b.cast", 40, 2 * time.Hour},
+		{"c.log", 40, time.Hour},
+		{"new.log", 0, 0},                                         // just claimed by a session that is starting
+		{"notes.txt", 1000, 96 * time.Hour},                       // not a session file
+		{"d.20260101T000000.000Z.log.gz.tmp", 10, 96 * time.Hour}, // compression in progress
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, f.name)
+		if err := os.WriteFile(p, make([]byte, f.size), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		mt := now.Add(-f.age)
+		_ = os.Chtimes(p, mt, mt)
+	}
+
+	j := &Janitor{
+		Dir:       dir,
+		Retention: Retention{MaxAge: 24 * time.Hour, MaxTotalBytes: 95},
+		Active:    func() map[string]bool { return map[string]bool{"live": true, "new": true} },
+	}
+	removed, err := j.Sweep()
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	var names []string
+	for _, p := range removed {
+		names = append(names, filepath.Base(p))
+	}
+	sort.Strings(names)
+	// Session files total 150 bytes; after the expired ones (30) the remaining 120 are still over 95,
+	// so the oldest deletable file (a.log) goes too. live.log is kept.
+	if got, want := strings.Join(names, ","), "a.log,live.20260101T000000.000Z.log.gz,old.log"; got != want {
+		t.Fatalf("removed=%s want %s", got, want)
+	}
+	for _, keep := range []string{"live.log", "new.log", "b.cast", "c.log", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, keep)); err != nil {
+			t.Fatalf("%s should be kept: %v", keep, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrWorkspaceNotDir is returned for workspace paths that do not exist or are not directories.
+	ErrWorkspaceNotDir = errors.New("workspace does not exist or is not a directory")
+	// ErrWorkspaceNotAllowed is returned for workspace paths outside every allowed root.
+	ErrWorkspaceNotAllowed = errors.New("workspace is outside the allowed roots")
+)
+
+// Workspaces restricts session working directories to a set of root directories. A nil
+// *Workspaces (no roots configured) allows any existing directory.
+type Workspaces struct {
+	roots []string // canonical
+}
+
+// NewWorkspaces returns the policy for roots, each of which must be an existing directory. It
+// returns nil when roots is empty.
+func NewWorkspaces(roots []string) (*Workspaces, error) {
+	if len(roots) == 0 {
+		return nil, nil
+	}
+	w := &Workspaces{}
+	for _, r := range roots {
+		c, err := canonicalDir(r)
+		if err != nil {
+			return nil, fmt.Errorf("workspace root %q: %w", r, err)
+		}
+		w.roots = append(w.roots, c)
+	}
+	return w, nil
+}
+
+// Restricted reports whether workspaces are limited to configured roots.
+func (w *Workspaces) Restricted() bool { return w != nil }
+
+// Roots returns the canonical allowed roots in configuration order.
+func (w *Workspaces) Roots() []string {
+	if w == nil {
+		return nil
+	}
+	return append([]string(nil), w.roots...)
+}
+
+// Default returns the workspace to use when a session does not name one: the first root, or ""
+// when unrestricted.
+func (w *Workspaces) Default() string {
+	if w == nil {
+		return ""
+	}
+	return w.roots[0]
+}
+
+// Resolve canonicalises path (absolute, symlinks and ".." resolved) and checks that it is a
+// directory inside one of the roots.
+func (w *Workspaces) Resolve(path string) (string, error) {
+	c, err := canonicalDir(path)
+	if err != nil {
+		return "", err
+	}
+	if w == nil {
+		return c, nil
+	}
+	for _, root := range w.roots {
+		if within(root, c) {
+			return c, nil
+		}
+	}
+	return "", ErrWorkspaceNotAllowed
+}
+
+func canonicalDir(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", ErrWorkspaceNotDir
+	}
+	c, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", ErrWorkspaceNotDir
+	}
+	if st, err := os.Stat(c); err != nil || !st.IsDir() {
+		return "", ErrWorkspaceNotDir
+	}
+	return c, nil
+}
+
+// within reports whether path is root or below it; both must be canonical.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,67 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspaces_Resolve(t *testing.T) {
+	base, _ := filepath.EvalSymlinks(t.TempDir())
+	root := filepath.Join(base, "src")
+	sibling := filepath.Join(base, "src2") // shares the root's prefix
+	for _, d := range []string{filepath.Join(root, "app"), sibling} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(sibling, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "app"), filepath.Join(base, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWorkspaces([]string{root})
+	if err != nil {
+		t.Fatalf("NewWorkspaces: %v", err)
+	}
+	ok := map[string]string{
+		root:                                  root,
+		filepath.Join(root, "app"):            filepath.Join(root, "app"),
+		filepath.Join(root, "app", "..", "."): root,
+		filepath.Join(base, "link"):           filepath.Join(root, "app"),
+	}
+	for in, want := range ok {
+		if got, err := w.Resolve(in); err != nil || got != want {
+			t.Errorf("Resolve(%q)=%q,%v want %q", in, got, err, want)
+		}
+	}
+	notAllowed := []string{
+		base,
+		sibling,
+		filepath.Join(root, "escape"),
+		filepath.Join(root, "..", "src2"),
+		"/",
+	}
+	for _, in := range notAllowed {
+		if _, err := w.Resolve(in); !errors.Is(err, ErrWorkspaceNotAllowed) {
+			t.Errorf("Resolve(%q) err=%v want ErrWorkspaceNotAllowed", in, err)
+		}
+	}
+	if _, err := w.Resolve(filepath.Join(root, "missing")); !errors.Is(err, ErrWorkspaceNotDir) {
+		t.Errorf("missing dir err=%v", err)
+	}
+	if w.Default() != root {
+		t.Errorf("Default()=%q", w.Default())
+	}
+
+	var none *Workspaces
+	if got, err := none.Resolve(sibling); err != nil || got != sibling || none.Restricted() {
+		t.Errorf("unrestricted Resolve=%q,%v", got, err)
+	}
+	if _, err := NewWorkspaces([]string{filepath.Join(base, "missing")}); err == nil {
+		t.Error("missing root accepted")
+	}
+}
@@ -0,0 +1,174 @@
+// Package sandbox runs session processes in new mount, pid, network (and user, ipc, uts) namespaces
+// using bubblewrap: the filesystem is read-only except for the session workspace and a private
+// /tmp, and the host's own state can be masked.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Host policy modes.
+const (
+	ModeOff     = "off"     // sessions run unsandboxed unless they ask for it
+	ModeOn      = "on"      // sessions are sandboxed unless they opt out
+	ModeEnforce = "enforce" // every session is sandboxed
+)
+
+var (
+	// ErrUnavailable is returned when a sandbox is required but bwrap cannot be found.
+	ErrUnavailable = errors.New("sandbox unavailable: bwrap (bubblewrap) not found on PATH")
+	// ErrRequired is returned when a session opts out of a sandbox the host enforces.
+	ErrRequired = errors.New("sandbox is enforced by the host")
+)
+
+// Policy is the host-wide sandbox configuration.
+type Policy struct {
+	Mode string
+	// Hide lists host paths masked inside every sandbox (directories become empty, files
+	// /dev/null), e.g. rc-host's state directory and token file.
+	Hide []string
+}
+
+// ParseMode validates a --sandbox flag value ("" means off).
+func ParseMode(s string) (string, error) {
+	switch s {
+	case "", ModeOff:
+		return ModeOff, nil
+	case ModeOn, ModeEnforce:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid sandbox mode %q (want off, on or enforce)", s)
+}
+
+// Enabled decides whether a session is sandboxed: requested is the session's own choice (nil when
+// it did not say).
+func (p Policy) Enabled(requested *bool) (bool, error) {
+	switch {
+	case p.Mode == ModeEnforce:
+		if requested != nil && !*requested {
+			return false, ErrRequired
+		}
+		return true, nil
+	case requested != nil:
+		return *requested, nil
+	}
+	return p.Mode == ModeOn, nil
+}
+
+// Options describe the sandbox of one session.
+type Options struct {
+	// Network keeps the host network; otherwise the process only has a loopback interface.
+	Network bool
+	// Workspace is bind-mounted read-write at the same path.
+	Workspace string
+	// Writable lists further paths bind-mounted read-write when they exist (e.g. an agent's
+	// config and auth directory).
+	Writable []string
+	// Hide is Policy.Hide.
+	Hide []string
+	// ReadOnly lists paths bind-mounted read-only after Hide when they exist, so they stay visible
+	// inside hidden directories (e.g. a session's uploaded attachments).
+	ReadOnly []string
+}
+
+// HiddenBy returns the entry of o.Hide that masks path (path itself or one of its parents), if
+// any. A workspace there would be masked too, and binding it over the mask could expose the rest
+// of the hidden directory, so sessions must not use one.
+func (o Options) HiddenBy(path string) (string, bool) {
+	path = resolvePath(path)
+	for _, h := range o.Hide {
+		rel, err := filepath.Rel(resolvePath(h), path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return h, true
+		}
+	}
+	return "", false
+}
+
+// resolvePath returns the absolute path of p with symlinks resolved as far as it exists.
+func resolvePath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	return abs
+}
+
+// Find returns the path of bwrap or ErrUnavailable.
+func Find() (string, error) {
+	path, err := exec.LookPath("bwrap")
+	if err != nil {
+		return "", ErrUnavailable
+	}
+	return path, nil
+}
+
+// Wrap rewrites cmd (not yet started) to run inside a sandbox described by opts. The program keeps
+// its path, arguments, environment and working directory.
+func Wrap(cmd *exec.Cmd, opts Options) error {
+	if cmd.Process != nil {
+		return errors.New("sandbox: command already started")
+	}
+	bwrap, err := Find()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"bwrap"}, Args(cmd, opts)...)
+	cmd.Path, cmd.Args = bwrap, args
+	return nil
+}
+
+// Args returns the bwrap arguments that run cmd's program under opts.
+func Args(cmd *exec.Cmd, opts Options) []string {
+	args := []string{"--die-with-parent", "--unshare-all"}
+	if opts.Network {
+		args = append(args, "--share-net")
+	}
+	args = append(args,
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	)
+	// Later mounts win, so the workspace may live under /tmp and hidden paths inside it stay hidden.
+	if opts.Workspace != "" {
+		args = append(args, "--bind", opts.Workspace, opts.Workspace)
+	}
+	for _, p := range opts.Writable {
+		args = append(args, "--bind-try", p, p)
+	}
+	for _, p := range opts.Hide {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		st, err := os.Stat(abs)
+		switch {
+		case err != nil:
+			continue
+		case st.IsDir():
+			args = append(args, "--tmpfs", abs)
+		default:
+			args = append(args, "--ro-bind", "/dev/null", abs)
+		}
+	}
+	for _, p := range opts.ReadOnly {
+		args = append(args, "--ro-bind-try", p, p)
+	}
+	if cmd.Dir != "" {
+		args = append(args, "--chdir", cmd.Dir)
+	}
+	args = append(args, "--", cmd.Path)
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	return args
+}
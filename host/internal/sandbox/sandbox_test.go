@@ -0,0 +1,96 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyEnabled(t *testing.T) {
+	yes, no := true, false
+	cases := []struct {
+		mode      string
+		requested *bool
+		want      bool
+		err       error
+	}{
+		{ModeOff, nil, false, nil},
+		{ModeOff, &yes, true, nil},
+		{ModeOn, nil, true, nil},
+		{ModeOn, &no, false, nil},
+		{ModeEnforce, nil, true, nil},
+		{ModeEnforce, &yes, true, nil},
+		{ModeEnforce, &no, false, ErrRequired},
+	}
+	for _, c := range cases {
+		got, err := Policy{Mode: c.mode}.Enabled(c.requested)
+		if got != c.want || !errors.Is(err, c.err) {
+			t.Errorf("mode=%s requested=%v: got %v,%v", c.mode, c.requested, got, err)
+		}
+	}
+	if _, err := ParseMode("strict"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+	if m, err := ParseMode(""); err != nil || m != ModeOff {
+		t.Errorf("ParseMode(\"\")=%q,%v", m, err)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	dir := t.TempDir()
+	ws := filepath.Join(dir, "ws")
+	state := filepath.Join(dir, "state")
+	token := filepath.Join(dir, "token")
+	for _, d := range []string{ws, state} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(token, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("/bin/echo", "a b", "c")
+	cmd.Dir = ws
+	got := strings.Join(Args(cmd, Options{
+		Workspace: ws,
+		Writable:  []string{"/home/u/.codex"},
+		Hide:      []string{state, token, filepath.Join(dir, "missing")},
+		ReadOnly:  []string{filepath.Join(state, "attachments")},
+	}), " ")
+	want := "--die-with-parent --unshare-all --ro-bind / / --dev /dev --proc /proc --tmpfs /tmp" +
+		" --bind " + ws + " " + ws +
+		" --bind-try /home/u/.codex /home/u/.codex" +
+		" --tmpfs " + state +
+		" --ro-bind /dev/null " + token +
+		" --ro-bind-try " + filepath.Join(state, "attachments") + " " + filepath.Join(state, "attachments") +
+		" --chdir " + ws +
+		" -- /bin/echo a b c"
+	if got != want {
+		t.Fatalf("args:\n got %s\nwant %s", got, want)
+	}
+	if got := Args(exec.Command("/bin/true"), Options{Network: true}); got[2] != "--share-net" {
+		t.Fatalf("network args=%v", got)
+	}
+}
+
+func TestHiddenBy(t *testing.T) {
+	dir := t.TempDir()
+	state := filepath.Join(dir, "state")
+	opts := Options{Hide: []string{state, filepath.Join(dir, "token")}}
+	for path, want := range map[string]bool{
+		state:                                 true,
+		filepath.Join(state, "sessions"):      true,
+		filepath.Join(state, "..", "state"):   true,
+		dir:                                   false,
+		filepath.Join(dir, "state-other"):     false,
+		filepath.Join(dir, "ws", "..state"):   false,
+		filepath.Join(dir, "token", "a", "b"): true,
+	} {
+		if _, got := opts.HiddenBy(path); got != want {
+			t.Errorf("HiddenBy(%s)=%v want %v", path, got, want)
+		}
+	}
+}
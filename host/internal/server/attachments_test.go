@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionAttachments(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = --help ]; then echo \"usage: cursor-agent [-p] [--output-format text|json|stream-json]\"; fi\n"
+	if err := os.WriteFile(filepath.Join(bin, "cursor-agent"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir(), AttachmentMaxBytes: 8})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	h := s.authMiddleware(false, http.HandlerFunc(s.handleAPI))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "http://example"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer t")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	sess, err := s.manager.Create(context.Background(), "cursor", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.manager.Terminate(sess.ID)
+
+	rr := do(http.MethodPost, "/api/sessions/"+sess.ID+"/attachments?name=notes.txt", "notes")
+	var att map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &att); rr.Code != http.StatusCreated || err != nil {
+		t.Fatalf("upload: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if att["id"] != "att1" || att["name"] != "notes.txt" || att["size"] != float64(5) {
+		t.Fatalf("attachment=%v", att)
+	}
+	if rr := do(http.MethodPost, "/api/sessions/"+sess.ID+"/attachments?name=big.txt", "123456789"); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("too large: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = do(http.MethodGet, "/api/sessions/"+sess.ID+"/attachments", "")
+	var list []map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); rr.Code != http.StatusOK || err != nil || len(list) != 1 {
+		t.Fatalf("list: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "/api/sessions/nope/attachments", "x"); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown session: status=%d", rr.Code)
+	}
+
+	shell, err := s.manager.Create(context.Background(), "shell", "", map[string]interface{}{"shell": "sh"})
+	if err != nil {
+		t.Fatalf("create shell: %v", err)
+	}
+	defer s.manager.Terminate(shell.ID)
+	if rr := do(http.MethodPost, "/api/sessions/"+shell.ID+"/attachments?name=a.txt", "x"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("shell session: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func TestAuthMiddleware_BearerToken(t *testing.T) {
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t0k", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t0k", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -34,7 +34,7 @@ func TestAuthMiddleware_BearerToken(t *testing.T) {
 }
 
 func TestAuthMiddleware_RawToken(t *testing.T) {
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "raw", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "raw", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,7 +50,7 @@ func TestAuthMiddleware_RawToken(t *testing.T) {
 }
 
 func TestAuthMiddleware_EmptyConfigTokenRejectsAll(t *testing.T) {
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -65,7 +65,7 @@ func TestAuthMiddleware_EmptyConfigTokenRejectsAll(t *testing.T) {
 }
 
 func TestAPI_DoesNotAcceptQueryToken(t *testing.T) {
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "q", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "q", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -80,7 +80,7 @@ func TestAPI_DoesNotAcceptQueryToken(t *testing.T) {
 }
 
 func TestHealthz_NoAuth(t *testing.T) {
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "x", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "x", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListCodexThreads(t *testing.T) {
+	bin := t.TempDir()
+	script := `#!/bin/sh
+while read -r line; do
+  case "$line" in
+    *'"initialize"'*) echo '{"jsonrpc":"2.0","id":1,"result":{}}' ;;
+    *'"thread/list"'*) echo '{"jsonrpc":"2.0","id":2,"result":{"data":[{"id":"th-9","preview":"fix it","createdAt":1700000000}],"nextCursor":"c2"}}' ;;
+  esac
+done
+`
+	if err := os.WriteFile(filepath.Join(bin, "codex"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	h := s.authMiddleware(false, http.HandlerFunc(s.handleAPI))
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example"+path, nil)
+		req.Header.Set("Authorization", "Bearer t")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/api/codex/threads?limit=20")
+	want := `{"threads":[{"id":"th-9","preview":"fix it","created_at":1700000000}],"next_cursor":"c2"}`
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != want {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := get("/api/codex/threads?limit=0"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad limit: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
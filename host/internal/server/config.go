@@ -1,5 +1,11 @@
 package server
 
+import (
+	"github.com/ericbosch/cli-remote-control/host/internal/limits"
+	"github.com/ericbosch/cli-remote-control/host/internal/logrotate"
+	"github.com/ericbosch/cli-remote-control/host/internal/session"
+)
+
 // Config holds server configuration.
 type Config struct {
 	Bind   string
@@ -7,4 +13,37 @@ type Config struct {
 	Token  string
 	LogDir string
 	WebDir string
+	// StateDir holds the host's state: the session registry and event logs, usage ledger,
+	// attachments, holder sockets, share links and templates. Empty means ".run".
+	StateDir string
+	// DetachSessions runs PTY sessions under detached holder processes so they survive restarts.
+	DetachSessions bool
+	// EnginesConfig is an optional JSON file with additional engine definitions.
+	EnginesConfig string
+	// LogRotation controls rotation of the per-session logs in LogDir.
+	LogRotation logrotate.Options
+	// LogRetention is enforced on LogDir by a background janitor while the server runs.
+	LogRetention logrotate.Retention
+	// WorkspaceRoots, when set, are the only directories (and their subdirectories) sessions may
+	// use as their workspace.
+	WorkspaceRoots []string
+	// Limits are the default resource limits of new sessions; args.limits overrides them.
+	Limits limits.Limits
+	// CgroupParent is the cgroup v2 directory session cgroups are created under: "auto" for the
+	// host's own cgroup, "" to enforce limits with rlimits only. It is set up when the first
+	// session with limits starts.
+	CgroupParent string
+	// Sandbox is the sandbox policy of sessions: "off" (default; sessions may opt in), "on"
+	// (sessions may opt out) or "enforce".
+	Sandbox string
+	// SandboxHide lists extra host paths (e.g. the token file) masked inside sandboxes, in
+	// addition to the host's state and log directories.
+	SandboxHide []string
+	// Codex restricts the model, effort, approval policy and sandbox mode codex sessions may
+	// choose; empty lists allow any value.
+	Codex session.CodexPolicy
+	// AttachmentMaxBytes and AttachmentQuota limit uploaded attachments per file and per session;
+	// zero uses session.DefaultAttachmentMaxBytes and session.DefaultAttachmentQuota.
+	AttachmentMaxBytes int64
+	AttachmentQuota    int64
 }
@@ -11,7 +11,7 @@ import (
 )
 
 func TestCreateSessionInvalidWorkspaceReturns400JSON(t *testing.T) {
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatalf("new server: %v", err)
 	}
@@ -55,7 +55,7 @@ func TestCreateCodexSessionMissingCodexReturns424JSON(t *testing.T) {
 	t.Cleanup(func() { _ = os.Setenv("PATH", origPath) })
 	_ = os.Setenv("PATH", "")
 
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatalf("new server: %v", err)
 	}
@@ -94,3 +94,32 @@ func TestCreateCodexSessionMissingCodexReturns424JSON(t *testing.T) {
 	}
 }
 
+
+func TestCreateShellSessionInvalidArgsReturns400JSON(t *testing.T) {
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+
+	b, _ := json.Marshal(map[string]any{"engine": "shell", "args": map[string]any{"shell": "python"}})
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/sessions", bytes.NewReader(b))
+	req.Header.Set("Authorization", "Bearer t")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", res.StatusCode)
+	}
+	var env apiErrorEnvelope
+	if err := json.NewDecoder(res.Body).Decode(&env); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if env.Error.Code != "invalid_args" || !strings.Contains(env.Error.Hint, "bash") {
+		t.Fatalf("unexpected error: %+v", env.Error)
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/session"
 )
 
 func TestEnginesIncludesShell(t *testing.T) {
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatalf("new server: %v", err)
 	}
@@ -40,3 +44,77 @@ func TestEnginesIncludesShell(t *testing.T) {
 		t.Fatalf("expected engines to include shell, got %#v", engines)
 	}
 }
+
+func TestEnginesDetailsDescribeCapabilities(t *testing.T) {
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/engines?details=1", nil)
+	req.Header.Set("Authorization", "Bearer t")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	defer res.Body.Close()
+	var infos []session.EngineInfo
+	if err := json.NewDecoder(res.Body).Decode(&infos); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	names := map[string]session.EngineInfo{}
+	for _, info := range infos {
+		names[info.Name] = info
+	}
+	for _, want := range []string{"shell", "codex", "cursor"} {
+		if _, ok := names[want]; !ok {
+			t.Fatalf("details missing %q: %#v", want, infos)
+		}
+	}
+	if sh := names["shell"]; !sh.Available || !sh.Capabilities.PTY {
+		t.Fatalf("shell info unexpected: %#v", sh)
+	}
+}
+
+func TestEnginesIncludeConfiguredEngines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engines.json")
+	if err := os.WriteFile(path, []byte(`{"engines":[{"name":"repl","bin":"sh","args":["-i"]}]}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir(), EnginesConfig: path})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/engines", nil)
+	req.Header.Set("Authorization", "Bearer t")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	defer res.Body.Close()
+	var engines []string
+	if err := json.NewDecoder(res.Body).Decode(&engines); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, e := range engines {
+		if e == "repl" {
+			return
+		}
+	}
+	t.Fatalf("expected engines to include repl, got %#v", engines)
+}
+
+func TestNewRejectsInvalidEnginesConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engines.json")
+	if err := os.WriteFile(path, []byte(`{"engines":[{"name":"codex","bin":"sh"}]}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := New(Config{Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir(), EnginesConfig: path}); err == nil {
+		t.Fatal("expected error for engine shadowing a built-in")
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/session"
+)
+
+func TestCreateJob(t *testing.T) {
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	h := s.authMiddleware(false, http.HandlerFunc(s.handleAPI))
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "http://example/api/jobs", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer t")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post(`{"timeout_seconds":5}`); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_args") {
+		t.Fatalf("missing command: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"command":"true","limits":{"cpu":"all"}}`); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_args") {
+		t.Fatalf("bad limits: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"command":"true","workspacePath":"/does/not/exist"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad workspace: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// wait returns the session of a created job once it has finished.
+	wait := func(rr *httptest.ResponseRecorder) *session.Session {
+		t.Helper()
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var info map[string]any
+		_ = json.Unmarshal(rr.Body.Bytes(), &info)
+		if info["engine"] != "exec" {
+			t.Fatalf("info=%v", info)
+		}
+		sess := s.manager.Get(info["id"].(string))
+		if sess == nil {
+			t.Fatal("job missing from the session list")
+		}
+		select {
+		case <-sess.Done():
+		case <-time.After(10 * time.Second):
+			t.Fatal("job did not finish")
+		}
+		return sess
+	}
+
+	sess := wait(post(`{"name":"tests","command":"echo ok","workspacePath":"` + t.TempDir() + `","timeout_seconds":10}`))
+	if sess.Name != "tests" || string(sess.Replay(0)) != "ok\n" {
+		t.Fatalf("name=%q output=%q", sess.Name, sess.Replay(0))
+	}
+	meta, _ := sess.Info()["engine_meta"].(map[string]any)
+	if meta["exit_code"] != 0 || meta["timed_out"] != false || meta["duration_ms"] == nil {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+
+	sess = wait(post(`{"command":"sleep 30","timeout_seconds":0.2}`))
+	if _, code := sess.State(); code != 124 {
+		t.Fatalf("timed out job exit code=%d want 124", code)
+	}
+	meta, _ = sess.Info()["engine_meta"].(map[string]any)
+	if meta["exit_code"] != 124 || meta["timed_out"] != true {
+		t.Fatalf("timed out engine_meta=%v", meta)
+	}
+}
+
+func TestSandboxUnavailable(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := New(Config{Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir(), Sandbox: "enforce"}); err == nil {
+		t.Fatal("enforced sandbox without bwrap accepted")
+	}
+	if _, err := New(Config{Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir(), Sandbox: "strict"}); err == nil {
+		t.Fatal("unknown sandbox mode accepted")
+	}
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir(), Sandbox: "on"})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "http://example/api/jobs", strings.NewReader(`{"command":"true"}`))
+	req.Header.Set("Authorization", "Bearer t")
+	s.authMiddleware(false, http.HandlerFunc(s.handleAPI)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusFailedDependency || !strings.Contains(rr.Body.String(), "sandbox_unavailable") {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestInterruptSession(t *testing.T) {
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	h := s.authMiddleware(false, http.HandlerFunc(s.handleAPI))
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "http://example"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer t")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("/api/sessions/nope/interrupt", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown session: status=%d", rr.Code)
+	}
+	rr := post("/api/jobs", `{"command":"sleep 30"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var info map[string]any
+	_ = json.Unmarshal(rr.Body.Bytes(), &info)
+	id := info["id"].(string)
+	// A signal sent before the shell has started would be lost.
+	time.Sleep(200 * time.Millisecond)
+	if rr := post("/api/sessions/"+id+"/interrupt", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("interrupt: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	select {
+	case <-s.manager.Get(id).Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("job still running after SIGINT")
+	}
+	if rr := post("/api/sessions/"+id+"/interrupt", ""); rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "session_exited") {
+		t.Fatalf("interrupt after exit: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetRecording(t *testing.T) {
+	logDir := t.TempDir()
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: logDir})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+
+	get := func(id string) *http.Response {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, ts.URL+"/api/sessions/"+id+"/recording", nil)
+		req.Header.Set("Authorization", "Bearer t")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("do: %v", err)
+		}
+		return res
+	}
+
+	res := get("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing recording: expected 404, got %d", res.StatusCode)
+	}
+
+	cast := "{\"version\":2,\"width\":80,\"height\":24,\"timestamp\":1}\n[0.1,\"o\",\"hi\"]\n"
+	if err := os.WriteFile(filepath.Join(logDir, "01ARZ3NDEKTSV4RRFFQ69G5FAV.cast"), []byte(cast), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	res = get("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != cast {
+		t.Fatalf("status=%d body=%q", res.StatusCode, body)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/x-asciicast" {
+		t.Fatalf("content-type=%q", ct)
+	}
+	if cd := res.Header.Get("Content-Disposition"); !strings.Contains(cd, "01ARZ3NDEKTSV4RRFFQ69G5FAV.cast") {
+		t.Fatalf("content-disposition=%q", cd)
+	}
+}
@@ -4,31 +4,110 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ericbosch/cli-remote-control/host/internal/codexrpc"
+	"github.com/ericbosch/cli-remote-control/host/internal/limits"
+	"github.com/ericbosch/cli-remote-control/host/internal/policy"
+	"github.com/ericbosch/cli-remote-control/host/internal/sandbox"
 	"github.com/ericbosch/cli-remote-control/host/internal/session"
 )
 
+// logJanitorInterval is how often LogRetention is enforced.
+const logJanitorInterval = 10 * time.Minute
+
 // Server is the HTTP and WebSocket server.
 type Server struct {
-	cfg     Config
-	manager *session.Manager
-	tickets *wsTicketManager
-	mux     *http.ServeMux
+	cfg        Config
+	manager    *session.Manager
+	tickets    *wsTicketManager
+	shares     *shareManager
+	templates  *templateStore
+	workspaces *policy.Workspaces // nil: any existing directory is allowed
+	mux        *http.ServeMux
 }
 
 // New creates a new server.
 func New(cfg Config) (*Server, error) {
-	mgr := session.NewManager(cfg.LogDir, 64, filepath.Join(".run", "sessions"))
+	workspaces, err := policy.NewWorkspaces(cfg.WorkspaceRoots)
+	if err != nil {
+		return nil, err
+	}
+	stateDir := cfg.StateDir
+	if stateDir == "" {
+		stateDir = ".run"
+	}
+	mgr := session.NewManager(cfg.LogDir, 64, filepath.Join(stateDir, "sessions"))
+	if cfg.EnginesConfig != "" {
+		engines, err := session.LoadEngineConfig(cfg.EnginesConfig)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range engines {
+			mgr.Engines().Register(e)
+		}
+	}
+	mgr.SetLogRotation(cfg.LogRotation)
+	if err := cfg.Limits.Validate(); err != nil {
+		return nil, err
+	}
+	var limitCtl *limits.Controller // nil: rlimits only
+	if parent := cfg.CgroupParent; parent != "" {
+		if parent == "auto" {
+			parent = "" // the host's own cgroup
+		}
+		limitCtl = limits.NewLazyController(parent)
+	}
+	mgr.SetResourceLimits(limitCtl, cfg.Limits)
+	sandboxMode, err := sandbox.ParseMode(cfg.Sandbox)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sandbox.Find(); err != nil && sandboxMode != sandbox.ModeOff {
+		if sandboxMode == sandbox.ModeEnforce {
+			return nil, err
+		}
+		log.Printf("Warning: %v; sessions will fail to start unless they opt out of the sandbox", err)
+	}
+	if err := cfg.Codex.Validate(); err != nil {
+		return nil, err
+	}
+	mgr.SetCodexPolicy(cfg.Codex)
+	attachMax, attachQuota := cfg.AttachmentMaxBytes, cfg.AttachmentQuota
+	if attachMax <= 0 {
+		attachMax = session.DefaultAttachmentMaxBytes
+	}
+	if attachQuota <= 0 {
+		attachQuota = session.DefaultAttachmentQuota
+	}
+	mgr.SetAttachmentLimits(attachMax, attachQuota)
+	mgr.SetSandbox(sandbox.Policy{
+		Mode: sandboxMode,
+		Hide: append([]string{stateDir, cfg.LogDir}, cfg.SandboxHide...),
+	})
+	if cfg.DetachSessions {
+		mgr.EnableDetached(filepath.Join(stateDir, "holders"))
+	}
+	if err := mgr.Restore(); err != nil {
+		log.Printf("session registry restore failed: %v", err)
+	}
 	mux := http.NewServeMux()
-	s := &Server{cfg: cfg, manager: mgr, tickets: newWSTicketManager(), mux: mux}
+	s := &Server{
+		cfg:        cfg,
+		manager:    mgr,
+		tickets:    newWSTicketManager(),
+		shares:     newShareManager(filepath.Join(stateDir, "shares.json")),
+		templates:  newTemplateStore(filepath.Join(stateDir, "templates.json")),
+		workspaces: workspaces,
+		mux:        mux,
+	}
 	s.routes()
 	return s, nil
 }
@@ -38,6 +117,7 @@ func (s *Server) routes() {
 
 	api := s.authMiddleware(false, http.HandlerFunc(s.handleAPI))
 	s.mux.Handle("/api/", api)
+	s.mux.HandleFunc("/shared/", s.handleShared)
 	s.mux.Handle("/ws/events/", s.wsAuthMiddleware(http.HandlerFunc(s.handleWSEvents)))
 	s.mux.Handle("/ws/", s.wsAuthMiddleware(http.HandlerFunc(s.handleWS)))
 	if s.cfg.WebDir != "" {
@@ -92,6 +172,17 @@ func (s *Server) wsAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Share links only grant access to the events stream of their own session.
+		if token := strings.TrimSpace(r.URL.Query().Get("share")); token != "" {
+			sh, ok := s.shares.Lookup(token, time.Now())
+			if !ok || r.URL.Path != "/ws/events/"+sh.SessionID {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), shareCtxKey{}, sh)))
+			return
+		}
+
 		ticket := strings.TrimSpace(r.URL.Query().Get("ticket"))
 		if ticket == "" {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
@@ -117,16 +208,82 @@ func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case path == "/api/engines" && r.Method == http.MethodGet:
 		s.listEngines(w, r)
+	case path == "/api/usage" && r.Method == http.MethodGet:
+		s.getUsage(w, r)
+	case path == "/api/codex/threads" && r.Method == http.MethodGet:
+		s.listCodexThreads(w, r)
 	case path == "/api/ws-ticket" && r.Method == http.MethodPost:
 		s.issueWSTicket(w, r)
 	case path == "/api/sessions" && r.Method == http.MethodGet:
 		s.listSessions(w, r)
 	case path == "/api/sessions" && r.Method == http.MethodPost:
 		s.createSession(w, r)
+	case path == "/api/jobs" && r.Method == http.MethodPost:
+		s.createJob(w, r)
+	case path == "/api/workspaces" && r.Method == http.MethodGet:
+		s.listWorkspaces(w, r)
+	case path == "/api/templates" && r.Method == http.MethodGet:
+		s.listTemplates(w, r)
+	case path == "/api/templates" && r.Method == http.MethodPost:
+		s.putTemplate(w, r)
+	case strings.HasPrefix(path, "/api/templates/") && len(path) > len("/api/templates/") && r.Method == http.MethodDelete:
+		s.deleteTemplate(w, r, path[len("/api/templates/"):])
 	default:
-		// /api/sessions/{id}/terminate
+		// /api/sessions/{id}/recording, /api/sessions/{id}/shares
+		if len(path) > len("/api/sessions/") && r.Method == http.MethodGet {
+			rest := path[len("/api/sessions/"):]
+			if strings.HasSuffix(rest, "/recording") {
+				id := strings.TrimSuffix(rest, "/recording")
+				if id != "" {
+					s.getRecording(w, r, id)
+					return
+				}
+			}
+			if strings.HasSuffix(rest, "/shares") {
+				id := strings.TrimSuffix(rest, "/shares")
+				if id != "" {
+					s.listShares(w, r, id)
+					return
+				}
+			}
+			if strings.HasSuffix(rest, "/attachments") {
+				id := strings.TrimSuffix(rest, "/attachments")
+				if id != "" {
+					s.listAttachments(w, r, id)
+					return
+				}
+			}
+		}
+		// /api/shares/{shareId}
+		if len(path) > len("/api/shares/") && strings.HasPrefix(path, "/api/shares/") && r.Method == http.MethodDelete {
+			s.revokeShare(w, r, path[len("/api/shares/"):])
+			return
+		}
+		// /api/sessions/{id}/terminate, /api/sessions/{id}/interrupt, /api/sessions/{id}/shares,
+		// /api/sessions/{id}/attachments
 		if len(path) > len("/api/sessions/") && r.Method == http.MethodPost {
 			rest := path[len("/api/sessions/"):]
+			if strings.HasSuffix(rest, "/attachments") {
+				id := strings.TrimSuffix(rest, "/attachments")
+				if id != "" {
+					s.uploadAttachment(w, r, id)
+					return
+				}
+			}
+			if strings.HasSuffix(rest, "/shares") {
+				id := strings.TrimSuffix(rest, "/shares")
+				if id != "" {
+					s.createShare(w, r, id)
+					return
+				}
+			}
+			if strings.HasSuffix(rest, "/interrupt") {
+				id := strings.TrimSuffix(rest, "/interrupt")
+				if id != "" {
+					s.interruptSession(w, r, id)
+					return
+				}
+			}
 			if strings.HasSuffix(rest, "/terminate") {
 				id := strings.TrimSuffix(rest, "/terminate")
 				if id != "" {
@@ -139,23 +296,22 @@ func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) listEngines(w http.ResponseWriter, _ *http.Request) {
-	// Shell is always available.
-	engines := []string{"shell"}
-
-	if _, err := exec.LookPath("codex"); err == nil {
-		engines = append(engines, "codex")
+// listEngines returns the names of the registered engines that are available on this host
+// (shell is always available). With ?details=1 it returns each engine's EngineInfo instead,
+// including unavailable ones.
+func (s *Server) listEngines(w http.ResponseWriter, r *http.Request) {
+	infos := s.manager.Engines().Detect(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("details") == "1" {
+		jsonEncoder(w).Encode(infos)
+		return
 	}
-	// Cursor support is best-effort; it may rely on cursor-agent/agent/cursor.
-	if _, err := exec.LookPath("cursor-agent"); err == nil {
-		engines = append(engines, "cursor")
-	} else if _, err := exec.LookPath("agent"); err == nil {
-		engines = append(engines, "cursor")
-	} else if _, err := exec.LookPath("cursor"); err == nil {
-		engines = append(engines, "cursor")
+	engines := []string{}
+	for _, info := range infos {
+		if info.Available {
+			engines = append(engines, info.Name)
+		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
 	jsonEncoder(w).Encode(engines)
 }
 
@@ -170,20 +326,61 @@ func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
 	enc.Encode(out)
 }
 
+// sessionRequest is the body of POST /api/sessions.
+type sessionRequest struct {
+	Engine        string                 `json:"engine"`
+	Name          string                 `json:"name"`
+	WorkspacePath string                 `json:"workspacePath"`
+	Workspace     string                 `json:"workspace"` // backward-compatible alias
+	Prompt        string                 `json:"prompt"`
+	Mode          string                 `json:"mode"`
+	Args          map[string]interface{} `json:"args"`
+	// Template names a stored template supplying defaults for the fields above.
+	Template string `json:"template"`
+}
+
 func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		Engine        string                 `json:"engine"`
-		Name          string                 `json:"name"`
-		WorkspacePath string                 `json:"workspacePath"`
-		Workspace     string                 `json:"workspace"` // backward-compatible alias
-		Prompt        string                 `json:"prompt"`
-		Mode          string                 `json:"mode"`
-		Args          map[string]interface{} `json:"args"`
+	var body sessionRequest
+	if err := jsonDecode(r, &body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid JSON body", "")
+		return
 	}
+	if body.Template != "" {
+		t, ok := s.templates.Get(body.Template)
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "unknown_template", "Unknown template", "Choose a template from GET /api/templates.")
+			return
+		}
+		body = t.apply(body)
+	}
+	s.startSession(w, r, body)
+}
+
+// createJob starts a non-interactive job (an exec engine session). The body holds the exec
+// engine args at the top level, plus name and workspacePath:
+// {"command":"make test","workspacePath":"/src/app","timeout_seconds":600}.
+func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
 	if err := jsonDecode(r, &body); err != nil {
 		writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid JSON body", "")
 		return
 	}
+	req := sessionRequest{Engine: "exec", Args: map[string]interface{}{}}
+	for k, v := range body {
+		switch k {
+		case "name":
+			req.Name, _ = v.(string)
+		case "workspacePath", "workspace":
+			req.WorkspacePath, _ = v.(string)
+		default:
+			req.Args[k] = v
+		}
+	}
+	s.startSession(w, r, req)
+}
+
+// startSession validates body and creates the session it describes.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, body sessionRequest) {
 	if body.Engine == "" {
 		// Secure, reliable default: shell-first.
 		body.Engine = "shell"
@@ -191,19 +388,25 @@ func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
 	if body.WorkspacePath == "" && body.Workspace != "" {
 		body.WorkspacePath = body.Workspace
 	}
-	switch body.Engine {
-	case "shell", "codex", "cursor":
-		// ok
-	default:
+	if _, ok := s.manager.Engines().Get(body.Engine); !ok {
 		writeAPIError(w, http.StatusBadRequest, "invalid_engine", "Unknown engine", "Choose an engine from GET /api/engines (at minimum: shell).")
 		return
 	}
 
 	if body.WorkspacePath != "" {
-		if st, err := os.Stat(body.WorkspacePath); err != nil || !st.IsDir() {
+		ws, err := s.workspaces.Resolve(body.WorkspacePath)
+		if errors.Is(err, policy.ErrWorkspaceNotAllowed) {
+			writeAPIError(w, http.StatusBadRequest, "invalid_workspace", "Workspace path is outside the allowed workspace roots", "Choose a directory under one of the roots listed by GET /api/workspaces.")
+			return
+		}
+		if err != nil {
 			writeAPIError(w, http.StatusBadRequest, "invalid_workspace", "Workspace path does not exist or is not a directory", "Set Workspace to an existing directory, or leave it blank to use a safe default.")
 			return
 		}
+		body.WorkspacePath = ws
+	} else if s.workspaces.Restricted() {
+		// Never fall back to the daemon's cwd, which may be outside the roots.
+		body.WorkspacePath = s.workspaces.Default()
 	}
 
 	// For engines that need a cwd, prefer a safe default when empty.
@@ -217,6 +420,20 @@ func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
 	for k, v := range body.Args {
 		args[k] = v
 	}
+	if roots, ok := args["writable_roots"].([]interface{}); ok && body.Engine == "codex" {
+		// Extra writable roots are held to the same roots as the workspace.
+		resolved := make([]interface{}, 0, len(roots))
+		for _, v := range roots {
+			root, _ := v.(string)
+			p, err := s.workspaces.Resolve(root)
+			if err != nil || !filepath.IsAbs(root) {
+				writeAPIError(w, http.StatusBadRequest, "invalid_workspace", "Writable root is not an allowed directory", "Each writable_roots entry must be an existing directory under one of the roots listed by GET /api/workspaces.")
+				return
+			}
+			resolved = append(resolved, p)
+		}
+		args["writable_roots"] = resolved
+	}
 	if body.WorkspacePath != "" {
 		args["workspacePath"] = body.WorkspacePath
 	}
@@ -229,6 +446,18 @@ func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
 
 	sess, err := s.manager.Create(r.Context(), body.Engine, body.Name, args)
 	if err != nil {
+		if errors.Is(err, session.ErrSessionExists) {
+			writeAPIError(w, http.StatusConflict, "session_exists", "Session ID already has persisted history", "Retry the request; a new session ID will be generated.")
+			return
+		}
+		if errors.Is(err, session.ErrInvalidArgs) {
+			writeAPIError(w, http.StatusBadRequest, "invalid_args", "Invalid session args", err.Error())
+			return
+		}
+		if errors.Is(err, sandbox.ErrUnavailable) {
+			writeAPIError(w, http.StatusFailedDependency, "sandbox_unavailable", "Sandbox unavailable", "Install bubblewrap (bwrap) on the host, or create the session with \"sandbox\": false.")
+			return
+		}
 		// Codex errors should be actionable and never opaque 500s.
 		if body.Engine == "codex" {
 			code := "codex_failed"
@@ -249,6 +478,76 @@ func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
 	jsonEncoder(w).Encode(sess.Info())
 }
 
+// getUsage returns the token usage of agent sessions per day and engine over the last ?days=
+// days (default 30, today included) and the latest rate limits of each engine.
+func (s *Server) getUsage(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 400 {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid days", "days must be between 1 and 400.")
+			return
+		}
+		days = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonEncoder(w).Encode(s.manager.Usage(days))
+}
+
+// listCodexThreads returns a page of the codex threads stored on the host, which sessions can
+// resume with args.thread_id. ?cursor= is the next_cursor of the previous page.
+func (s *Server) listCodexThreads(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid limit", "")
+			return
+		}
+		limit = n
+	}
+	page, err := session.ListCodexThreads(r.Context(), q.Get("cursor"), limit)
+	if err != nil {
+		code := "codex_failed"
+		hint := "Ensure the 'codex' CLI is installed and authenticated on the host."
+		if errors.Is(err, codexrpc.ErrCodexUnavailable) {
+			code = "codex_unavailable"
+			hint = "Install the 'codex' CLI on the host and ensure it is on PATH."
+		}
+		writeAPIError(w, http.StatusFailedDependency, code, "Listing codex threads failed", err.Error()+"\n"+hint)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonEncoder(w).Encode(page)
+}
+
+// listWorkspaces returns the allowed workspace roots for clients to pick from. restricted is false
+// (and roots empty) when no roots are configured and any directory may be used.
+func (s *Server) listWorkspaces(w http.ResponseWriter, r *http.Request) {
+	roots := []map[string]string{}
+	for _, root := range s.workspaces.Roots() {
+		roots = append(roots, map[string]string{"path": root, "name": filepath.Base(root)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonEncoder(w).Encode(map[string]any{
+		"restricted": s.workspaces.Restricted(),
+		"roots":      roots,
+	})
+}
+
+// getRecording serves the asciicast v2 recording of a session for download.
+func (s *Server) getRecording(w http.ResponseWriter, r *http.Request, id string) {
+	path, err := s.manager.RecordingPath(id)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "No recording for this session", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+id+`.cast"`)
+	http.ServeFile(w, r, path)
+}
+
 func (s *Server) terminateSession(w http.ResponseWriter, r *http.Request, id string) {
 	if err := s.manager.Terminate(id); err != nil {
 		if err == session.ErrNotFound {
@@ -261,6 +560,63 @@ func (s *Server) terminateSession(w http.ResponseWriter, r *http.Request, id str
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// interruptSession stops the session's current operation without ending the session.
+func (s *Server) interruptSession(w http.ResponseWriter, r *http.Request, id string) {
+	sess := s.manager.Get(id)
+	if sess == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch err := sess.Interrupt(); {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, session.ErrUnsupported):
+		writeAPIError(w, http.StatusConflict, "interrupt_unsupported", "This engine cannot interrupt without ending the session", "Terminate the session instead.")
+	case errors.Is(err, session.ErrIdle):
+		writeAPIError(w, http.StatusConflict, "idle", "Nothing to interrupt", "")
+	case errors.Is(err, io.ErrClosedPipe):
+		writeAPIError(w, http.StatusConflict, "session_exited", "The session has exited", "")
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "interrupt_failed", err.Error(), "")
+	}
+}
+
+// uploadAttachment stores the request body as an attachment of a session; ?name= is its file name.
+// Messages reference it by the returned id.
+func (s *Server) uploadAttachment(w http.ResponseWriter, r *http.Request, id string) {
+	sess := s.manager.Get(id)
+	if sess == nil {
+		http.NotFound(w, r)
+		return
+	}
+	att, err := sess.AddAttachment(r.URL.Query().Get("name"), r.Body)
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		jsonEncoder(w).Encode(att)
+	case errors.Is(err, session.ErrAttachmentTooLarge):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "attachment_too_large", "Attachment too large", err.Error())
+	case errors.Is(err, session.ErrInvalidArgs):
+		writeAPIError(w, http.StatusBadRequest, "attachments_unsupported", "This engine does not take attachments", err.Error())
+	case errors.Is(err, io.ErrClosedPipe):
+		writeAPIError(w, http.StatusConflict, "session_exited", "The session has exited", "")
+	default:
+		log.Printf("upload attachment: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal error", "")
+	}
+}
+
+func (s *Server) listAttachments(w http.ResponseWriter, r *http.Request, id string) {
+	sess := s.manager.Get(id)
+	if sess == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonEncoder(w).Encode(sess.Attachments())
+}
+
 func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	// /ws/sessions/{id}
@@ -285,7 +641,7 @@ func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer conn.Close()
-	runSessionWS(r.Context(), conn, sess)
+	runSessionWS(r.Context(), conn, sess, r.URL.Query().Get("name"))
 }
 
 // Run starts the HTTP server and blocks until ctx is cancelled.
@@ -294,8 +650,12 @@ func (s *Server) Run(ctx context.Context) error {
 	srv := &http.Server{Addr: addr, Handler: corsMiddleware(s.mux)}
 	go func() {
 		<-ctx.Done()
+		s.manager.FlushUsage()
 		srv.Shutdown(context.Background())
 	}()
+	if s.cfg.LogRetention.Enabled() {
+		go s.manager.RunLogJanitor(ctx, s.cfg.LogRetention, logJanitorInterval)
+	}
 	log.Printf("Listening on http://%s", addr)
 	return srv.ListenAndServe()
 }
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/ericbosch/cli-remote-control/host/internal/session"
+)
+
+// Share link permissions.
+const (
+	sharePermView  = "view"  // watch the session
+	sharePermInput = "input" // watch and type (subject to the input lock)
+)
+
+const (
+	defaultShareTTL = time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+// share is a link granting access to a single session until it expires or is revoked. Only a
+// hash of its token is kept; the token itself is returned once, when the share is created.
+type share struct {
+	ID         string `json:"id"`
+	SessionID  string `json:"session_id"`
+	Permission string `json:"permission"`
+	CreatedMS  int64  `json:"created_ms"`
+	ExpiresMS  int64  `json:"expires_ms"`
+	TokenHash  string `json:"token_hash"`
+}
+
+func (sh share) expired(now time.Time) bool { return now.UnixMilli() >= sh.ExpiresMS }
+
+// info is the API representation of sh (without the token hash).
+func (sh share) info() map[string]any {
+	return map[string]any{
+		"id":         sh.ID,
+		"session_id": sh.SessionID,
+		"permission": sh.Permission,
+		"created_ms": sh.CreatedMS,
+		"expires_ms": sh.ExpiresMS,
+	}
+}
+
+// shareManager stores share links in a JSON file so they survive host restarts, and tracks the
+// connections opened with each one so revoking a share disconnects them.
+type shareManager struct {
+	mu     sync.Mutex
+	path   string
+	shares map[string]share // by ID
+	conns  map[string]map[*context.CancelFunc]struct{}
+}
+
+func newShareManager(path string) *shareManager {
+	m := &shareManager{path: path, shares: make(map[string]share), conns: make(map[string]map[*context.CancelFunc]struct{})}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("share links load failed: %v", err)
+		}
+		return m
+	}
+	var list []share
+	if err := json.Unmarshal(b, &list); err != nil {
+		log.Printf("share links load failed: %v", err)
+		return m
+	}
+	// Expired shares are dropped on the next save.
+	for _, sh := range list {
+		m.shares[sh.ID] = sh
+	}
+	return m
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create mints a share for sessionID and returns it with its token.
+func (m *shareManager) Create(sessionID, permission string, ttl time.Duration, now time.Time) (share, string, error) {
+	// 24 bytes => 32 chars base64url (no padding), like WS tickets.
+	tb := make([]byte, 24)
+	ib := make([]byte, 8)
+	if _, err := rand.Read(tb); err != nil {
+		return share{}, "", err
+	}
+	if _, err := rand.Read(ib); err != nil {
+		return share{}, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(tb)
+	sh := share{
+		ID:         hex.EncodeToString(ib),
+		SessionID:  sessionID,
+		Permission: permission,
+		CreatedMS:  now.UnixMilli(),
+		ExpiresMS:  now.Add(ttl).UnixMilli(),
+		TokenHash:  hashShareToken(token),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shares[sh.ID] = sh
+	if err := m.saveLocked(now); err != nil {
+		delete(m.shares, sh.ID)
+		return share{}, "", err
+	}
+	return sh, token, nil
+}
+
+// List returns the unexpired shares of sessionID.
+func (m *shareManager) List(sessionID string, now time.Time) []share {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []share{}
+	for _, sh := range m.shares {
+		if sh.SessionID == sessionID && !sh.expired(now) {
+			out = append(out, sh)
+		}
+	}
+	return out
+}
+
+// Lookup returns the unexpired share whose token is token.
+func (m *shareManager) Lookup(token string, now time.Time) (share, bool) {
+	if token == "" {
+		return share{}, false
+	}
+	h := hashShareToken(token)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sh := range m.shares {
+		if sh.TokenHash == h && !sh.expired(now) {
+			return sh, true
+		}
+	}
+	return share{}, false
+}
+
+// Revoke deletes a share and cancels the connections opened with it.
+func (m *shareManager) Revoke(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sh, ok := m.shares[id]
+	if !ok {
+		return false, nil
+	}
+	delete(m.shares, id)
+	if err := m.saveLocked(time.Now()); err != nil {
+		m.shares[id] = sh
+		return false, err
+	}
+	for cancel := range m.conns[id] {
+		(*cancel)()
+	}
+	delete(m.conns, id)
+	return true, nil
+}
+
+// Track registers cancel to be called when share id is revoked; call the returned func when the
+// connection ends.
+func (m *shareManager) Track(id string, cancel context.CancelFunc) (untrack func()) {
+	key := &cancel
+	m.mu.Lock()
+	if m.conns[id] == nil {
+		m.conns[id] = make(map[*context.CancelFunc]struct{})
+	}
+	m.conns[id][key] = struct{}{}
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		delete(m.conns[id], key)
+		if len(m.conns[id]) == 0 {
+			delete(m.conns, id)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// saveLocked atomically rewrites the share file, dropping expired shares.
+func (m *shareManager) saveLocked(now time.Time) error {
+	list := make([]share, 0, len(m.shares))
+	for id, sh := range m.shares {
+		if sh.expired(now) {
+			delete(m.shares, id)
+			continue
+		}
+		list = append(list, sh)
+	}
+	return writeJSONFile(m.path, list)
+}
+
+type shareCtxKey struct{}
+
+// shareFromContext returns the share a request was authenticated with, if any.
+func shareFromContext(ctx context.Context) (share, bool) {
+	sh, ok := ctx.Value(shareCtxKey{}).(share)
+	return sh, ok
+}
+
+// createShare mints a share link for a session: POST /api/sessions/{id}/shares with an optional
+// body {"permission":"view"|"input","ttl_seconds":N}.
+func (s *Server) createShare(w http.ResponseWriter, r *http.Request, id string) {
+	if s.manager.Get(id) == nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Session not found", "")
+		return
+	}
+	var body struct {
+		Permission string `json:"permission"`
+		TTLSeconds int64  `json:"ttl_seconds"`
+	}
+	if err := jsonDecode(r, &body); err != nil && !errors.Is(err, io.EOF) {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid JSON body", "")
+		return
+	}
+	if body.Permission == "" {
+		body.Permission = sharePermView
+	}
+	if body.Permission != sharePermView && body.Permission != sharePermInput {
+		writeAPIError(w, http.StatusBadRequest, "invalid_permission", "Unknown share permission", `Use "view" or "input".`)
+		return
+	}
+	ttl := time.Duration(body.TTLSeconds) * time.Second
+	if body.TTLSeconds == 0 {
+		ttl = defaultShareTTL
+	}
+	if ttl <= 0 || ttl > maxShareTTL {
+		writeAPIError(w, http.StatusBadRequest, "invalid_ttl", "Share expiry out of range", "Set ttl_seconds between 1 and 2592000 (30 days).")
+		return
+	}
+	sh, token, err := s.shares.Create(id, body.Permission, ttl, time.Now())
+	if err != nil {
+		log.Printf("create share: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal error", "")
+		return
+	}
+	out := sh.info()
+	out["token"] = token
+	out["ws_path"] = "/ws/events/" + id + "?share=" + token
+	out["rest_path"] = "/shared/" + token
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	jsonEncoder(w).Encode(out)
+}
+
+// listShares returns the active share links of a session (without tokens).
+func (s *Server) listShares(w http.ResponseWriter, r *http.Request, id string) {
+	list := s.shares.List(id, time.Now())
+	out := make([]map[string]any, len(list))
+	for i, sh := range list {
+		out[i] = sh.info()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	jsonEncoder(w).Encode(out)
+}
+
+// revokeShare deletes a share link and disconnects clients using it: DELETE /api/shares/{id}.
+func (s *Server) revokeShare(w http.ResponseWriter, r *http.Request, id string) {
+	ok, err := s.shares.Revoke(id)
+	if err != nil {
+		log.Printf("revoke share: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal error", "")
+		return
+	}
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Share not found", "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sharedInfo is the part of a session's info shown to share links. engine_meta and the client
+// list are left out: they describe the host (paths, environment, settings) and its users.
+func sharedInfo(sess *session.Session) map[string]any {
+	info := sess.Info()
+	out := make(map[string]any)
+	for _, k := range []string{"id", "name", "engine", "state", "created"} {
+		out[k] = info[k]
+	}
+	return out
+}
+
+// handleShared serves the read-only REST view of a shared session, authenticated by the share
+// token in the path: GET /shared/{token} returns a summary of the session (see sharedInfo) and
+// GET /shared/{token}/events its events (from_seq or last_n, like /ws/events).
+func (s *Server) handleShared(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/shared/")
+	wantEvents := strings.HasSuffix(token, "/events")
+	token = strings.TrimSuffix(token, "/events")
+	sh, ok := s.shares.Lookup(token, time.Now())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sess := s.manager.Get(sh.SessionID)
+	if sess == nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Session not found", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !wantEvents {
+		jsonEncoder(w).Encode(map[string]any{"session": sharedInfo(sess), "share": sh.info()})
+		return
+	}
+	q := r.URL.Query()
+	list := sess.ReplayEventsLastN(256)
+	if v := q.Get("from_seq"); v != "" {
+		from, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid from_seq", "")
+			return
+		}
+		list = sess.ReplayEventsFromSeq(from)
+	} else if v := q.Get("last_n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid last_n", "")
+			return
+		}
+		list = sess.ReplayEventsLastN(n)
+	}
+	if list == nil {
+		list = []events.SessionEvent{}
+	}
+	jsonEncoder(w).Encode(list)
+}
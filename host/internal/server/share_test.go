@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/gorilla/websocket"
+)
+
+func TestShareManager_LookupExpiryAndPersistence(t *testing.T) {
+	path := t.TempDir() + "/shares.json"
+	m := newShareManager(path)
+	now := time.Unix(1000, 0)
+	sh, token, err := m.Create("S1", sharePermView, time.Minute, now)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got, ok := m.Lookup(token, now); !ok || got.ID != sh.ID {
+		t.Fatalf("lookup: %+v %v", got, ok)
+	}
+	if _, ok := m.Lookup(token, now.Add(time.Minute)); ok {
+		t.Fatal("expired share still valid")
+	}
+	if _, ok := m.Lookup("nope", now); ok {
+		t.Fatal("unknown token accepted")
+	}
+
+	// Tokens are not stored, only their hashes; shares survive a reload.
+	m2 := newShareManager(path)
+	if _, ok := m2.Lookup(token, now); !ok {
+		t.Fatal("share lost on reload")
+	}
+	if ok, _ := m2.Revoke(sh.ID); !ok {
+		t.Fatal("revoke failed")
+	}
+	if _, ok := newShareManager(path).Lookup(token, now); ok {
+		t.Fatal("revoked share still valid after reload")
+	}
+}
+
+func TestShareLinks(t *testing.T) {
+	if ptmx, tty, err := pty.Open(); err != nil {
+		t.Skipf("pty unavailable: %v", err)
+	} else {
+		ptmx.Close()
+		tty.Close()
+	}
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	s.shares = newShareManager(t.TempDir() + "/shares.json")
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+	sess, err := s.manager.Create(context.Background(), "shell", "", map[string]interface{}{"shell": "sh"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.manager.Terminate(sess.ID)
+
+	do := func(method, path, body string, auth bool) *http.Response {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if auth {
+			req.Header.Set("Authorization", "Bearer t")
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return res
+	}
+
+	res := do(http.MethodPost, "/api/sessions/"+sess.ID+"/shares", `{"permission":"admin"}`, true)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad permission: status=%d", res.StatusCode)
+	}
+	res = do(http.MethodPost, "/api/sessions/"+sess.ID+"/shares", `{"permission":"view","ttl_seconds":600}`, true)
+	var created struct {
+		ID     string `json:"id"`
+		Token  string `json:"token"`
+		WSPath string `json:"ws_path"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&created)
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated || created.Token == "" {
+		t.Fatalf("create share: status=%d %+v", res.StatusCode, created)
+	}
+
+	res = do(http.MethodGet, "/api/sessions/"+sess.ID+"/shares", "", true)
+	var list []map[string]any
+	_ = json.NewDecoder(res.Body).Decode(&list)
+	res.Body.Close()
+	if len(list) != 1 || list[0]["id"] != created.ID || list[0]["token"] != nil {
+		t.Fatalf("list=%v", list)
+	}
+
+	// The token works for the read-only REST view, but not for the management API.
+	res = do(http.MethodGet, "/shared/"+created.Token, "", false)
+	var view struct {
+		Session map[string]any `json:"session"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&view)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("shared view: status=%d", res.StatusCode)
+	}
+	if view.Session["id"] != sess.ID || view.Session["state"] != "running" || len(view.Session) != 5 {
+		t.Fatalf("shared session=%v, want only id, name, engine, state and created", view.Session)
+	}
+	res = do(http.MethodGet, "/shared/"+created.Token+"/events?last_n=5", "", false)
+	var evs []events.SessionEvent
+	_ = json.NewDecoder(res.Body).Decode(&evs)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(evs) == 0 {
+		t.Fatalf("shared events: status=%d n=%d", res.StatusCode, len(evs))
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	if res, _ = http.DefaultClient.Do(req); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("share token accepted by /api: status=%d", res.StatusCode)
+	}
+	res.Body.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL+"/ws/events/other?share="+created.Token, nil); err == nil {
+		t.Fatal("share accepted for another session")
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+created.WSPath+"&screen=0", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_ = conn.WriteJSON(clientMsg{Type: "input", Data: "echo hi\n"})
+	for {
+		var ev events.SessionEvent
+		if err := conn.ReadJSON(&ev); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var p struct {
+			Code string `json:"code"`
+		}
+		_ = json.Unmarshal(ev.Payload, &p)
+		if ev.Kind == events.EventKindError && p.Code == "read_only" {
+			break
+		}
+	}
+
+	// An input link can type and ask for control, but not take it or answer approvals.
+	res = do(http.MethodPost, "/api/sessions/"+sess.ID+"/shares", `{"permission":"input"}`, true)
+	var input struct {
+		WSPath string `json:"ws_path"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&input)
+	res.Body.Close()
+	inConn, _, err := websocket.DefaultDialer.Dial(wsURL+input.WSPath+"&screen=0", nil)
+	if err != nil {
+		t.Fatalf("dial input share: %v", err)
+	}
+	defer inConn.Close()
+	_ = inConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_ = inConn.WriteJSON(clientMsg{Type: "control", Action: "take"})
+	_ = inConn.WriteJSON(clientMsg{Type: "approval", ID: "a1", Decision: "approve"})
+	for rejected := map[string]bool{}; !rejected["control"] || !rejected["approval"]; {
+		var ev events.SessionEvent
+		if err := inConn.ReadJSON(&ev); err != nil {
+			t.Fatalf("read: %v (rejected %v)", err, rejected)
+		}
+		var p struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(ev.Payload, &p)
+		if ev.Kind == events.EventKindError && (p.Message == "share links can request control but not take it" || p.Message == "approvals need the host token") {
+			rejected[p.Code] = true
+		}
+	}
+
+	// Revoking disconnects the client and invalidates the token.
+	res = do(http.MethodDelete, "/api/shares/"+created.ID, "", true)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("revoke: status=%d", res.StatusCode)
+	}
+	for {
+		var ev events.SessionEvent
+		if err := conn.ReadJSON(&ev); err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				t.Fatal("connection still open after revoke")
+			}
+			break
+		}
+	}
+	res = do(http.MethodGet, "/shared/"+created.Token, "", false)
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("revoked share view: status=%d", res.StatusCode)
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var templateNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// sessionTemplate is a named preset for POST /api/sessions: the fields of a sessionRequest that a
+// client would otherwise resend every time.
+type sessionTemplate struct {
+	Name          string                 `json:"name"`
+	Engine        string                 `json:"engine"`
+	WorkspacePath string                 `json:"workspacePath,omitempty"`
+	Mode          string                 `json:"mode,omitempty"`
+	Prompt        string                 `json:"prompt,omitempty"`
+	Args          map[string]interface{} `json:"args,omitempty"`
+}
+
+// apply returns req with the template's values filled in; fields set in req take precedence, and
+// args are merged key by key.
+func (t sessionTemplate) apply(req sessionRequest) sessionRequest {
+	if req.Engine == "" {
+		req.Engine = t.Engine
+	}
+	if req.WorkspacePath == "" && req.Workspace == "" {
+		req.WorkspacePath = t.WorkspacePath
+	}
+	if req.Mode == "" {
+		req.Mode = t.Mode
+	}
+	if req.Prompt == "" {
+		req.Prompt = t.Prompt
+	}
+	if req.Name == "" {
+		req.Name = t.Name
+	}
+	if len(t.Args) > 0 {
+		args := make(map[string]interface{}, len(t.Args)+len(req.Args))
+		for k, v := range t.Args {
+			args[k] = v
+		}
+		for k, v := range req.Args {
+			args[k] = v
+		}
+		req.Args = args
+	}
+	return req
+}
+
+// templateStore keeps session templates in a JSON file so they survive host restarts.
+type templateStore struct {
+	mu        sync.Mutex
+	path      string
+	templates map[string]sessionTemplate
+}
+
+func newTemplateStore(path string) *templateStore {
+	st := &templateStore{path: path, templates: make(map[string]sessionTemplate)}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("session templates load failed: %v", err)
+		}
+		return st
+	}
+	var list []sessionTemplate
+	if err := json.Unmarshal(b, &list); err != nil {
+		log.Printf("session templates load failed: %v", err)
+		return st
+	}
+	for _, t := range list {
+		st.templates[t.Name] = t
+	}
+	return st
+}
+
+// Get returns the template called name.
+func (st *templateStore) Get(name string) (sessionTemplate, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	t, ok := st.templates[name]
+	return t, ok
+}
+
+// List returns all templates sorted by name.
+func (st *templateStore) List() []sessionTemplate {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.listLocked()
+}
+
+func (st *templateStore) listLocked() []sessionTemplate {
+	out := make([]sessionTemplate, 0, len(st.templates))
+	for _, t := range st.templates {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Put creates or replaces a template and reports whether it was new.
+func (st *templateStore) Put(t sessionTemplate) (created bool, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	prev, existed := st.templates[t.Name]
+	st.templates[t.Name] = t
+	if err := writeJSONFile(st.path, st.listLocked()); err != nil {
+		if existed {
+			st.templates[t.Name] = prev
+		} else {
+			delete(st.templates, t.Name)
+		}
+		return false, err
+	}
+	return !existed, nil
+}
+
+// Delete removes a template and reports whether it existed.
+func (st *templateStore) Delete(name string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	t, ok := st.templates[name]
+	if !ok {
+		return false, nil
+	}
+	delete(st.templates, name)
+	if err := writeJSONFile(st.path, st.listLocked()); err != nil {
+		st.templates[name] = t
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jsonEncoder(w).Encode(s.templates.List())
+}
+
+// putTemplate creates or replaces the template named in the body (201 when new, 200 otherwise).
+func (s *Server) putTemplate(w http.ResponseWriter, r *http.Request) {
+	var t sessionTemplate
+	if err := jsonDecode(r, &t); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid JSON body", "")
+		return
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if !templateNameRe.MatchString(t.Name) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_template", "Invalid template name", "Use 1-64 letters, digits, '.', '_' or '-', starting with a letter or digit.")
+		return
+	}
+	if t.Engine == "" {
+		t.Engine = "shell"
+	}
+	if _, ok := s.manager.Engines().Get(t.Engine); !ok {
+		writeAPIError(w, http.StatusBadRequest, "invalid_engine", "Unknown engine", "Choose an engine from GET /api/engines (at minimum: shell).")
+		return
+	}
+	created, err := s.templates.Put(t)
+	if err != nil {
+		log.Printf("save template: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal error", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	jsonEncoder(w).Encode(t)
+}
+
+func (s *Server) deleteTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	ok, err := s.templates.Delete(name)
+	if err != nil {
+		log.Printf("delete template: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "Internal error", "")
+		return
+	}
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Template not found", "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
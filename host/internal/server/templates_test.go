@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateApplyOverrides(t *testing.T) {
+	tmpl := sessionTemplate{
+		Name:          "codex-x",
+		Engine:        "codex",
+		WorkspacePath: "/src/x",
+		Mode:          "auto",
+		Args:          map[string]interface{}{"model": "a", "record_input": true},
+	}
+	req := tmpl.apply(sessionRequest{Prompt: "fix it", Args: map[string]interface{}{"model": "b"}})
+	if req.Engine != "codex" || req.WorkspacePath != "/src/x" || req.Mode != "auto" || req.Prompt != "fix it" || req.Name != "codex-x" {
+		t.Fatalf("req=%+v", req)
+	}
+	if req.Args["model"] != "b" || req.Args["record_input"] != true {
+		t.Fatalf("args=%v", req.Args)
+	}
+	if tmpl.Args["model"] != "a" {
+		t.Fatal("template args modified")
+	}
+}
+
+// stopSessionsAtCleanup terminates the sessions of s when the test ends and waits until they stop
+// writing, before the test's temporary directories are removed.
+func stopSessionsAtCleanup(t *testing.T, s *Server) {
+	t.Cleanup(func() {
+		for _, sess := range s.manager.List() {
+			_ = s.manager.Terminate(sess.ID)
+			select {
+			case <-sess.Done():
+			case <-time.After(5 * time.Second):
+				t.Errorf("session %s did not stop", sess.ID)
+			}
+		}
+	})
+}
+
+func TestTemplatesAPI(t *testing.T) {
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	stopSessionsAtCleanup(t, s)
+	storePath := filepath.Join(t.TempDir(), "templates.json")
+	s.templates = newTemplateStore(storePath)
+	h := s.authMiddleware(false, http.HandlerFunc(s.handleAPI))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "http://example"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer t")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodPost, "/api/templates", `{"name":"../x","engine":"shell"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad name: status=%d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/api/templates", `{"name":"x","engine":"nope"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad engine: status=%d", rr.Code)
+	}
+	job := `{"name":"ok-job","engine":"exec","args":{"command":"echo ok","timeout_seconds":5}}`
+	if rr := do(http.MethodPost, "/api/templates", job); rr.Code != http.StatusCreated {
+		t.Fatalf("create: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "/api/templates", job); rr.Code != http.StatusOK {
+		t.Fatalf("replace: status=%d", rr.Code)
+	}
+	if _, ok := newTemplateStore(storePath).Get("ok-job"); !ok {
+		t.Fatal("template not persisted")
+	}
+
+	rr := do(http.MethodGet, "/api/templates", "")
+	var list []sessionTemplate
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Engine != "exec" {
+		t.Fatalf("list=%+v", list)
+	}
+
+	if rr := do(http.MethodPost, "/api/sessions", `{"template":"missing"}`); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "unknown_template") {
+		t.Fatalf("unknown template: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = do(http.MethodPost, "/api/sessions", `{"template":"ok-job","name":"override","args":{"command":"echo other"}}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create from template: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var info struct {
+		Engine     string         `json:"engine"`
+		Name       string         `json:"name"`
+		EngineMeta map[string]any `json:"engine_meta"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.Engine != "exec" || info.Name != "override" || info.EngineMeta["command"] != "echo other" || info.EngineMeta["timeout_seconds"] != 5.0 {
+		t.Fatalf("info=%+v", info)
+	}
+
+	if rr := do(http.MethodDelete, "/api/templates/ok-job", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: status=%d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/api/templates/ok-job", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("delete again: status=%d", rr.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/session"
+)
+
+// fakeUsageCodex puts a codex on PATH that answers every turn with one token usage report:
+// 120 input tokens (30 cached) and 80 output tokens (20 reasoning), 200 in total.
+func fakeUsageCodex(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	script := `#!/bin/sh
+while read -r line; do
+  id=$(printf '%s' "$line" | sed -n 's/^{"id":\([0-9]*\),.*/\1/p')
+  case "$line" in
+    *'"initialize"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{}}' ;;
+    *'"thread/start"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"thread":{"id":"th-1"}}}' ;;
+    *'"turn/start"'*)
+      echo '{"jsonrpc":"2.0","id":'$id',"result":{"turn":{"id":"turn-1"}}}'
+      echo '{"jsonrpc":"2.0","method":"thread/tokenUsage/updated","params":{"threadId":"th-1","turnId":"turn-1","tokenUsage":{"total":{"totalTokens":200},"last":{"totalTokens":200,"inputTokens":120,"cachedInputTokens":30,"outputTokens":80,"reasoningOutputTokens":20}}}}'
+      echo '{"jsonrpc":"2.0","method":"turn/completed","params":{"threadId":"th-1","turn":{"id":"turn-1"}}}'
+      ;;
+  esac
+done
+`
+	if err := os.WriteFile(filepath.Join(bin, "codex"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestGetUsage(t *testing.T) {
+	fakeUsageCodex(t)
+	stateDir := t.TempDir()
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: stateDir, LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	h := s.authMiddleware(false, http.HandlerFunc(s.handleAPI))
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example"+path, nil)
+		req.Header.Set("Authorization", "Bearer t")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	want := session.Usage{InputTokens: 120, CachedInputTokens: 30, OutputTokens: 80, ReasoningOutputTokens: 20, TotalTokens: 200}
+
+	sess, err := s.manager.Create(context.Background(), "codex", "", map[string]interface{}{"prompt": "hi"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.manager.Terminate(sess.ID)
+	deadline := time.Now().Add(5 * time.Second)
+	for sess.Info()["usage"] != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("session usage=%v want %+v", sess.Info()["usage"], want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var report session.UsageReport
+	rr := get("/api/usage?days=1")
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); rr.Code != http.StatusOK || err != nil {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	today := time.Now().Format(time.DateOnly)
+	if len(report.Days) != 1 || report.Days[0].Date != today || report.Days[0].Total != want || report.Days[0].Engines["codex"] != want {
+		t.Fatalf("days=%+v", report.Days)
+	}
+	if report.Total != want || report.Engines["codex"] != want {
+		t.Fatalf("total=%+v engines=%+v", report.Total, report.Engines)
+	}
+	for _, q := range []string{"days=0", "days=x", "days=401"} {
+		if rr := get("/api/usage?" + q); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d", q, rr.Code)
+		}
+	}
+	if rr := get("/api/usage?days=400"); rr.Code != http.StatusOK {
+		t.Fatalf("days=400: status=%d", rr.Code)
+	}
+
+	// Ledger writes are batched; FlushUsage saves them right away.
+	ledger := filepath.Join(stateDir, "sessions", "usage.json")
+	if _, err := os.Stat(ledger); !os.IsNotExist(err) {
+		t.Fatalf("ledger saved before the batch delay: %v", err)
+	}
+	s.manager.FlushUsage()
+	b, err := os.ReadFile(ledger)
+	if err != nil {
+		t.Fatalf("ledger not saved: %v", err)
+	}
+	var saved struct {
+		Days map[string]map[string]session.Usage `json:"days"`
+	}
+	if err := json.Unmarshal(b, &saved); err != nil || saved.Days[today]["codex"] != want {
+		t.Fatalf("saved ledger=%s err=%v", b, err)
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkspaceRoots(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	if err := os.Mkdir(filepath.Join(root, "repo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir(), WorkspaceRoots: []string{root}})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	h := s.authMiddleware(false, http.HandlerFunc(s.handleAPI))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "http://example"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer t")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodGet, "/api/workspaces", "")
+	var list struct {
+		Restricted bool                `json:"restricted"`
+		Roots      []map[string]string `json:"roots"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if !list.Restricted || len(list.Roots) != 1 || list.Roots[0]["path"] != root {
+		t.Fatalf("workspaces=%s", rr.Body.String())
+	}
+
+	rr = do(http.MethodPost, "/api/jobs", `{"command":"true","workspacePath":"`+root+`/repo/../.."`+`}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_workspace") || !strings.Contains(rr.Body.String(), "allowed workspace roots") {
+		t.Fatalf("outside root: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// Jobs without a workspace run in the first root, not the daemon's cwd.
+	rr = do(http.MethodPost, "/api/jobs", `{"command":"pwd"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var info struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &info)
+	sess := s.manager.Get(info.ID)
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.TrimSpace(string(sess.Replay(0))) != root {
+		if time.Now().After(deadline) {
+			t.Fatalf("pwd=%q want %q", sess.Replay(0), root)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Extra codex writable roots are held to the workspace roots too.
+	rr = do(http.MethodPost, "/api/sessions", `{"engine":"codex","args":{"writable_roots":["`+root+`/repo","/"]}}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_workspace") {
+		t.Fatalf("writable root outside roots: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if _, err := New(Config{Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir(), WorkspaceRoots: []string{filepath.Join(root, "missing")}}); err == nil {
+		t.Fatal("missing workspace root accepted")
+	}
+}
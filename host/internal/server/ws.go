@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -19,14 +20,26 @@ func websocketUpgrader() websocket.Upgrader {
 	return upgrader
 }
 
-// WS protocol: client sends input, resize, ping; server sends output, replay, status, pong.
+// WS protocol: client sends input, resize, ping, control; server sends output, replay, status,
+// pong, error.
 
 type clientMsg struct {
-	Type string `json:"type"`
-	Data string `json:"data"`
-	Cols int    `json:"cols"`
-	Rows int    `json:"rows"`
-	TS   int64  `json:"ts"`
+	Type   string `json:"type"`
+	Data   string `json:"data"`
+	Cols   int    `json:"cols"`
+	Rows   int    `json:"rows"`
+	TS     int64  `json:"ts"`
+	Action string `json:"action,omitempty"` // control: "request", "take", "release" or "grant"
+	To     string `json:"to,omitempty"`     // control grant: client ID receiving control
+	// approval: the approval_id being answered and the decision ("approve", "approve_session",
+	// "deny" or "cancel").
+	ID       string `json:"id,omitempty"`
+	Decision string `json:"decision,omitempty"`
+	// input (structured sessions): model settings for this message and the following ones.
+	Model  string `json:"model,omitempty"`
+	Effort string `json:"effort,omitempty"`
+	// input (structured sessions): ids of uploaded attachments sent with the message.
+	Attachments []string `json:"attachments,omitempty"`
 }
 
 type serverMsg struct {
@@ -38,14 +51,35 @@ type serverMsg struct {
 	TS     int64  `json:"ts,omitempty"`
 }
 
-func runSessionWS(ctx context.Context, conn *websocket.Conn, sess *session.Session) {
+// handleControl applies a control message from client id and returns an error message for the
+// client, or "" on success.
+func handleControl(sess *session.Session, id string, c clientMsg) string {
+	var err error
+	switch c.Action {
+	case "request", "take":
+		_, err = sess.RequestControl(id, c.Action == "take")
+	case "release":
+		err = sess.ReleaseControl(id)
+	case "grant":
+		err = sess.GrantControl(id, c.To)
+	default:
+		return "unknown control action: " + c.Action
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func runSessionWS(ctx context.Context, conn *websocket.Conn, sess *session.Session, clientName string) {
 	_ = conn.SetReadDeadline(time.Now().Add(90 * time.Second))
 	conn.SetPongHandler(func(string) error {
 		_ = conn.SetReadDeadline(time.Now().Add(90 * time.Second))
 		return nil
 	})
-	// Send replay first
-	replay := sess.Replay(64 * 1024)
+	// Send replay first: the rendered screen for PTY sessions, otherwise the raw output tail.
+	ch, replay := sess.SubscribeWithReplay(64 * 1024)
+	defer sess.Unsubscribe(ch)
 	if len(replay) > 0 {
 		conn.WriteJSON(serverMsg{Type: "replay", Data: string(replay)})
 	}
@@ -58,13 +92,22 @@ func runSessionWS(ctx context.Context, conn *websocket.Conn, sess *session.Sessi
 		return
 	}
 
-	ch := sess.Subscribe()
-	defer sess.Unsubscribe(ch)
+	clientID := sess.AttachClient(clientName, false)
+	defer sess.DetachClient(clientID)
 
 	// Ping ticker
 	pingTicker := time.NewTicker(30 * time.Second)
 	defer pingTicker.Stop()
 
+	// Replies to this client only; written by the loop below so writes never race.
+	direct := make(chan serverMsg, 8)
+	reply := func(m serverMsg) {
+		select {
+		case direct <- m:
+		default:
+		}
+	}
+
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
@@ -79,11 +122,21 @@ func runSessionWS(ctx context.Context, conn *websocket.Conn, sess *session.Sessi
 			}
 			switch c.Type {
 			case "input":
-				sess.WriteInput([]byte(c.Data))
+				if err := sess.WriteInputFrom(clientID, []byte(c.Data)); errors.Is(err, session.ErrNotController) {
+					reply(serverMsg{Type: "error", Data: err.Error()})
+				}
 			case "resize":
 				sess.Resize(c.Cols, c.Rows)
 			case "ping":
-				conn.WriteJSON(serverMsg{Type: "pong", TS: c.TS})
+				reply(serverMsg{Type: "pong", TS: c.TS})
+			case "control":
+				if msg := handleControl(sess, clientID, c); msg != "" {
+					reply(serverMsg{Type: "error", Data: msg})
+				}
+			case "interrupt":
+				if err := sess.InterruptFrom(clientID); err != nil {
+					reply(serverMsg{Type: "error", Data: err.Error()})
+				}
 			}
 		}
 	}()
@@ -104,6 +157,10 @@ func runSessionWS(ctx context.Context, conn *websocket.Conn, sess *session.Sessi
 				log.Printf("ws write: %v", err)
 				return
 			}
+		case m := <-direct:
+			if err := conn.WriteJSON(m); err != nil {
+				return
+			}
 		case <-pingTicker.C:
 			if err := conn.WriteJSON(serverMsg{Type: "pong", TS: time.Now().UnixMilli()}); err != nil {
 				return
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -43,10 +44,45 @@ func (s *Server) handleWSEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer conn.Close()
-	runSessionWSEvents(r.Context(), conn, sess, r.RemoteAddr, r.URL.Query().Get("from_seq"), r.URL.Query().Get("last_n"))
+	q := r.URL.Query()
+	opts := eventsStreamOptions{
+		FromSeq:    q.Get("from_seq"),
+		LastN:      q.Get("last_n"),
+		Screen:     q.Get("screen") != "0",
+		ClientName: q.Get("name"),
+	}
+	ctx := r.Context()
+	if sh, ok := shareFromContext(ctx); ok {
+		// Share clients are disconnected when the share expires or is revoked.
+		opts.ReadOnly = sh.Permission != sharePermInput
+		opts.Shared = true
+		if opts.ClientName == "" {
+			opts.ClientName = "share " + sh.ID
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(sh.ExpiresMS))
+		defer cancel()
+		defer s.shares.Track(sh.ID, cancel)()
+	}
+	runSessionWSEvents(ctx, conn, sess, r.RemoteAddr, opts)
+}
+
+// eventsStreamOptions are the per-connection settings of /ws/events, from its query parameters.
+type eventsStreamOptions struct {
+	FromSeq    string // from_seq: resume after this seq
+	LastN      string // last_n: replay this many events
+	Screen     bool   // send a screen snapshot first (screen=0 disables it)
+	ClientName string // name: label of the attached client
+	ReadOnly   bool   // the client may never send input (view-only share links)
+	Shared     bool   // connected with a share link: may not take control or answer approvals
 }
 
-func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session.Session, remoteAddr string, fromSeqRaw string, lastNRaw string) {
+// runSessionWSEvents streams sess's events to conn. Unless the client resumes with from_seq,
+// PTY sessions start with a screen event (when opts.Screen is set) and the replay omits the
+// terminal output it already contains. The connection is attached as a client; see
+// Session.AttachClient for the controller/viewer model.
+func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session.Session, remoteAddr string, opts eventsStreamOptions) {
+	fromSeqRaw, lastNRaw := opts.FromSeq, opts.LastN
 	debug := os.Getenv("RC_DEBUG_WS") == "1"
 	started := time.Now()
 	// Keepalive: proxies (including Serve) may drop idle WS connections.
@@ -70,6 +106,29 @@ func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session
 		}
 	}
 
+	// Subscribe before reading the replay so nothing published in between is lost; live events
+	// already covered by the replay (or the screen) are skipped by seq.
+	eventsCh := sess.SubscribeEvents()
+	defer sess.UnsubscribeEvents(eventsCh)
+
+	var screenSeq, lastSent uint64
+	hasScreen := false
+	if opts.Screen && fromSeqRaw == "" {
+		if snap, cols, rows, seq, ok := sess.ScreenSnapshot(); ok {
+			hasScreen = true
+			screenSeq, lastSent = seq, seq
+			payload, _ := events.MarshalPayload(map[string]any{"data": string(snap), "cols": cols, "rows": rows})
+			_ = conn.WriteJSON(events.SessionEvent{
+				SessionID: sess.ID,
+				Engine:    sess.Engine,
+				TsMS:      events.NowMS(),
+				Seq:       seq,
+				Kind:      events.EventKindScreen,
+				Payload:   payload,
+			})
+		}
+	}
+
 	var replay []events.SessionEvent
 	if fromSeqRaw != "" {
 		replay = sess.ReplayEventsFromSeq(fromSeq)
@@ -79,7 +138,13 @@ func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session
 		replay = sess.ReplayEventsLastN(256)
 	}
 	for _, ev := range replay {
+		if hasScreen && (ev.Seq > screenSeq || isTerminalOutput(ev)) {
+			continue
+		}
 		_ = conn.WriteJSON(ev)
+		if ev.Seq > lastSent {
+			lastSent = ev.Seq
+		}
 	}
 
 	state, code := sess.State()
@@ -91,10 +156,23 @@ func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session
 		return
 	}
 
-	eventsCh := sess.SubscribeEvents()
-	defer sess.UnsubscribeEvents(eventsCh)
-
 	_, _ = sess.PublishEvent(events.EventKindStatus, map[string]any{"state": "attached"})
+	clientID := sess.AttachClient(opts.ClientName, opts.ReadOnly)
+	defer sess.DetachClient(clientID)
+
+	// Events for this client only (not published, seq 0); written by the loop below so writes
+	// never race. The first one tells the client its ID.
+	direct := make(chan events.SessionEvent, 8)
+	reply := func(kind events.EventKind, payload map[string]any) {
+		raw, _ := events.MarshalPayload(payload)
+		select {
+		case direct <- events.SessionEvent{SessionID: sess.ID, Engine: sess.Engine, TsMS: events.NowMS(), Kind: kind, Payload: raw}:
+		default:
+		}
+	}
+	welcome := sess.ControlPayload("welcome", clientID)
+	welcome["you"] = clientID
+	reply(events.EventKindStatus, welcome)
 
 	if debug {
 		log.Printf("ws/events connected: session=%s remote=%s replay=%d from_seq=%s last_n=%d", sess.ID, remoteAddr, len(replay), fromSeqRaw, lastN)
@@ -106,6 +184,7 @@ func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
+		var lastRejected time.Time
 		for {
 			_, msg, err := conn.ReadMessage()
 			if err != nil {
@@ -120,14 +199,57 @@ func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session
 				if debug {
 					log.Printf("ws/events input: session=%s bytes=%d", sess.ID, len(c.Data))
 				}
-				_ = sess.WriteInput([]byte(c.Data))
+				var err error
+				if c.Model != "" || c.Effort != "" || len(c.Attachments) > 0 {
+					err = sess.WriteTurnFrom(clientID, []byte(c.Data), session.TurnOptions{Model: c.Model, Effort: c.Effort, Attachments: c.Attachments})
+				} else {
+					err = sess.WriteInputFrom(clientID, []byte(c.Data))
+				}
+				// Viewers typing would otherwise get an error per keystroke.
+				if err != nil && time.Since(lastRejected) > time.Second {
+					code := ""
+					switch {
+					case errors.Is(err, session.ErrNotController):
+						code = "not_controller"
+					case errors.Is(err, session.ErrReadOnlyClient):
+						code = "read_only"
+					case errors.Is(err, session.ErrInvalidArgs):
+						code = "invalid_args"
+					}
+					if code != "" {
+						lastRejected = time.Now()
+						reply(events.EventKindError, map[string]any{"message": err.Error(), "code": code})
+					}
+				}
 			case "resize":
 				if debug {
 					log.Printf("ws/events resize: session=%s cols=%d rows=%d", sess.ID, c.Cols, c.Rows)
 				}
-				_ = sess.Resize(c.Cols, c.Rows)
+				if !opts.ReadOnly {
+					_ = sess.Resize(c.Cols, c.Rows)
+				}
 			case "ping":
 				_ = c.TS
+			case "control":
+				if opts.Shared && c.Action == "take" {
+					reply(events.EventKindError, map[string]any{"message": "share links can request control but not take it", "code": "control"})
+					continue
+				}
+				if msg := handleControl(sess, clientID, c); msg != "" {
+					reply(events.EventKindError, map[string]any{"message": msg, "code": "control"})
+				}
+			case "interrupt":
+				if err := sess.InterruptFrom(clientID); err != nil {
+					reply(events.EventKindError, map[string]any{"message": err.Error(), "code": "interrupt"})
+				}
+			case "approval":
+				if opts.Shared {
+					reply(events.EventKindError, map[string]any{"message": "approvals need the host token", "code": "approval", "approval_id": c.ID})
+					continue
+				}
+				if err := sess.ApproveFrom(clientID, c.ID, c.Decision); err != nil {
+					reply(events.EventKindError, map[string]any{"message": err.Error(), "code": "approval", "approval_id": c.ID})
+				}
 			}
 		}
 	}()
@@ -145,6 +267,8 @@ func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session
 				log.Printf("ws/events disconnected: session=%s remote=%s reason=client duration=%s sent=%d", sess.ID, remoteAddr, time.Since(started).Truncate(time.Millisecond), sent)
 			}
 			return
+		case ev := <-direct:
+			_ = conn.WriteJSON(ev)
 		case <-pingTicker.C:
 			_ = conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(2*time.Second))
 		case ev, ok := <-eventsCh:
@@ -154,8 +278,24 @@ func runSessionWSEvents(ctx context.Context, conn *websocket.Conn, sess *session
 				}
 				return
 			}
+			// Seq 0 events are live-only (e.g. clients attaching) and never part of a replay.
+			if ev.Seq != 0 && ev.Seq <= lastSent {
+				continue
+			}
 			sent++
 			_ = conn.WriteJSON(ev)
 		}
 	}
 }
+
+// isTerminalOutput reports whether ev is raw PTY output (see Session.emitPTYOutput).
+func isTerminalOutput(ev events.SessionEvent) bool {
+	if ev.Kind != events.EventKindAssistant {
+		return false
+	}
+	var p struct {
+		Stream string `json:"stream"`
+	}
+	_ = json.Unmarshal(ev.Payload, &p)
+	return p.Stream == "stdout"
+}
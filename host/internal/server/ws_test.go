@@ -1,8 +1,17 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/gorilla/websocket"
 )
 
 func TestServerMsgJSON(t *testing.T) {
@@ -34,3 +43,151 @@ func TestClientMsgJSON(t *testing.T) {
 		t.Errorf("roundtrip: %+v", out)
 	}
 }
+
+func TestWSEventsStartsWithScreen(t *testing.T) {
+	if ptmx, tty, err := pty.Open(); err != nil {
+		t.Skipf("pty unavailable: %v", err)
+	} else {
+		ptmx.Close()
+		tty.Close()
+	}
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+
+	sess, err := s.manager.Create(context.Background(), "shell", "", map[string]interface{}{
+		"shell":   "sh",
+		"command": "printf 'screen-%s\\n' ok",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.manager.Terminate(sess.ID)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(sess.Replay(0)), "screen-ok") {
+		if time.Now().After(deadline) {
+			t.Fatalf("output=%q", sess.Replay(0))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	dial := func(query string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/events/" + sess.ID + query
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer t"}})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+
+	conn := dial("")
+	var ev events.SessionEvent
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	conn.Close()
+	var payload struct {
+		Data string `json:"data"`
+		Cols int    `json:"cols"`
+		Rows int    `json:"rows"`
+	}
+	_ = json.Unmarshal(ev.Payload, &payload)
+	if ev.Kind != events.EventKindScreen || !strings.Contains(payload.Data, "screen-ok") || payload.Cols != 80 || payload.Rows != 24 {
+		t.Fatalf("first event=%+v payload=%+v", ev, payload)
+	}
+	if ev.Seq == 0 {
+		t.Fatalf("screen event has no seq")
+	}
+
+	conn = dial("?screen=0")
+	defer conn.Close()
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if ev.Kind == events.EventKindScreen {
+		t.Fatalf("screen=0 still sent a screen event")
+	}
+}
+
+func TestWSEventsViewerInputRejected(t *testing.T) {
+	if ptmx, tty, err := pty.Open(); err != nil {
+		t.Skipf("pty unavailable: %v", err)
+	} else {
+		ptmx.Close()
+		tty.Close()
+	}
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t", StateDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+	sess, err := s.manager.Create(context.Background(), "shell", "", map[string]interface{}{"shell": "sh"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.manager.Terminate(sess.ID)
+
+	type welcome struct {
+		State      string `json:"state"`
+		You        string `json:"you"`
+		Controller string `json:"controller"`
+		Code       string `json:"code"`
+	}
+	// attach dials a client and reads until its welcome message.
+	attach := func(name string) (*websocket.Conn, welcome) {
+		url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/events/" + sess.ID + "?screen=0&name=" + name
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer t"}})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var ev events.SessionEvent
+			if err := conn.ReadJSON(&ev); err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			var w welcome
+			_ = json.Unmarshal(ev.Payload, &w)
+			if w.You != "" {
+				return conn, w
+			}
+		}
+	}
+	desk, dw := attach("desktop")
+	defer desk.Close()
+	phone, pw := attach("phone")
+	defer phone.Close()
+	if dw.Controller != dw.You || pw.Controller != dw.You {
+		t.Fatalf("desktop=%+v phone=%+v: first client should control", dw, pw)
+	}
+
+	_ = phone.WriteJSON(clientMsg{Type: "input", Data: "echo hi\n"})
+	for {
+		var ev events.SessionEvent
+		if err := phone.ReadJSON(&ev); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var p welcome
+		_ = json.Unmarshal(ev.Payload, &p)
+		if ev.Kind == events.EventKindError && p.Code == "not_controller" {
+			break
+		}
+	}
+
+	_ = phone.WriteJSON(clientMsg{Type: "control", Action: "take"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, controller := sess.Clients(); controller == pw.You {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("take did not transfer control")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -40,7 +40,7 @@ func TestWSTicketManager_SingleUseAndExpiry(t *testing.T) {
 }
 
 func TestAPI_IssueWSTicket_RequiresAuthAndWorks(t *testing.T) {
-	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t0k", LogDir: t.TempDir()})
+	s, err := New(Config{Bind: "127.0.0.1", Port: "0", Token: "t0k", StateDir: t.TempDir(), LogDir: t.TempDir()})
 	if err != nil {
 		t.Fatal(err)
 	}
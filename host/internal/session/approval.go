@@ -0,0 +1,54 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Answers to an approval request.
+const (
+	DecisionApprove        = "approve"         // allow this action
+	DecisionApproveSession = "approve_session" // allow it and similar actions for the rest of the session
+	DecisionDeny           = "deny"            // refuse; the agent continues without it
+	DecisionCancel         = "cancel"          // refuse and end the agent's turn
+)
+
+// ErrUnknownApproval is returned when answering an approval that is not pending.
+var ErrUnknownApproval = errors.New("no pending approval with that id")
+
+func validDecision(d string) bool {
+	switch d {
+	case DecisionApprove, DecisionApproveSession, DecisionDeny, DecisionCancel:
+		return true
+	}
+	return false
+}
+
+// Approve answers the pending approval request id (see events.EventKindApproval) with decision.
+func (s *Session) Approve(id, decision string) error {
+	if !validDecision(decision) {
+		return fmt.Errorf("%w: unknown decision %q", ErrInvalidArgs, decision)
+	}
+	s.mu.RLock()
+	closed := s.closed
+	proc := s.proc
+	s.mu.RUnlock()
+	if closed || proc == nil {
+		return io.ErrClosedPipe
+	}
+	a, ok := proc.(Approver)
+	if !ok {
+		return ErrUnsupported
+	}
+	return a.Approve(id, decision)
+}
+
+// ApproveFrom is Approve on behalf of an attached client; like input, only the controller may
+// answer.
+func (s *Session) ApproveFrom(clientID, id, decision string) error {
+	if err := s.claimInput(clientID); err != nil {
+		return err
+	}
+	return s.Approve(id, decision)
+}
@@ -0,0 +1,194 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Default limits on uploaded attachments.
+const (
+	DefaultAttachmentMaxBytes int64 = 20 << 20  // per file
+	DefaultAttachmentQuota    int64 = 100 << 20 // per session
+)
+
+// ErrAttachmentTooLarge is returned when an upload exceeds the per-file limit or the session's
+// quota.
+var ErrAttachmentTooLarge = errors.New("attachment too large")
+
+// Attachment is a file uploaded to a session for use in its messages.
+type Attachment struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	path        string // absolute path on the host
+}
+
+// IsImage reports whether the attachment is an image, which agents can look at rather than
+// read as a file.
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
+
+// attachmentLimits bound the uploads of one session.
+type attachmentLimits struct {
+	maxBytes int64 // per file
+	quota    int64 // all files of the session
+}
+
+// attachments are the uploads of a session, stored in their own directory under the host's
+// state directory. The directory is removed when the session exits or is terminated.
+type attachments struct {
+	root   string // the directory to use, set from the manager
+	limits attachmentLimits
+
+	mu   sync.Mutex
+	dir  string // absolute root, once the engine accepts attachments
+	list []Attachment
+	used int64
+}
+
+// enableAttachments creates the session's attachment directory; engines whose messages can
+// reference attachments call it before starting their processes, so sandboxes can expose it.
+func (s *Session) enableAttachments() error {
+	a := &s.attach
+	if a.root == "" {
+		return nil
+	}
+	dir, err := filepath.Abs(a.root)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("attachments: %w", err)
+	}
+	a.mu.Lock()
+	a.dir = dir
+	a.mu.Unlock()
+	if s.sandbox != nil {
+		s.sandbox.ReadOnly = append(s.sandbox.ReadOnly, dir)
+	}
+	return nil
+}
+
+// AddAttachment stores the contents of r as an attachment called name. It fails with
+// ErrAttachmentTooLarge past the size limits, and with ErrInvalidArgs for engines whose messages
+// cannot reference attachments.
+func (s *Session) AddAttachment(name string, r io.Reader) (Attachment, error) {
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		return Attachment{}, io.ErrClosedPipe
+	}
+	a := &s.attach
+	a.mu.Lock()
+	dir := a.dir
+	a.mu.Unlock()
+	if dir == "" {
+		return Attachment{}, fmt.Errorf("%w: the %s engine does not take attachments", ErrInvalidArgs, s.Engine)
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		name = "attachment"
+	}
+
+	f, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return Attachment{}, err
+	}
+	size, err := io.Copy(f, io.LimitReader(r, a.limits.maxBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size > a.limits.maxBytes {
+		err = fmt.Errorf("%w: the limit is %d bytes per file", ErrAttachmentTooLarge, a.limits.maxBytes)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return Attachment{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.used+size > a.limits.quota {
+		os.Remove(f.Name())
+		return Attachment{}, fmt.Errorf("%w: the session's attachments may use at most %d bytes", ErrAttachmentTooLarge, a.limits.quota)
+	}
+	n := len(a.list) + 1
+	att := Attachment{
+		ID:          fmt.Sprintf("att%d", n),
+		Name:        name,
+		Size:        size,
+		ContentType: sniffContentType(f.Name()),
+		path:        filepath.Join(dir, fmt.Sprintf("%d-%s", n, name)),
+	}
+	if err := os.Rename(f.Name(), att.path); err != nil {
+		os.Remove(f.Name())
+		return Attachment{}, err
+	}
+	a.list = append(a.list, att)
+	a.used += size
+	return att, nil
+}
+
+// Attachments lists the session's attachments in upload order.
+func (s *Session) Attachments() []Attachment {
+	a := &s.attach
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Attachment{}, a.list...)
+}
+
+// lookupAttachments returns the attachments with the given ids.
+func (s *Session) lookupAttachments(ids []string) ([]Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	a := &s.attach
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]Attachment, 0, len(ids))
+	for _, id := range ids {
+		found := false
+		for _, att := range a.list {
+			if att.ID == id {
+				out = append(out, att)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: unknown attachment %q", ErrInvalidArgs, id)
+		}
+	}
+	return out, nil
+}
+
+// sniffContentType detects the type of the file at path from its first bytes.
+func sniffContentType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
+
+// attachmentText lists attachments by path for engines that take them as plain text.
+func attachmentText(atts []Attachment) string {
+	var b strings.Builder
+	b.WriteString("Attached files:")
+	for _, a := range atts {
+		fmt.Fprintf(&b, "\n- %s (%s)", a.path, a.ContentType)
+	}
+	return b.String()
+}
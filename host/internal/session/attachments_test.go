@@ -0,0 +1,178 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+// pngHeader is enough of a PNG for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// stopSession terminates s through m and waits until it has stopped writing files.
+func stopSession(t *testing.T, m *Manager, s *Session) {
+	t.Helper()
+	_ = m.Terminate(s.ID)
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Errorf("session %s did not stop", s.ID)
+	}
+}
+
+func TestCodexAttachments(t *testing.T) {
+	logPath := fakeCodex(t)
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	m := NewManager(t.TempDir(), 8, eventsDir)
+	m.SetAttachmentLimits(64, 80)
+	s, err := m.Create(context.Background(), "codex", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer stopSession(t, m, s)
+
+	img, err := s.AddAttachment("../shot.png", bytes.NewReader(pngHeader))
+	if err != nil {
+		t.Fatalf("add image: %v", err)
+	}
+	if img.ID != "att1" || img.Name != "shot.png" || img.ContentType != "image/png" || !img.IsImage() {
+		t.Fatalf("image=%+v", img)
+	}
+	doc, err := s.AddAttachment("notes.txt", strings.NewReader("some notes"))
+	if err != nil {
+		t.Fatalf("add text: %v", err)
+	}
+	if _, err := s.AddAttachment("big.bin", bytes.NewReader(make([]byte, 65))); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("file over the limit: err=%v", err)
+	}
+	if _, err := s.AddAttachment("more.bin", bytes.NewReader(make([]byte, 64))); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("upload over the quota: err=%v", err)
+	}
+	if got := s.Attachments(); len(got) != 2 || got[0].ID != "att1" || got[1].ID != "att2" {
+		t.Fatalf("attachments=%+v", got)
+	}
+
+	if err := s.WriteTurn([]byte("look"), TurnOptions{Attachments: []string{"att3"}}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("unknown attachment: err=%v", err)
+	}
+	if err := s.WriteTurn([]byte("look"), TurnOptions{Attachments: []string{img.ID, doc.ID}}); err != nil {
+		t.Fatalf("write turn: %v", err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, "echo: look")
+	user := waitEvent(t, s, events.EventKindUser, "shot.png")
+	if atts, _ := user["attachments"].([]any); len(atts) != 2 {
+		t.Fatalf("user event=%v", user)
+	}
+
+	dir, _ := filepath.Abs(m.attachmentDir(s.ID))
+	b, _ := os.ReadFile(logPath)
+	if want := `{"type":"localImage","path":"` + filepath.Join(dir, "1-shot.png") + `"}`; !strings.Contains(string(b), want) {
+		t.Fatalf("turn/start did not carry the image:\n%s", b)
+	}
+	if want := `Attached files:\n- ` + filepath.Join(dir, "2-notes.txt") + ` (text/plain; charset=utf-8)`; !strings.Contains(string(b), want) {
+		t.Fatalf("turn/start did not list the file:\n%s", b)
+	}
+
+	stopSession(t, m, s)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("attachments kept after terminate: %v", err)
+	}
+	if _, err := s.AddAttachment("late.txt", strings.NewReader("x")); err == nil {
+		t.Fatal("upload to a terminated session succeeded")
+	}
+}
+
+func TestCursorAttachments(t *testing.T) {
+	argsLog := fakeCursorAgent(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "cursor", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer stopSession(t, m, s)
+
+	att, err := s.AddAttachment("shot.png", bytes.NewReader(pngHeader))
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := s.WriteTurn([]byte("hi"), TurnOptions{Model: "gpt-a"}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("model per message: err=%v", err)
+	}
+	if err := s.WriteTurn([]byte("what is this"), TurnOptions{Attachments: []string{att.ID}}); err != nil {
+		t.Fatalf("write turn: %v", err)
+	}
+	waitEvent(t, s, events.EventKindUser, "shot.png")
+	dir, _ := filepath.Abs(m.attachmentDir(s.ID))
+	want := "what is this\n\nAttached files:\n- " + filepath.Join(dir, "1-shot.png") + " (image/png)"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := os.ReadFile(argsLog)
+		if strings.Contains(string(b), want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message did not list the attachment:\n%s", b)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAttachmentsUnsupported(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "shell", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer stopSession(t, m, s)
+	if _, err := s.AddAttachment("a.txt", strings.NewReader("x")); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("shell attachment: err=%v", err)
+	}
+}
+
+func TestAttachmentsRemovedWhenSessionEnds(t *testing.T) {
+	fakeCodex(t)
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	m := NewManager(t.TempDir(), 8, eventsDir)
+	s, err := m.Create(context.Background(), "codex", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := s.AddAttachment("notes.txt", strings.NewReader("some notes")); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	dir := m.attachmentDir(s.ID)
+
+	// The process ends without the session being terminated through the manager.
+	_ = s.Terminate()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not exit")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("attachments kept after the session exited")
+	}
+
+	// Uploads of sessions the registry no longer lists as running are removed on restore.
+	stale := m.attachmentDir("01STALESESSION")
+	if err := os.MkdirAll(stale, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stale, "1-a.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m2 := NewManager(t.TempDir(), 8, eventsDir)
+	if err := m2.Restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale attachments kept after restore: %v", err)
+	}
+}
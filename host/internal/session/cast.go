@@ -0,0 +1,177 @@
+package session
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// castRecorder writes a session recording in asciicast v2 format
+// (https://docs.asciinema.org/manual/asciicast/v2/): a JSON header line followed by one
+// [time, code, data] line per output ("o"), input ("i") or resize ("r") event.
+//
+// The header is written lazily so that a resize received before any output (clients resize on
+// connect) sets the recording's initial size instead of producing an "r" event.
+//
+// A recording cannot be rotated like the log without breaking it, so with a size limit it stops
+// at the limit instead, ending with a marker ("m") event.
+type castRecorder struct {
+	mu          sync.Mutex
+	f           *os.File
+	start       time.Time
+	width       int
+	height      int
+	title       string
+	wroteHeader bool
+	recordInput bool
+	maxBytes    int64 // 0 records without limit
+	size        int64
+	truncated   bool
+	// partial holds the trailing bytes of an output chunk that end mid UTF-8 sequence.
+	partial []byte
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// openCastRecorder opens path for recording at most maxBytes (0 for no limit). Times are relative
+// to start. When the file already has content (a reattached session), events are appended after
+// the existing header.
+func openCastRecorder(path string, start time.Time, title string, maxBytes int64) (*castRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r := &castRecorder{f: f, start: start, width: 80, height: 24, title: title, maxBytes: maxBytes}
+	if st, err := f.Stat(); err == nil && st.Size() > 0 {
+		r.wroteHeader = true
+		r.size = st.Size()
+		r.truncated = maxBytes > 0 && r.size >= maxBytes
+	}
+	return r, nil
+}
+
+func (r *castRecorder) output(b []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.partial) > 0 {
+		b = append(r.partial, b...)
+		r.partial = nil
+	}
+	if n := incompleteUTF8Suffix(b); n > 0 {
+		r.partial = append([]byte(nil), b[len(b)-n:]...)
+		b = b[:len(b)-n]
+	}
+	if len(b) > 0 {
+		r.writeEvent("o", string(b))
+	}
+}
+
+func (r *castRecorder) input(b []byte) {
+	if r == nil || !r.recordInput {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent("i", string(b))
+}
+
+func (r *castRecorder) resize(cols, rows int) {
+	if r == nil || cols <= 0 || rows <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.wroteHeader {
+		r.width, r.height = cols, rows
+		return
+	}
+	r.writeEvent("r", strconv.Itoa(cols)+"x"+strconv.Itoa(rows))
+}
+
+func (r *castRecorder) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.partial) > 0 {
+		r.writeEvent("o", string(r.partial))
+		r.partial = nil
+	}
+	_ = r.f.Close()
+}
+
+// writeEvent must be called with r.mu held.
+func (r *castRecorder) writeEvent(code, data string) {
+	if r.truncated {
+		return
+	}
+	if !r.wroteHeader {
+		h := castHeader{
+			Version:   2,
+			Width:     r.width,
+			Height:    r.height,
+			Timestamp: r.start.Unix(),
+			Title:     r.title,
+			Env:       map[string]string{"TERM": "xterm-256color"},
+		}
+		b, _ := json.Marshal(h)
+		if _, err := r.f.Write(append(b, '\n')); err != nil {
+			return
+		}
+		r.wroteHeader = true
+		r.size += int64(len(b) + 1)
+	}
+	t := float64(time.Since(r.start).Microseconds()) / 1e6
+	b, _ := json.Marshal([]any{t, code, data})
+	if r.maxBytes > 0 && r.size+int64(len(b)+1) > r.maxBytes {
+		r.truncated = true
+		b, _ = json.Marshal([]any{t, "m", "recording truncated: size limit reached"})
+	}
+	n, _ := r.f.Write(append(b, '\n'))
+	r.size += int64(n)
+}
+
+// incompleteUTF8Suffix returns the length of a trailing UTF-8 sequence in b that is cut short.
+func incompleteUTF8Suffix(b []byte) int {
+	for i := 1; i <= 3 && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if c < 0x80 {
+			return 0
+		}
+		if utf8.RuneStart(c) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// openSessionCast opens the recording of session id, logging instead of failing: recording is
+// best-effort like event persistence. The recording is limited to the size at which the session's
+// log rotates.
+func openSessionCast(logDir, id string, start time.Time, title string, maxBytes int64) *castRecorder {
+	r, err := openCastRecorder(filepath.Join(logDir, id+".cast"), start, title, maxBytes)
+	if err != nil {
+		log.Printf("session recording disabled (session=%s): %v", id, err)
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,154 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/logrotate"
+)
+
+func readCast(t *testing.T, path string) (castHeader, [][]any) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	var h castHeader
+	var evs [][]any
+	for i := 0; sc.Scan(); i++ {
+		if i == 0 {
+			if err := json.Unmarshal(sc.Bytes(), &h); err != nil {
+				t.Fatalf("header: %v", err)
+			}
+			continue
+		}
+		var ev []any
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil || len(ev) != 3 {
+			t.Fatalf("event line %q: %v", sc.Text(), err)
+		}
+		evs = append(evs, ev)
+	}
+	return h, evs
+}
+
+func TestCastRecorder_Format(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.cast")
+	r, err := openCastRecorder(path, time.Now(), "demo", 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	r.resize(120, 40) // before any output: becomes the header size
+	r.input([]byte("ignored"))
+	euro := []byte("€")
+	r.output(append([]byte("price "), euro[:1]...))
+	r.output(euro[1:])
+	r.resize(100, 30)
+	r.recordInput = true
+	r.input([]byte("ls\r"))
+	r.close()
+
+	h, evs := readCast(t, path)
+	if h.Version != 2 || h.Width != 120 || h.Height != 40 || h.Title != "demo" {
+		t.Fatalf("header=%+v", h)
+	}
+	var got []string
+	for _, ev := range evs {
+		got = append(got, ev[1].(string)+":"+ev[2].(string))
+	}
+	if want := "o:price ,o:€,r:100x30,i:ls\r"; strings.Join(got, ",") != want {
+		t.Fatalf("events=%q want %q", strings.Join(got, ","), want)
+	}
+}
+
+func TestSessionRecordsCast(t *testing.T) {
+	requirePTY(t)
+
+	logDir := t.TempDir()
+	m := NewManager(logDir, 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "shell", "rec", map[string]interface{}{"shell": "sh", "record_input": true})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_ = s.Resize(90, 20)
+	if err := s.WriteInput([]byte("echo cast-$((6*7))\n")); err != nil {
+		t.Fatalf("input: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(s.Replay(0)), "cast-42") {
+		if time.Now().After(deadline) {
+			t.Fatalf("output=%q", s.Replay(0))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := m.Terminate(s.ID); err != nil {
+		t.Fatalf("terminate: %v", err)
+	}
+
+	path, err := m.RecordingPath(s.ID)
+	if err != nil {
+		t.Fatalf("recording path: %v", err)
+	}
+	_, evs := readCast(t, path)
+	var out strings.Builder
+	sawInput := false
+	for _, ev := range evs {
+		switch ev[1] {
+		case "o":
+			out.WriteString(ev[2].(string))
+		case "i":
+			sawInput = sawInput || strings.Contains(ev[2].(string), "echo cast")
+		}
+	}
+	if !strings.Contains(out.String(), "cast-42") || !sawInput {
+		t.Fatalf("recording missing output or input: %v", evs)
+	}
+	if _, err := m.RecordingPath("../" + s.ID); err != ErrNotFound {
+		t.Fatalf("traversal err=%v want ErrNotFound", err)
+	}
+}
+
+func TestSessionCastStaysBounded(t *testing.T) {
+	requirePTY(t)
+
+	logDir := t.TempDir()
+	m := NewManager(logDir, 8, filepath.Join(t.TempDir(), "events"))
+	m.SetLogRotation(logrotate.Options{MaxBytes: 8 << 10})
+	s, err := m.Create(context.Background(), "shell", "chatty", map[string]interface{}{"shell": "sh"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer m.Terminate(s.ID)
+	if err := s.WriteInput([]byte("i=0; while [ $i -lt 3000 ]; do echo line-$i; i=$((i+1)); done; echo chatty-done\n")); err != nil {
+		t.Fatalf("input: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	// The echoed command line also contains chatty-done; wait for the line it prints.
+	for !strings.Contains(string(s.Replay(0)), "\nchatty-done") {
+		if time.Now().After(deadline) {
+			t.Fatal("no chatty-done in output")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// The session is still running: the recording stopped at the limit with a marker.
+	path := filepath.Join(logDir, s.ID+".cast")
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Size() > 9<<10 {
+		t.Fatalf("recording is %d bytes, want about 8 KiB", st.Size())
+	}
+	_, evs := readCast(t, path)
+	if last := evs[len(evs)-1]; last[1] != "m" || !strings.Contains(last[2].(string), "truncated") {
+		t.Fatalf("last event=%v, want the truncation marker", last)
+	}
+}
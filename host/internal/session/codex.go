@@ -4,9 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
-	"os"
-	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ericbosch/cli-remote-control/host/internal/codexrpc"
@@ -24,9 +23,11 @@ type codexInitializeParams struct {
 }
 
 type codexThreadStartParams struct {
-	ApprovalPolicy string  `json:"approvalPolicy,omitempty"`
-	Cwd            *string `json:"cwd,omitempty"`
-	Sandbox        *string `json:"sandbox,omitempty"`
+	Model          string         `json:"model,omitempty"`
+	ApprovalPolicy string         `json:"approvalPolicy,omitempty"`
+	Cwd            *string        `json:"cwd,omitempty"`
+	Sandbox        *string        `json:"sandbox,omitempty"`
+	Config         map[string]any `json:"config,omitempty"` // codex config overrides, by dotted key
 }
 
 type codexThreadStartResponse struct {
@@ -35,64 +36,108 @@ type codexThreadStartResponse struct {
 	} `json:"thread"`
 }
 
+// codexThreadResumeParams reopens a stored thread with the session's settings.
+type codexThreadResumeParams struct {
+	ThreadID string `json:"threadId"`
+	codexThreadStartParams
+}
+
+type codexThreadResumeResponse struct {
+	Thread struct {
+		ID    string `json:"id"`
+		Turns []struct {
+			ID    string           `json:"id"`
+			Items []map[string]any `json:"items"`
+		} `json:"turns"`
+	} `json:"thread"`
+}
+
 type codexTurnStartParams struct {
 	ThreadID string           `json:"threadId"`
 	Input    []codexUserInput `json:"input"`
+	Model    string           `json:"model,omitempty"`
+	Effort   string           `json:"effort,omitempty"`
+}
+
+type codexTurnStartResponse struct {
+	Turn struct {
+		ID string `json:"id"`
+	} `json:"turn"`
+}
+
+type codexTurnInterruptParams struct {
+	ThreadID string `json:"threadId"`
+	TurnID   string `json:"turnId"`
 }
 
 type codexUserInput struct {
 	Type string `json:"type"`
 	Text string `json:"text,omitempty"`
+	Path string `json:"path,omitempty"` // localImage
 }
 
-func newCodexSession(ctx context.Context, id, name string, args map[string]interface{}, logDir string, eventsDir string, bufKB int) (*Session, error) {
-	if bufKB <= 0 {
-		bufKB = defaultBufKB
-	}
-	ctx, cancel := context.WithCancel(ctx)
-	s := &Session{
-		ID:        id,
-		Name:      name,
-		Engine:    "codex",
-		Created:   time.Now(),
-		state:     "running",
-		ring:      NewRingBuffer(bufKB * 1024),
-		eventsBuf: events.NewBuffer(2048),
-		subs:      make(map[chan []byte]struct{}),
-		eventSubs: make(map[chan events.SessionEvent]struct{}),
-		cancel:    cancel,
-		done:      make(chan struct{}),
-	}
-	if eventsDir != "" {
-		if store, err := events.NewJSONLStore(eventsDir); err == nil {
-			s.eventsStore = store
-		} else {
-			log.Printf("events persistence disabled (dir=%s): %v", eventsDir, err)
-		}
+func init() {
+	registerBuiltin(codexEngine{})
+}
+
+// codexEngine drives `codex app-server` over JSON-RPC: one thread per session, one turn per
+// user message.
+type codexEngine struct{}
+
+func (codexEngine) Name() string { return "codex" }
+
+func (codexEngine) Detect(context.Context) EngineInfo {
+	info := EngineInfo{
+		Name:         "codex",
+		Capabilities: Capabilities{Structured: true, Prompt: true, Interrupt: true},
 	}
-	if err := os.MkdirAll(logDir, 0o750); err != nil {
-		cancel()
+	if _, err := codexrpc.FindBinary(); err != nil {
+		info.Detail = err.Error()
+		return info
+	}
+	info.Available = true
+	return info
+}
+
+func (codexEngine) Start(ctx context.Context, s *Session, args map[string]interface{}) (Process, error) {
+	opts, err := parseCodexOptions(s.codexPolicy, args)
+	if err != nil {
 		return nil, err
 	}
-	logPath := filepath.Join(logDir, id+".log")
-	lf, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	resumeID, err := parseCodexThreadID(args)
 	if err != nil {
-		cancel()
 		return nil, err
 	}
-	s.logFile = lf
-
-	client, err := codexrpc.Start(ctx)
+	if s.sandbox != nil {
+		s.sandbox.Writable = append(s.sandbox.Writable, opts.WritableRoots...)
+	}
+	if err := s.enableAttachments(); err != nil {
+		return nil, err
+	}
+	client, err := codexrpc.Start(ctx, s.prepareCmd)
 	if err != nil {
-		lf.Close()
-		cancel()
 		return nil, err
 	}
-	s.codex = client
-	s.cmd = client.Cmd()
+	s.trackProcess(client.Cmd().Process.Pid)
+	proc := &codexProc{s: s, client: client, opts: opts}
 
+	client.SetRequestHandler(proc.handleRequest)
 	client.SetNotificationHandler(func(method string, params json.RawMessage) {
 		switch method {
+		case "item/started":
+			var p struct {
+				Item map[string]any `json:"item"`
+			}
+			if err := json.Unmarshal(params, &p); err == nil && p.Item != nil {
+				proc.trackItem(method, p.Item)
+				proc.publishItem(method, p.Item)
+			}
+		case "item/commandExecution/outputDelta", "item/fileChange/outputDelta":
+			proc.publishItemDelta(method, params)
+		case "thread/tokenUsage/updated":
+			proc.reportTokenUsage(params)
+		case "account/rateLimits/updated":
+			proc.reportRateLimits(params)
 		case "item/agentMessage/delta":
 			var p struct {
 				Delta string `json:"delta"`
@@ -103,7 +148,7 @@ func newCodexSession(ctx context.Context, id, name string, args map[string]inter
 			if p.Delta == "" {
 				return
 			}
-			s.writeLegacyOutput([]byte(p.Delta))
+			s.WriteOutput([]byte(p.Delta))
 			_, _ = s.PublishEvent(events.EventKindAssistant, map[string]any{"data": p.Delta})
 		case "item/reasoning/textDelta":
 			var p struct {
@@ -126,14 +171,25 @@ func newCodexSession(ctx context.Context, id, name string, args map[string]inter
 			if p.Item == nil {
 				return
 			}
+			proc.trackItem(method, p.Item)
+			proc.publishItem(method, p.Item)
 			if t, _ := p.Item["type"].(string); t == "agentMessage" {
 				txt := extractTextFromThreadItem(p.Item)
 				if txt != "" {
-					s.writeLegacyOutput([]byte(txt))
+					s.WriteOutput([]byte(txt))
 					_, _ = s.PublishEvent(events.EventKindAssistant, map[string]any{"data": txt})
 				}
 			}
 		case "turn/completed":
+			var p struct {
+				Turn struct {
+					ID string `json:"id"`
+				} `json:"turn"`
+			}
+			if err := json.Unmarshal(params, &p); err == nil {
+				proc.endTurn(p.Turn.ID)
+			}
+			s.saveUsage()
 			_, _ = s.PublishEvent(events.EventKindThinkingDone, map[string]any{})
 		case "error":
 			var p struct {
@@ -153,90 +209,227 @@ func newCodexSession(ctx context.Context, id, name string, args map[string]inter
 	initCtx, cancelInit := context.WithTimeout(ctx, 10*time.Second)
 	defer cancelInit()
 
-	var initParams codexInitializeParams
-	initParams.ClientInfo.Name = "cli-remote-control"
-	initParams.ClientInfo.Version = "dev"
-	initParams.Capabilities = &struct {
-		ExperimentalAPI bool `json:"experimentalApi"`
-	}{ExperimentalAPI: true}
-
-	var initResp any
-	if err := client.Call(initCtx, "initialize", initParams, &initResp); err != nil {
+	if err := codexInitialize(initCtx, client); err != nil {
 		return nil, err
 	}
 
 	workspacePath, _ := args["workspacePath"].(string)
 	var threadParams codexThreadStartParams
-	threadParams.ApprovalPolicy = "never"
+	threadParams.Model = opts.Model
+	threadParams.ApprovalPolicy = opts.ApprovalPolicy
 	if workspacePath != "" {
 		threadParams.Cwd = &workspacePath
 	}
-	sandbox := "workspace-write"
-	threadParams.Sandbox = &sandbox
-
-	var threadResp codexThreadStartResponse
-	if err := client.Call(initCtx, "thread/start", threadParams, &threadResp); err != nil {
-		return nil, err
-	}
-	if threadResp.Thread.ID == "" {
-		return nil, errors.New("codex thread/start returned empty thread id")
+	threadParams.Sandbox = &opts.SandboxMode
+	if len(opts.WritableRoots) > 0 {
+		threadParams.Config = map[string]any{"sandbox_workspace_write.writable_roots": opts.WritableRoots}
 	}
-	s.codexThreadID = threadResp.Thread.ID
 
-	_, _ = s.PublishEvent(events.EventKindStatus, map[string]any{"state": "running"})
+	if resumeID != "" {
+		var resumeResp codexThreadResumeResponse
+		if err := client.Call(initCtx, "thread/resume", codexThreadResumeParams{ThreadID: resumeID, codexThreadStartParams: threadParams}, &resumeResp); err != nil {
+			return nil, err
+		}
+		proc.threadID = resumeResp.Thread.ID
+		if proc.threadID == "" {
+			proc.threadID = resumeID
+		}
+		_, _ = s.PublishEvent(events.EventKindSystem, map[string]any{
+			"subtype":   "thread_resumed",
+			"thread_id": proc.threadID,
+			"turns":     len(resumeResp.Thread.Turns),
+		})
+		for _, turn := range resumeResp.Thread.Turns {
+			for _, item := range turn.Items {
+				proc.replayItem(item)
+			}
+		}
+	} else {
+		var threadResp codexThreadStartResponse
+		if err := client.Call(initCtx, "thread/start", threadParams, &threadResp); err != nil {
+			return nil, err
+		}
+		if threadResp.Thread.ID == "" {
+			return nil, errors.New("codex thread/start returned empty thread id")
+		}
+		proc.threadID = threadResp.Thread.ID
+	}
+	meta := opts.meta()
+	meta["codex_thread_id"] = proc.threadID
+	s.SetEngineMeta(meta)
 
 	if prompt, _ := args["prompt"].(string); prompt != "" {
-		if err := s.codexStartTurn(prompt); err != nil {
+		if err := proc.startTurn(codexInput(prompt, nil), opts); err != nil {
 			return nil, err
 		}
 	}
 
-	return s, nil
+	return proc, nil
+}
+
+// codexProc is the Process of a codex session.
+type codexProc struct {
+	s        *Session
+	client   *codexrpc.Client
+	threadID string
+
+	mu           sync.Mutex
+	opts         codexOptions              // current settings; model and effort may change per turn
+	approvals    map[string]*codexApproval // pending, by approval id
+	nextApproval int
+	items        map[string]map[string]any // running command and file change items, by id
+	turnID       string                    // the turn in progress, from turn/start
+	lastDone     string                    // the last completed turn, in case it ends before turn/start returns
 }
 
-func (s *Session) codexStartTurn(prompt string) error {
-	s.mu.RLock()
-	client := s.codex
-	threadID := s.codexThreadID
-	s.mu.RUnlock()
-	if client == nil {
-		return errors.New("codex client not initialized")
+func (p *codexProc) SendInput(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return nil
 	}
-	if threadID == "" {
-		return errors.New("codex thread not initialized")
+	p.mu.Lock()
+	opts := p.opts
+	p.mu.Unlock()
+	if err := p.startTurn(codexInput(text, nil), opts); err != nil {
+		return err
 	}
+	_, _ = p.s.PublishEvent(events.EventKindUser, map[string]any{"data": text})
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+// SendTurn sends a message with attachments, or with a different model or effort, which stay in
+// effect for the following turns.
+func (p *codexProc) SendTurn(data []byte, t TurnOptions) error {
+	text := strings.TrimSpace(string(data))
+	atts, err := p.s.lookupAttachments(t.Attachments)
+	if err != nil {
+		return err
+	}
+	if text == "" && len(atts) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	opts, err := p.opts.withTurn(p.s.codexPolicy, t)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := p.startTurn(codexInput(text, atts), opts); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.opts.Model, p.opts.Effort = opts.Model, opts.Effort
+	p.mu.Unlock()
+	meta := map[string]any{}
+	if t.Model != "" {
+		meta["model"] = t.Model
+	}
+	if t.Effort != "" {
+		meta["effort"] = t.Effort
+	}
+	p.s.SetEngineMeta(meta)
+	user := map[string]any{"data": text}
+	if len(atts) > 0 {
+		user["attachments"] = atts
+	}
+	_, _ = p.s.PublishEvent(events.EventKindUser, user)
+	return nil
+}
+
+// codexInput is the turn input of a message: images are sent as local images, other files are
+// listed by path after the text.
+func codexInput(text string, atts []Attachment) []codexUserInput {
+	var files []Attachment
+	var images []codexUserInput
+	for _, a := range atts {
+		if a.IsImage() {
+			images = append(images, codexUserInput{Type: "localImage", Path: a.path})
+		} else {
+			files = append(files, a)
+		}
+	}
+	if len(files) > 0 {
+		text = strings.TrimSpace(text + "\n\n" + attachmentText(files))
+	}
+	var input []codexUserInput
+	if text != "" {
+		input = append(input, codexUserInput{Type: "text", Text: text})
+	}
+	return append(input, images...)
+}
+
+// Interrupt asks the app-server to stop the turn in progress; the thread stays open.
+func (p *codexProc) Interrupt() error {
+	p.mu.Lock()
+	turnID := p.turnID
+	p.mu.Unlock()
+	if turnID == "" {
+		return ErrIdle
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	return p.client.Call(ctx, "turn/interrupt", codexTurnInterruptParams{ThreadID: p.threadID, TurnID: turnID}, nil)
+}
 
-	params := codexTurnStartParams{
-		ThreadID: threadID,
-		Input: []codexUserInput{
-			{Type: "text", Text: prompt},
-		},
+func (p *codexProc) Stop() error {
+	if proc := p.client.Cmd().Process; proc != nil {
+		return proc.Kill()
 	}
-	var resp any
-	return client.Call(ctx, "turn/start", params, &resp)
+	return nil
 }
 
-func (s *Session) writeLegacyOutput(chunk []byte) {
-	if len(chunk) == 0 {
-		return
+func (p *codexProc) Wait() (int, error) {
+	err := p.client.Wait()
+	p.expireApprovals()
+	return exitCodeOf(err), err
+}
+
+func (p *codexProc) startTurn(input []codexUserInput, opts codexOptions) error {
+	if p.threadID == "" {
+		return errors.New("codex thread not initialized")
 	}
-	s.mu.Lock()
-	if s.ring != nil {
-		s.ring.Write(chunk)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	params := codexTurnStartParams{
+		ThreadID: p.threadID,
+		Input:    input,
+		Model:    opts.Model,
+		Effort:   opts.Effort,
 	}
-	if s.logFile != nil {
-		_, _ = s.logFile.Write(chunk)
+	var resp codexTurnStartResponse
+	if err := p.client.Call(ctx, "turn/start", params, &resp); err != nil {
+		return err
 	}
-	for ch := range s.subs {
-		select {
-		case ch <- chunk:
-		default:
-		}
+	p.mu.Lock()
+	if resp.Turn.ID != p.lastDone {
+		p.turnID = resp.Turn.ID
 	}
-	s.mu.Unlock()
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *codexProc) endTurn(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastDone = id
+	if p.turnID == id {
+		p.turnID = ""
+	}
+}
+
+// codexInitialize performs the initialize handshake every app-server connection starts with.
+func codexInitialize(ctx context.Context, client *codexrpc.Client) error {
+	var initParams codexInitializeParams
+	initParams.ClientInfo.Name = "cli-remote-control"
+	initParams.ClientInfo.Version = "dev"
+	initParams.Capabilities = &struct {
+		ExperimentalAPI bool `json:"experimentalApi"`
+	}{ExperimentalAPI: true}
+
+	var initResp any
+	return client.Call(ctx, "initialize", initParams, &initResp)
 }
 
 func extractTextFromThreadItem(item map[string]any) string {
@@ -0,0 +1,181 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+// codexApproval is a pending approval request of the app-server.
+type codexApproval struct {
+	rpcID  json.RawMessage
+	kind   string // "command" or "file_change"
+	legacy bool   // execCommandApproval/applyPatchApproval, which take the older decision names
+}
+
+// codexDecisions maps our decisions to the app-server's, for current and legacy requests.
+var codexDecisions = map[string][2]string{
+	DecisionApprove:        {"accept", "approved"},
+	DecisionApproveSession: {"acceptForSession", "approved_for_session"},
+	DecisionDeny:           {"decline", "denied"},
+	DecisionCancel:         {"cancel", "abort"},
+}
+
+// handleRequest turns the app-server's approval requests into approval events. Other requests are
+// left unanswered by us (the client replies "method not implemented").
+func (p *codexProc) handleRequest(id json.RawMessage, method string, params json.RawMessage) bool {
+	var req struct {
+		ItemID    string `json:"itemId"`
+		Reason    string `json:"reason"`
+		Command   any    `json:"command"` // a string, or argv in legacy requests
+		Cwd       string `json:"cwd"`
+		GrantRoot string `json:"grantRoot"`
+		// legacy requests
+		CallID      string                     `json:"callId"`
+		FileChanges map[string]json.RawMessage `json:"fileChanges"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return false
+	}
+	a := &codexApproval{rpcID: id}
+	payload := map[string]any{"status": "pending"}
+	switch method {
+	case "item/commandExecution/requestApproval", "execCommandApproval":
+		a.kind = "command"
+		item := p.startedItem(req.ItemID)
+		if req.Command == nil {
+			req.Command = item["command"]
+		}
+		if req.Cwd == "" {
+			req.Cwd, _ = item["cwd"].(string)
+		}
+		payload["command"] = req.Command
+		if req.Cwd != "" {
+			payload["cwd"] = req.Cwd
+		}
+	case "item/fileChange/requestApproval", "applyPatchApproval":
+		a.kind = "file_change"
+		if req.FileChanges != nil {
+			paths := make([]string, 0, len(req.FileChanges))
+			for path := range req.FileChanges {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			changes := make([]map[string]any, 0, len(paths))
+			for _, path := range paths {
+				changes = append(changes, map[string]any{"path": path, "change": req.FileChanges[path]})
+			}
+			payload["changes"] = changes
+		} else if changes, ok := p.startedItem(req.ItemID)["changes"]; ok {
+			payload["changes"] = changes
+		}
+		if req.GrantRoot != "" {
+			payload["grant_root"] = req.GrantRoot
+		}
+	default:
+		return false
+	}
+	a.legacy = method == "execCommandApproval" || method == "applyPatchApproval"
+	payload["kind"] = a.kind
+	if req.ItemID != "" {
+		payload["item_id"] = req.ItemID
+	} else if req.CallID != "" {
+		payload["item_id"] = req.CallID
+	}
+	if req.Reason != "" {
+		payload["reason"] = req.Reason
+	}
+
+	p.mu.Lock()
+	p.nextApproval++
+	approvalID := fmt.Sprintf("a%d", p.nextApproval)
+	if p.approvals == nil {
+		p.approvals = make(map[string]*codexApproval)
+	}
+	p.approvals[approvalID] = a
+	p.mu.Unlock()
+	payload["approval_id"] = approvalID
+	_, _ = p.s.PublishEvent(events.EventKindApproval, payload)
+	return true
+}
+
+// Approve answers a pending approval request.
+func (p *codexProc) Approve(id, decision string) error {
+	names, ok := codexDecisions[decision]
+	if !ok {
+		return fmt.Errorf("%w: unknown decision %q", ErrInvalidArgs, decision)
+	}
+	p.mu.Lock()
+	a := p.approvals[id]
+	delete(p.approvals, id)
+	p.mu.Unlock()
+	if a == nil {
+		return ErrUnknownApproval
+	}
+	answer := names[0]
+	if a.legacy {
+		answer = names[1]
+	}
+	if err := p.client.Respond(a.rpcID, map[string]any{"decision": answer}); err != nil {
+		return err
+	}
+	_, _ = p.s.PublishEvent(events.EventKindApproval, map[string]any{
+		"approval_id": id,
+		"kind":        a.kind,
+		"status":      "answered",
+		"decision":    decision,
+	})
+	return nil
+}
+
+// expireApprovals reports the approvals still pending when the app-server exits.
+func (p *codexProc) expireApprovals() {
+	p.mu.Lock()
+	pending := p.approvals
+	p.approvals = nil
+	p.mu.Unlock()
+	ids := make([]string, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		_, _ = p.s.PublishEvent(events.EventKindApproval, map[string]any{
+			"approval_id": id,
+			"kind":        pending[id].kind,
+			"status":      "expired",
+		})
+	}
+}
+
+// trackItem remembers command and file change items while they run: approval requests only
+// name the item, not its command or diff.
+func (p *codexProc) trackItem(method string, item map[string]any) {
+	id, _ := item["id"].(string)
+	if id == "" {
+		return
+	}
+	switch t, _ := item["type"].(string); t {
+	case "commandExecution", "fileChange":
+	default:
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if method == "item/completed" {
+		delete(p.items, id)
+		return
+	}
+	if p.items == nil {
+		p.items = make(map[string]map[string]any)
+	}
+	p.items[id] = item
+}
+
+func (p *codexProc) startedItem(id string) map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.items[id]
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+// waitEvent waits for an event of kind whose payload contains substr and returns its payload.
+func waitEvent(t *testing.T, s *Session, kind events.EventKind, substr string) map[string]any {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		for _, ev := range s.ReplayEventsFromSeq(0) {
+			if ev.Kind == kind && strings.Contains(string(ev.Payload), substr) {
+				var p map[string]any
+				_ = json.Unmarshal(ev.Payload, &p)
+				return p
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s event containing %q", kind, substr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCodexApprovals(t *testing.T) {
+	logPath := fakeCodex(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	if _, err := m.Create(context.Background(), "codex", "", map[string]interface{}{"approval_policy": "always"}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("invalid approval_policy: err=%v", err)
+	}
+	s, err := m.Create(context.Background(), "codex", "", map[string]interface{}{"approval_policy": "on-request"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	if meta, _ := s.Info()["engine_meta"].(map[string]any); meta["approval_policy"] != "on-request" {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+	b, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(b), `"approvalPolicy":"on-request"`) {
+		t.Fatalf("thread/start did not use the session's approval policy:\n%s", b)
+	}
+
+	// A command approval carries the command from the item the request names.
+	if err := s.WriteInput([]byte("run make deploy")); err != nil {
+		t.Fatal(err)
+	}
+	p := waitEvent(t, s, events.EventKindApproval, `"pending"`)
+	if p["kind"] != "command" || p["command"] != "make deploy" || p["cwd"] != "/w" || p["reason"] != "needs approval" {
+		t.Fatalf("approval=%v", p)
+	}
+	id, _ := p["approval_id"].(string)
+	if err := s.Approve(id, "yes"); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("bad decision: err=%v", err)
+	}
+	if err := s.Approve(id, DecisionApproveSession); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, `decision: {\"decision\":\"acceptForSession\"}`)
+	if p := waitEvent(t, s, events.EventKindApproval, `"answered"`); p["approval_id"] != id || p["decision"] != DecisionApproveSession {
+		t.Fatalf("answer event=%v", p)
+	}
+	if err := s.Approve(id, DecisionDeny); !errors.Is(err, ErrUnknownApproval) {
+		t.Fatalf("second answer: err=%v", err)
+	}
+
+	// Legacy requests get the older decision names; unanswered ones expire with the session.
+	if err := s.WriteInput([]byte("patch")); err != nil {
+		t.Fatal(err)
+	}
+	p = waitEvent(t, s, events.EventKindApproval, `"file_change"`)
+	if changes, _ := p["changes"].([]any); len(changes) != 1 || p["item_id"] != "call-1" {
+		t.Fatalf("patch approval=%v", p)
+	}
+	s.Terminate()
+	waitExited(t, s)
+	if p := waitEvent(t, s, events.EventKindApproval, `"expired"`); p["approval_id"] != "a2" {
+		t.Fatalf("expired event=%v", p)
+	}
+}
+
+func TestCodexApprovals_LegacyDecision(t *testing.T) {
+	fakeCodex(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "codex", "", map[string]interface{}{"approval_policy": "untrusted", "prompt": "patch"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	p := waitEvent(t, s, events.EventKindApproval, `"pending"`)
+	if err := s.Approve(p["approval_id"].(string), DecisionDeny); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, `decision: {\"decision\":\"denied\"}`)
+}
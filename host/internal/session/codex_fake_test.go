@@ -0,0 +1,240 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCodex puts a codex on PATH whose app-server is TestFakeCodexAppServer in this test binary,
+// and returns the file it logs the messages it receives to, one per line.
+func fakeCodex(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	logPath := filepath.Join(t.TempDir(), "codex.log")
+	script := "#!/bin/sh\nexec " + os.Args[0] + " -test.run='^TestFakeCodexAppServer$'\n"
+	if err := os.WriteFile(filepath.Join(bin, "codex"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_CODEX", "1")
+	t.Setenv("FAKE_CODEX_LOG", logPath)
+	return logPath
+}
+
+// TestFakeCodexAppServer is not a test: it is the app-server run by fakeCodex. A turn whose text is
+// "run <command>" asks to approve the command and replies with the decision; "patch" does the
+// same for a file change using the legacy request; "tools" runs one item of each tool type;
+// "usage" reports token usage and rate limits; "wait" runs until turn/interrupt; any other text is
+// echoed.
+func TestFakeCodexAppServer(t *testing.T) {
+	if os.Getenv("FAKE_CODEX") != "1" {
+		t.Skip("app-server helper for the codex engine tests")
+	}
+	f := &fakeCodexServer{out: os.Stdout, waiting: make(map[string]chan json.RawMessage), interrupt: make(chan string, 1)}
+	if path := os.Getenv("FAKE_CODEX_LOG"); path != "" {
+		if lf, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err == nil {
+			f.log = lf
+		}
+	}
+	f.serve(os.Stdin)
+	os.Exit(0)
+}
+
+type fakeCodexServer struct {
+	mu      sync.Mutex
+	out     io.Writer
+	log     io.Writer
+	turns   int
+	waiting map[string]chan json.RawMessage // server requests awaiting an answer, by id
+	// interrupt receives the turn ids of turn/interrupt requests.
+	interrupt chan string
+}
+
+func (f *fakeCodexServer) send(v map[string]any) {
+	v["jsonrpc"] = "2.0"
+	b, _ := json.Marshal(v)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, _ = f.out.Write(append(b, '\n'))
+}
+
+func (f *fakeCodexServer) notify(method string, params map[string]any) {
+	f.send(map[string]any{"method": method, "params": params})
+}
+
+// request sends a server-initiated request and waits for its result.
+func (f *fakeCodexServer) request(id, method string, params map[string]any) json.RawMessage {
+	ch := make(chan json.RawMessage, 1)
+	f.mu.Lock()
+	f.waiting[id] = ch
+	f.mu.Unlock()
+	f.send(map[string]any{"id": id, "method": method, "params": params})
+	return <-ch
+}
+
+func (f *fakeCodexServer) serve(in io.Reader) {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if f.log != nil {
+			fmt.Fprintln(f.log, line)
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			continue
+		}
+		if msg.Method == "" {
+			var id string
+			_ = json.Unmarshal(msg.ID, &id)
+			f.mu.Lock()
+			ch := f.waiting[id]
+			delete(f.waiting, id)
+			f.mu.Unlock()
+			if ch != nil {
+				ch <- msg.Result
+			}
+			continue
+		}
+		switch msg.Method {
+		case "initialize":
+			f.send(map[string]any{"id": msg.ID, "result": map[string]any{}})
+		case "thread/start":
+			f.send(map[string]any{"id": msg.ID, "result": map[string]any{"thread": map[string]any{"id": "th-1"}}})
+		case "thread/resume":
+			var p struct {
+				ThreadID string `json:"threadId"`
+			}
+			_ = json.Unmarshal(msg.Params, &p)
+			if p.ThreadID != "th-old" {
+				f.send(map[string]any{"id": msg.ID, "error": map[string]any{"code": -32600, "message": "thread not found: " + p.ThreadID}})
+				continue
+			}
+			f.send(map[string]any{"id": msg.ID, "result": map[string]any{"thread": fakeCodexStoredThread}})
+		case "thread/list":
+			var p struct {
+				Cursor string `json:"cursor"`
+			}
+			_ = json.Unmarshal(msg.Params, &p)
+			result := map[string]any{"data": []any{map[string]any{"id": "th-old", "preview": "fix the build", "cwd": "/w", "createdAt": 1700000000, "updatedAt": 1700000100}}, "nextCursor": "page-2"}
+			if p.Cursor == "page-2" {
+				result = map[string]any{"data": []any{map[string]any{"id": "th-older", "preview": "hello"}}}
+			}
+			f.send(map[string]any{"id": msg.ID, "result": result})
+		case "turn/start":
+			var p struct {
+				Input []struct {
+					Text string `json:"text"`
+				} `json:"input"`
+			}
+			_ = json.Unmarshal(msg.Params, &p)
+			f.mu.Lock()
+			f.turns++
+			turnID := fmt.Sprintf("turn-%d", f.turns)
+			f.mu.Unlock()
+			f.send(map[string]any{"id": msg.ID, "result": map[string]any{"turn": map[string]any{"id": turnID}}})
+			text := ""
+			if len(p.Input) > 0 {
+				text = p.Input[0].Text
+			}
+			go f.turn(turnID, text)
+		case "turn/interrupt":
+			var p struct {
+				TurnID string `json:"turnId"`
+			}
+			_ = json.Unmarshal(msg.Params, &p)
+			f.send(map[string]any{"id": msg.ID, "result": map[string]any{}})
+			f.interrupt <- p.TurnID
+		default:
+			f.send(map[string]any{"id": msg.ID, "error": map[string]any{"code": -32601, "message": "unknown method"}})
+		}
+	}
+}
+
+// fakeCodexStoredThread is the thread "th-old" that thread/resume reopens.
+var fakeCodexStoredThread = map[string]any{
+	"id": "th-old",
+	"turns": []any{
+		map[string]any{"id": "old-1", "items": []any{
+			map[string]any{"id": "u-1", "type": "userMessage", "content": []any{map[string]any{"type": "text", "text": "fix the build"}}},
+			map[string]any{"id": "cmd-1", "type": "commandExecution", "command": "make", "cwd": "/w", "status": "completed", "aggregatedOutput": "ok\n", "exitCode": 0},
+			map[string]any{"id": "a-1", "type": "agentMessage", "text": "fixed"},
+		}},
+	},
+}
+
+func (f *fakeCodexServer) turn(turnID, text string) {
+	reply := "echo: " + text
+	switch {
+	case strings.HasPrefix(text, "run "):
+		item := map[string]any{"id": "item-" + turnID, "type": "commandExecution", "command": strings.TrimPrefix(text, "run "), "cwd": "/w"}
+		f.notify("item/started", map[string]any{"threadId": "th-1", "turnId": turnID, "item": item})
+		res := f.request("req-"+turnID, "item/commandExecution/requestApproval", map[string]any{
+			"threadId": "th-1", "turnId": turnID, "itemId": item["id"], "reason": "needs approval",
+		})
+		f.notify("item/completed", map[string]any{"threadId": "th-1", "turnId": turnID, "item": item})
+		reply = "decision: " + string(res)
+	case text == "patch":
+		res := f.request("req-"+turnID, "applyPatchApproval", map[string]any{
+			"conversationId": "th-1", "callId": "call-1",
+			"fileChanges": map[string]any{"a.txt": map[string]any{"add": map[string]any{"content": "hi\n"}}},
+		})
+		reply = "decision: " + string(res)
+	case text == "tools":
+		f.toolItems(turnID)
+	case text == "usage":
+		for i, last := range []int{100, 50} {
+			f.notify("thread/tokenUsage/updated", map[string]any{"threadId": "th-1", "turnId": turnID, "tokenUsage": map[string]any{
+				"total":              map[string]any{"totalTokens": 100 + 50*i},
+				"last":               map[string]any{"totalTokens": last, "inputTokens": last - 10, "cachedInputTokens": 20, "outputTokens": 10, "reasoningOutputTokens": 5},
+				"modelContextWindow": 200000,
+			}})
+		}
+		f.notify("account/rateLimits/updated", map[string]any{"rateLimits": map[string]any{
+			"primary":   map[string]any{"usedPercent": 42.5, "windowDurationMins": 300, "resetsAt": 1700003600},
+			"secondary": map[string]any{"usedPercent": 7},
+		}})
+	case text == "wait":
+		if id := <-f.interrupt; id != turnID {
+			reply = "interrupted the wrong turn: " + id
+			break
+		}
+		f.notify("turn/completed", map[string]any{"threadId": "th-1", "turn": map[string]any{"id": turnID, "status": "interrupted"}})
+		return
+	}
+	f.notify("item/agentMessage/delta", map[string]any{"threadId": "th-1", "turnId": turnID, "delta": reply})
+	f.notify("turn/completed", map[string]any{"threadId": "th-1", "turn": map[string]any{"id": turnID}})
+}
+
+func (f *fakeCodexServer) toolItems(turnID string) {
+	item := func(method string, it map[string]any) {
+		f.notify(method, map[string]any{"threadId": "th-1", "turnId": turnID, "item": it})
+	}
+	delta := func(method, id, d string) {
+		f.notify(method, map[string]any{"threadId": "th-1", "turnId": turnID, "itemId": id, "delta": d})
+	}
+	item("item/started", map[string]any{"id": "cmd-1", "type": "commandExecution", "command": "go test ./...", "cwd": "/w", "status": "inProgress"})
+	delta("item/commandExecution/outputDelta", "cmd-1", "ok  pkg/a\n")
+	delta("item/commandExecution/outputDelta", "cmd-1", "ok  pkg/b\n")
+	item("item/completed", map[string]any{"id": "cmd-1", "type": "commandExecution", "command": "go test ./...", "cwd": "/w",
+		"status": "completed", "aggregatedOutput": "ok  pkg/a\nok  pkg/b\n", "exitCode": 0, "durationMs": 1500})
+	changes := []any{map[string]any{"path": "a.go", "kind": map[string]any{"type": "update"}, "diff": "@@ -1 +1 @@\n-a\n+b\n"}}
+	item("item/started", map[string]any{"id": "fc-1", "type": "fileChange", "changes": changes, "status": "inProgress"})
+	item("item/completed", map[string]any{"id": "fc-1", "type": "fileChange", "changes": changes, "status": "completed"})
+	item("item/started", map[string]any{"id": "mcp-1", "type": "mcpToolCall", "server": "docs", "tool": "search", "arguments": map[string]any{"q": "x"}, "status": "inProgress"})
+	item("item/completed", map[string]any{"id": "mcp-1", "type": "mcpToolCall", "server": "docs", "tool": "search", "status": "failed", "error": map[string]any{"message": "boom"}})
+	item("item/started", map[string]any{"id": "ws-1", "type": "webSearch", "query": "golang"})
+	item("item/completed", map[string]any{"id": "ws-1", "type": "webSearch", "query": "golang"})
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"encoding/json"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+// codexItemTools names the thread item types published as tool events.
+var codexItemTools = map[string]string{
+	"commandExecution": "command",
+	"fileChange":       "file_change",
+	"mcpToolCall":      "mcp",
+	"webSearch":        "web_search",
+}
+
+// publishItem maps a started or completed tool-like thread item to a tool_call (started) or
+// tool_output (completed) event. Events of one item share its item_id.
+func (p *codexProc) publishItem(method string, item map[string]any) {
+	typ, _ := item["type"].(string)
+	tool, ok := codexItemTools[typ]
+	if !ok {
+		return
+	}
+	payload := map[string]any{"item_id": item["id"], "tool": tool}
+	if method == "item/started" {
+		payload["status"] = "started"
+		switch typ {
+		case "commandExecution":
+			payload["args"] = map[string]any{"command": item["command"], "cwd": item["cwd"]}
+		case "fileChange":
+			payload["args"] = map[string]any{"changes": item["changes"]}
+		case "mcpToolCall":
+			payload["server"] = item["server"]
+			payload["name"] = item["tool"]
+			payload["args"] = item["arguments"]
+		case "webSearch":
+			payload["args"] = map[string]any{"query": item["query"]}
+		}
+		_, _ = p.s.PublishEvent(events.EventKindToolCall, payload)
+		return
+	}
+
+	payload["status"] = "completed"
+	if st, _ := item["status"].(string); st != "" {
+		payload["status"] = st
+	}
+	switch typ {
+	case "commandExecution":
+		payload["output"] = item["aggregatedOutput"]
+		payload["exit_code"] = item["exitCode"]
+		payload["duration_ms"] = item["durationMs"]
+	case "fileChange":
+		payload["changes"] = item["changes"]
+	case "mcpToolCall":
+		payload["server"] = item["server"]
+		payload["name"] = item["tool"]
+		payload["output"] = item["result"]
+		if e := item["error"]; e != nil {
+			payload["error"] = e
+		}
+	case "webSearch":
+		payload["query"] = item["query"]
+	}
+	_, _ = p.s.PublishEvent(events.EventKindToolOutput, payload)
+}
+
+// publishItemDelta maps an output delta of a running command or file change to a tool_output
+// event with status "running".
+func (p *codexProc) publishItemDelta(method string, params json.RawMessage) {
+	var d struct {
+		ItemID string `json:"itemId"`
+		Delta  string `json:"delta"`
+	}
+	if err := json.Unmarshal(params, &d); err != nil || d.Delta == "" {
+		return
+	}
+	tool := "command"
+	if method == "item/fileChange/outputDelta" {
+		tool = "file_change"
+	}
+	_, _ = p.s.PublishEvent(events.EventKindToolOutput, map[string]any{
+		"item_id": d.ItemID,
+		"tool":    tool,
+		"status":  "running",
+		"delta":   d.Delta,
+	})
+}
@@ -0,0 +1,47 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+func TestCodexToolItems(t *testing.T) {
+	fakeCodex(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "codex", "", map[string]interface{}{"prompt": "tools"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	waitEvent(t, s, events.EventKindAssistant, "echo: tools")
+
+	var got []string
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		if ev.Kind == events.EventKindToolCall || ev.Kind == events.EventKindToolOutput {
+			got = append(got, string(ev.Kind)+" "+string(ev.Payload))
+		}
+	}
+	want := []string{
+		`tool_call {"args":{"command":"go test ./...","cwd":"/w"},"item_id":"cmd-1","status":"started","tool":"command"}`,
+		`tool_output {"delta":"ok  pkg/a\n","item_id":"cmd-1","status":"running","tool":"command"}`,
+		`tool_output {"delta":"ok  pkg/b\n","item_id":"cmd-1","status":"running","tool":"command"}`,
+		`tool_output {"duration_ms":1500,"exit_code":0,"item_id":"cmd-1","output":"ok  pkg/a\nok  pkg/b\n","status":"completed","tool":"command"}`,
+		`tool_call {"args":{"changes":[{"diff":"@@ -1 +1 @@\n-a\n+b\n","kind":{"type":"update"},"path":"a.go"}]},"item_id":"fc-1","status":"started","tool":"file_change"}`,
+		`tool_output {"changes":[{"diff":"@@ -1 +1 @@\n-a\n+b\n","kind":{"type":"update"},"path":"a.go"}],"item_id":"fc-1","status":"completed","tool":"file_change"}`,
+		`tool_call {"args":{"q":"x"},"item_id":"mcp-1","name":"search","server":"docs","status":"started","tool":"mcp"}`,
+		`tool_output {"error":{"message":"boom"},"item_id":"mcp-1","name":"search","output":null,"server":"docs","status":"failed","tool":"mcp"}`,
+		`tool_call {"args":{"query":"golang"},"item_id":"ws-1","status":"started","tool":"web_search"}`,
+		`tool_output {"item_id":"ws-1","query":"golang","status":"completed","tool":"web_search"}`,
+	}
+	// JSON escapes the newlines in payloads.
+	for i := range want {
+		want[i] = strings.ReplaceAll(want[i], "\n", `\n`)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
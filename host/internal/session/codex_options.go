@@ -0,0 +1,155 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// Values accepted by the app-server for the codex settings of a session.
+var (
+	codexApprovalPolicies = []string{"never", "on-request", "on-failure", "untrusted"}
+	codexEfforts          = []string{"minimal", "low", "medium", "high"}
+	codexSandboxModes     = []string{"read-only", "workspace-write", "danger-full-access"}
+)
+
+// CodexPolicy restricts the codex settings sessions may choose. An empty list allows any value
+// codex accepts; when a list is set, sessions that leave the setting unset get its first value
+// unless the built-in default is in the list.
+type CodexPolicy struct {
+	Models           []string
+	Efforts          []string
+	ApprovalPolicies []string
+	SandboxModes     []string
+}
+
+// Validate checks that every allowed value is one codex accepts.
+func (p CodexPolicy) Validate() error {
+	for _, m := range p.Models {
+		if m == "" {
+			return fmt.Errorf("codex models: empty model name")
+		}
+	}
+	for _, c := range []struct {
+		name           string
+		allowed, known []string
+	}{
+		{"efforts", p.Efforts, codexEfforts},
+		{"approval policies", p.ApprovalPolicies, codexApprovalPolicies},
+		{"sandbox modes", p.SandboxModes, codexSandboxModes},
+	} {
+		for _, v := range c.allowed {
+			if !slices.Contains(c.known, v) {
+				return fmt.Errorf("codex %s: %q is not one of %v", c.name, v, c.known)
+			}
+		}
+	}
+	return nil
+}
+
+// codexOptions are the settings of a codex session. Model and Effort are empty to use codex's
+// configured defaults.
+type codexOptions struct {
+	Model          string
+	Effort         string
+	ApprovalPolicy string
+	SandboxMode    string
+	WritableRoots  []string // writable in addition to the workspace (sandbox mode workspace-write)
+}
+
+// parseCodexOptions reads args.model, args.effort, args.approval_policy, args.sandbox_mode and
+// args.writable_roots under the host policy.
+func parseCodexOptions(policy CodexPolicy, args map[string]interface{}) (codexOptions, error) {
+	var o codexOptions
+	var err error
+	if o.Model, err = codexChoice(args, "model", "", nil, policy.Models); err != nil {
+		return o, err
+	}
+	if o.Effort, err = codexChoice(args, "effort", "", codexEfforts, policy.Efforts); err != nil {
+		return o, err
+	}
+	if o.ApprovalPolicy, err = codexChoice(args, "approval_policy", "never", codexApprovalPolicies, policy.ApprovalPolicies); err != nil {
+		return o, err
+	}
+	if o.SandboxMode, err = codexChoice(args, "sandbox_mode", "workspace-write", codexSandboxModes, policy.SandboxModes); err != nil {
+		return o, err
+	}
+	if v, ok := args["writable_roots"]; ok && v != nil {
+		list, ok := v.([]interface{})
+		if !ok {
+			return o, fmt.Errorf("%w: writable_roots must be a list of absolute paths", ErrInvalidArgs)
+		}
+		for _, item := range list {
+			root, _ := item.(string)
+			if !filepath.IsAbs(root) {
+				return o, fmt.Errorf("%w: writable_roots must be a list of absolute paths", ErrInvalidArgs)
+			}
+			o.WritableRoots = append(o.WritableRoots, filepath.Clean(root))
+		}
+	}
+	return o, nil
+}
+
+// codexChoice reads the string args[key]. A set value must be one of known (when non-nil) and of
+// allowed (when non-empty). An unset value is def, or the first allowed value when def is not
+// allowed.
+func codexChoice(args map[string]interface{}, key, def string, known, allowed []string) (string, error) {
+	v, ok := args[key]
+	if !ok || v == nil || v == "" {
+		if len(allowed) == 0 || slices.Contains(allowed, def) {
+			return def, nil
+		}
+		return allowed[0], nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %s must be a string", ErrInvalidArgs, key)
+	}
+	return s, checkCodexChoice(key, s, known, allowed)
+}
+
+func checkCodexChoice(key, v string, known, allowed []string) error {
+	if known != nil && !slices.Contains(known, v) {
+		return fmt.Errorf("%w: %s must be one of %v", ErrInvalidArgs, key, known)
+	}
+	if len(allowed) > 0 && !slices.Contains(allowed, v) {
+		return fmt.Errorf("%w: %s %q is not allowed on this host (allowed: %v)", ErrInvalidArgs, key, v, allowed)
+	}
+	return nil
+}
+
+// withTurn returns o with the per-turn overrides in t applied, checked like the session args.
+func (o codexOptions) withTurn(policy CodexPolicy, t TurnOptions) (codexOptions, error) {
+	if t.Model != "" {
+		if err := checkCodexChoice("model", t.Model, nil, policy.Models); err != nil {
+			return o, err
+		}
+		o.Model = t.Model
+	}
+	if t.Effort != "" {
+		if err := checkCodexChoice("effort", t.Effort, codexEfforts, policy.Efforts); err != nil {
+			return o, err
+		}
+		o.Effort = t.Effort
+	}
+	return o, nil
+}
+
+// meta is the engine_meta of the settings; model and effort are left out while codex's defaults
+// apply.
+func (o codexOptions) meta() map[string]any {
+	m := map[string]any{
+		"approval_policy": o.ApprovalPolicy,
+		"sandbox_mode":    o.SandboxMode,
+	}
+	if o.Model != "" {
+		m["model"] = o.Model
+	}
+	if o.Effort != "" {
+		m["effort"] = o.Effort
+	}
+	if len(o.WritableRoots) > 0 {
+		m["writable_roots"] = o.WritableRoots
+	}
+	return m
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+func TestParseCodexOptions(t *testing.T) {
+	restricted := CodexPolicy{Models: []string{"gpt-a", "gpt-b"}, Efforts: []string{"low", "medium"}, SandboxModes: []string{"read-only"}}
+	cases := []struct {
+		name    string
+		policy  CodexPolicy
+		args    map[string]interface{}
+		want    codexOptions
+		wantErr bool
+	}{
+		{name: "defaults", want: codexOptions{ApprovalPolicy: "never", SandboxMode: "workspace-write"}},
+		{name: "host policy defaults", policy: restricted,
+			want: codexOptions{Model: "gpt-a", Effort: "low", ApprovalPolicy: "never", SandboxMode: "read-only"}},
+		{name: "chosen", policy: restricted, args: map[string]interface{}{"model": "gpt-b", "effort": "medium", "approval_policy": "untrusted", "writable_roots": []interface{}{"/tmp/x/"}},
+			want: codexOptions{Model: "gpt-b", Effort: "medium", ApprovalPolicy: "untrusted", SandboxMode: "read-only", WritableRoots: []string{"/tmp/x"}}},
+		{name: "unknown effort", args: map[string]interface{}{"effort": "max"}, wantErr: true},
+		{name: "model not allowed", policy: restricted, args: map[string]interface{}{"model": "gpt-c"}, wantErr: true},
+		{name: "sandbox mode not allowed", policy: restricted, args: map[string]interface{}{"sandbox_mode": "workspace-write"}, wantErr: true},
+		{name: "relative writable root", args: map[string]interface{}{"writable_roots": []interface{}{"src"}}, wantErr: true},
+		{name: "model not a string", args: map[string]interface{}{"model": 5}, wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := parseCodexOptions(tc.policy, tc.args)
+		if tc.wantErr {
+			if !errors.Is(err, ErrInvalidArgs) {
+				t.Errorf("%s: err=%v, want ErrInvalidArgs", tc.name, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, %v; want %+v", tc.name, got, err, tc.want)
+		}
+	}
+
+	if err := (CodexPolicy{Efforts: []string{"max"}}).Validate(); err == nil {
+		t.Error("policy with an unknown effort validated")
+	}
+	if err := restricted.Validate(); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+}
+
+func TestCodexOptions(t *testing.T) {
+	logPath := fakeCodex(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.SetCodexPolicy(CodexPolicy{Models: []string{"gpt-a", "gpt-b"}})
+	s, err := m.Create(context.Background(), "codex", "", map[string]interface{}{
+		"effort":         "low",
+		"sandbox_mode":   "read-only",
+		"writable_roots": []interface{}{"/data"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	meta, _ := s.Info()["engine_meta"].(map[string]any)
+	if meta["model"] != "gpt-a" || meta["effort"] != "low" || meta["sandbox_mode"] != "read-only" || meta["approval_policy"] != "never" {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+	b, _ := os.ReadFile(logPath)
+	if want := `"params":{"model":"gpt-a","approvalPolicy":"never","sandbox":"read-only","config":{"sandbox_workspace_write.writable_roots":["/data"]}}`; !strings.Contains(string(b), want) {
+		t.Fatalf("thread/start did not carry the settings:\n%s", b)
+	}
+
+	if err := s.WriteTurn([]byte("hi"), TurnOptions{Model: "gpt-c"}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("disallowed model: err=%v", err)
+	}
+	if err := s.WriteTurn([]byte("hi"), TurnOptions{Model: "gpt-b", Effort: "high"}); err != nil {
+		t.Fatalf("write turn: %v", err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, "echo: hi")
+	if err := s.WriteInput([]byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, "echo: again")
+	meta, _ = s.Info()["engine_meta"].(map[string]any)
+	if meta["model"] != "gpt-b" || meta["effort"] != "high" {
+		t.Fatalf("engine_meta after turn=%v", meta)
+	}
+	b, _ = os.ReadFile(logPath)
+	// The new settings apply to the turn that changed them and to later ones.
+	for _, text := range []string{"hi", "again"} {
+		if want := `"text":"` + text + `"}],"model":"gpt-b","effort":"high"`; !strings.Contains(string(b), want) {
+			t.Fatalf("turn %q did not carry the new settings:\n%s", text, b)
+		}
+	}
+}
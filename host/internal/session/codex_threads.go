@@ -0,0 +1,116 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/codexrpc"
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+// parseCodexThreadID reads args.thread_id, the stored thread a session resumes ("" for a new one).
+func parseCodexThreadID(args map[string]interface{}) (string, error) {
+	v, ok := args["thread_id"]
+	if !ok || v == nil {
+		return "", nil
+	}
+	id, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: thread_id must be a string", ErrInvalidArgs)
+	}
+	return id, nil
+}
+
+// replayItem publishes an item of a resumed thread's earlier turns the way it was published live:
+// user and agent messages as user and assistant events, tool items as a tool_call and its
+// tool_output.
+func (p *codexProc) replayItem(item map[string]any) {
+	switch typ, _ := item["type"].(string); typ {
+	case "userMessage":
+		if txt := codexItemText(item); txt != "" {
+			_, _ = p.s.PublishEvent(events.EventKindUser, map[string]any{"data": txt})
+		}
+	case "agentMessage":
+		if txt := codexItemText(item); txt != "" {
+			p.s.WriteOutput([]byte(txt))
+			_, _ = p.s.PublishEvent(events.EventKindAssistant, map[string]any{"data": txt})
+		}
+	default:
+		p.publishItem("item/started", item)
+		p.publishItem("item/completed", item)
+	}
+}
+
+// codexItemText returns the text of a stored message item: agent messages carry it in text, user
+// messages in their text content parts.
+func codexItemText(item map[string]any) string {
+	if txt, ok := item["text"].(string); ok {
+		return txt
+	}
+	return extractTextFromThreadItem(item)
+}
+
+// CodexThread is a stored codex thread a session can resume.
+type CodexThread struct {
+	ID        string `json:"id"`
+	Preview   string `json:"preview,omitempty"`
+	Cwd       string `json:"cwd,omitempty"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+	UpdatedAt int64  `json:"updated_at,omitempty"`
+}
+
+// CodexThreadPage is one page of ListCodexThreads; NextCursor is empty on the last page.
+type CodexThreadPage struct {
+	Threads    []CodexThread `json:"threads"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+type codexThreadListParams struct {
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type codexThreadListResponse struct {
+	Data []struct {
+		ID        string `json:"id"`
+		Preview   string `json:"preview"`
+		Cwd       string `json:"cwd"`
+		CreatedAt int64  `json:"createdAt"`
+		UpdatedAt int64  `json:"updatedAt"`
+	} `json:"data"`
+	NextCursor string `json:"nextCursor"`
+}
+
+// ListCodexThreads lists the threads stored by codex, newest first, using a short-lived
+// app-server. cursor is the NextCursor of the previous page; limit 0 uses codex's default.
+func ListCodexThreads(ctx context.Context, cursor string, limit int) (CodexThreadPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	client, err := codexrpc.Start(ctx, nil)
+	if err != nil {
+		return CodexThreadPage{}, err
+	}
+	defer func() {
+		_ = client.Cmd().Process.Kill()
+		_ = client.Wait()
+	}()
+	if err := codexInitialize(ctx, client); err != nil {
+		return CodexThreadPage{}, err
+	}
+	var resp codexThreadListResponse
+	if err := client.Call(ctx, "thread/list", codexThreadListParams{Cursor: cursor, Limit: limit}, &resp); err != nil {
+		return CodexThreadPage{}, err
+	}
+	page := CodexThreadPage{Threads: make([]CodexThread, 0, len(resp.Data)), NextCursor: resp.NextCursor}
+	for _, t := range resp.Data {
+		page.Threads = append(page.Threads, CodexThread{
+			ID:        t.ID,
+			Preview:   t.Preview,
+			Cwd:       t.Cwd,
+			CreatedAt: t.CreatedAt,
+			UpdatedAt: t.UpdatedAt,
+		})
+	}
+	return page, nil
+}
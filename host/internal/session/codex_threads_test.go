@@ -0,0 +1,110 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+func TestCodexThreadIDSurvivesRestart(t *testing.T) {
+	fakeCodex(t)
+	logDir := t.TempDir()
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	m := NewManager(logDir, 8, eventsDir)
+	s, err := m.Create(context.Background(), "codex", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+
+	m2 := NewManager(logDir, 8, eventsDir)
+	if err := m2.Restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	got := m2.Get(s.ID)
+	if got == nil {
+		t.Fatal("restored session not found")
+	}
+	if meta, _ := got.Info()["engine_meta"].(map[string]any); meta["codex_thread_id"] != "th-1" {
+		t.Fatalf("restored engine_meta=%v", meta)
+	}
+}
+
+func TestCodexResumeThread(t *testing.T) {
+	logPath := fakeCodex(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	if _, err := m.Create(context.Background(), "codex", "", map[string]interface{}{"thread_id": 7}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("non-string thread_id: err=%v", err)
+	}
+	if _, err := m.Create(context.Background(), "codex", "", map[string]interface{}{"thread_id": "th-missing"}); err == nil || !strings.Contains(err.Error(), "thread not found") {
+		t.Fatalf("unknown thread: err=%v", err)
+	}
+
+	s, err := m.Create(context.Background(), "codex", "", map[string]interface{}{"thread_id": "th-old"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	if meta, _ := s.Info()["engine_meta"].(map[string]any); meta["codex_thread_id"] != "th-old" {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+
+	var got []string
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		switch ev.Kind {
+		case events.EventKindSystem, events.EventKindUser, events.EventKindAssistant, events.EventKindToolCall, events.EventKindToolOutput:
+			got = append(got, string(ev.Kind)+" "+string(ev.Payload))
+		}
+	}
+	want := []string{
+		`system {"subtype":"thread_resumed","thread_id":"th-old","turns":1}`,
+		`user {"data":"fix the build"}`,
+		`tool_call {"args":{"command":"make","cwd":"/w"},"item_id":"cmd-1","status":"started","tool":"command"}`,
+		`tool_output {"duration_ms":null,"exit_code":0,"item_id":"cmd-1","output":"ok\n","status":"completed","tool":"command"}`,
+		`assistant {"data":"fixed"}`,
+	}
+	for i := range want {
+		want[i] = strings.ReplaceAll(want[i], "\n", `\n`)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("replayed events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// New turns continue the resumed thread.
+	if err := s.WriteInput([]byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, "echo: again")
+	b, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(b), `"method":"turn/start","params":{"threadId":"th-old"`) {
+		t.Fatalf("turn/start did not use the resumed thread:\n%s", b)
+	}
+}
+
+func TestListCodexThreads(t *testing.T) {
+	fakeCodex(t)
+	page, err := ListCodexThreads(context.Background(), "", 1)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	want := CodexThreadPage{
+		Threads:    []CodexThread{{ID: "th-old", Preview: "fix the build", Cwd: "/w", CreatedAt: 1700000000, UpdatedAt: 1700000100}},
+		NextCursor: "page-2",
+	}
+	if !reflect.DeepEqual(page, want) {
+		t.Fatalf("page=%+v", page)
+	}
+	page, err = ListCodexThreads(context.Background(), page.NextCursor, 1)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page.Threads) != 1 || page.Threads[0].ID != "th-older" || page.NextCursor != "" {
+		t.Fatalf("second page=%+v", page)
+	}
+}
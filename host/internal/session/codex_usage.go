@@ -0,0 +1,76 @@
+package session
+
+import "encoding/json"
+
+type codexTokenUsageBreakdown struct {
+	TotalTokens           int64 `json:"totalTokens"`
+	InputTokens           int64 `json:"inputTokens"`
+	CachedInputTokens     int64 `json:"cachedInputTokens"`
+	OutputTokens          int64 `json:"outputTokens"`
+	ReasoningOutputTokens int64 `json:"reasoningOutputTokens"`
+}
+
+type codexRateLimitWindow struct {
+	UsedPercent        float64 `json:"usedPercent"`
+	WindowDurationMins *int64  `json:"windowDurationMins"`
+	ResetsAt           *int64  `json:"resetsAt"`
+}
+
+func (w *codexRateLimitWindow) window() *RateLimitWindow {
+	if w == nil {
+		return nil
+	}
+	out := &RateLimitWindow{UsedPercent: w.UsedPercent}
+	if w.WindowDurationMins != nil {
+		out.WindowMinutes = *w.WindowDurationMins
+	}
+	if w.ResetsAt != nil {
+		out.ResetsAt = *w.ResetsAt
+	}
+	return out
+}
+
+// reportTokenUsage handles thread/tokenUsage/updated, sent after each model response. The usage
+// of that response (last) counts towards the totals; the thread's running total and the context
+// window go along in the metrics event.
+func (p *codexProc) reportTokenUsage(params json.RawMessage) {
+	var n struct {
+		TokenUsage struct {
+			Total              codexTokenUsageBreakdown `json:"total"`
+			Last               codexTokenUsageBreakdown `json:"last"`
+			ModelContextWindow *int64                   `json:"modelContextWindow"`
+		} `json:"tokenUsage"`
+	}
+	if err := json.Unmarshal(params, &n); err != nil {
+		return
+	}
+	last := n.TokenUsage.Last
+	extra := map[string]any{"thread_total_tokens": n.TokenUsage.Total.TotalTokens}
+	if n.TokenUsage.ModelContextWindow != nil {
+		extra["context_window"] = *n.TokenUsage.ModelContextWindow
+	}
+	p.s.ReportUsage(Usage{
+		InputTokens:           last.InputTokens,
+		CachedInputTokens:     last.CachedInputTokens,
+		OutputTokens:          last.OutputTokens,
+		ReasoningOutputTokens: last.ReasoningOutputTokens,
+		TotalTokens:           last.TotalTokens,
+	}, extra)
+}
+
+// reportRateLimits handles account/rateLimits/updated.
+func (p *codexProc) reportRateLimits(params json.RawMessage) {
+	var n struct {
+		RateLimits struct {
+			Primary   *codexRateLimitWindow `json:"primary"`
+			Secondary *codexRateLimitWindow `json:"secondary"`
+		} `json:"rateLimits"`
+	}
+	if err := json.Unmarshal(params, &n); err != nil {
+		return
+	}
+	p.s.ReportRateLimits(RateLimits{
+		Primary:   n.RateLimits.Primary.window(),
+		Secondary: n.RateLimits.Secondary.window(),
+	})
+}
@@ -0,0 +1,391 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/ericbosch/cli-remote-control/host/internal/policy"
+)
+
+// EngineConfigFile is the format of the file passed to `rc-host serve --engines-config`.
+type EngineConfigFile struct {
+	Engines []EngineConfig `json:"engines"`
+}
+
+// EngineConfig defines an engine backed by an arbitrary CLI.
+//
+// Args and PromptArgs may contain the placeholders {prompt} and {workspace}. PromptArgs are only
+// appended when the session was created with a prompt; an Args element that consists of a single
+// placeholder whose value is empty is dropped.
+type EngineConfig struct {
+	Name       string            `json:"name"`
+	Bin        string            `json:"bin"`
+	Args       []string          `json:"args,omitempty"`
+	PromptArgs []string          `json:"prompt_args,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	// Mode is "pty" (default) or "ndjson".
+	Mode   string        `json:"mode,omitempty"`
+	NDJSON *NDJSONConfig `json:"ndjson,omitempty"`
+}
+
+// NDJSONConfig maps the JSON lines an ndjson engine writes to stdout onto session events.
+type NDJSONConfig struct {
+	// TypeField is the dotted path of the field that selects the mapping (default "type").
+	TypeField string `json:"type_field,omitempty"`
+	// Events maps values of TypeField to events. Rows with an unmapped type are ignored.
+	Events map[string]NDJSONEventMapping `json:"events"`
+}
+
+// NDJSONEventMapping turns one kind of row into an event of Kind. Text is read from the dotted
+// path TextField (default "text"); rows whose text is empty are skipped for text-bearing kinds.
+type NDJSONEventMapping struct {
+	Kind      events.EventKind `json:"kind"`
+	TextField string           `json:"text_field,omitempty"`
+}
+
+const (
+	configModePTY    = "pty"
+	configModeNDJSON = "ndjson"
+)
+
+// configNDJSONMaxLine is the longest ndjson row read from a config engine; longer ones are skipped.
+const configNDJSONMaxLine = 2 * 1024 * 1024
+
+var engineNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+var configEventKinds = map[events.EventKind]bool{
+	events.EventKindSystem:        true,
+	events.EventKindUser:          true,
+	events.EventKindAssistant:     true,
+	events.EventKindThinkingDelta: true,
+	events.EventKindThinkingDone:  true,
+	events.EventKindToolCall:      true,
+	events.EventKindToolOutput:    true,
+	events.EventKindStatus:        true,
+	events.EventKindError:         true,
+	events.EventKindMetrics:       true,
+}
+
+// LoadEngineConfig reads engine definitions from path and returns them as engines.
+func LoadEngineConfig(path string) ([]Engine, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f EngineConfigFile
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("engines config %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	out := make([]Engine, 0, len(f.Engines))
+	for i, c := range f.Engines {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("engines config %s: engine %d: %w", path, i, err)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("engines config %s: duplicate engine %q", path, c.Name)
+		}
+		if _, ok := builtinEngines.Get(c.Name); ok {
+			return nil, fmt.Errorf("engines config %s: engine %q conflicts with a built-in engine", path, c.Name)
+		}
+		seen[c.Name] = true
+		out = append(out, &configEngine{cfg: c})
+	}
+	return out, nil
+}
+
+func (c *EngineConfig) validate() error {
+	if !engineNameRe.MatchString(c.Name) {
+		return fmt.Errorf("invalid name %q", c.Name)
+	}
+	if strings.TrimSpace(c.Bin) == "" {
+		return fmt.Errorf("%s: bin is required", c.Name)
+	}
+	switch c.Mode {
+	case "":
+		c.Mode = configModePTY
+	case configModePTY:
+	case configModeNDJSON:
+		if c.NDJSON == nil || len(c.NDJSON.Events) == 0 {
+			return fmt.Errorf("%s: ndjson mode requires an ndjson.events mapping", c.Name)
+		}
+		for typ, m := range c.NDJSON.Events {
+			if !configEventKinds[m.Kind] {
+				return fmt.Errorf("%s: ndjson event %q: unknown kind %q", c.Name, typ, m.Kind)
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unknown mode %q", c.Name, c.Mode)
+	}
+	if c.Mode == configModePTY && c.NDJSON != nil {
+		return fmt.Errorf("%s: ndjson mapping requires mode ndjson", c.Name)
+	}
+	return nil
+}
+
+// configEngine is an Engine defined in the engines config file.
+type configEngine struct {
+	cfg EngineConfig
+}
+
+func (e *configEngine) Name() string { return e.cfg.Name }
+
+func (e *configEngine) Detect(context.Context) EngineInfo {
+	info := EngineInfo{
+		Name: e.cfg.Name,
+		Capabilities: Capabilities{
+			PTY:        e.cfg.Mode == configModePTY,
+			Structured: e.cfg.Mode == configModeNDJSON,
+			Prompt:     e.usesPlaceholder("{prompt}"),
+			Interrupt:  e.cfg.Mode == configModePTY,
+		},
+	}
+	if path, err := exec.LookPath(e.cfg.Bin); err == nil {
+		info.Available = true
+		info.Detail = path
+	} else {
+		info.Detail = fmt.Sprintf("%s not found", e.cfg.Bin)
+	}
+	return info
+}
+
+func (e *configEngine) usesPlaceholder(p string) bool {
+	for _, a := range append(append([]string(nil), e.cfg.Args...), e.cfg.PromptArgs...) {
+		if strings.Contains(a, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *configEngine) Start(ctx context.Context, s *Session, args map[string]interface{}) (Process, error) {
+	prompt, _ := args["prompt"].(string)
+	prompt = strings.TrimSpace(prompt)
+	workspacePath, _ := args["workspacePath"].(string)
+
+	cmd := exec.CommandContext(ctx, e.cfg.Bin, e.commandArgs(prompt, workspacePath)...)
+	if workspacePath != "" {
+		cmd.Dir = workspacePath
+	}
+	env, _ := policy.EngineEnv(os.Environ())
+	env = append(env, "TERM=xterm-256color")
+	extra := make([]string, 0, len(e.cfg.Env))
+	for k, v := range e.cfg.Env {
+		extra = append(extra, k+"="+expandPlaceholders(v, prompt, workspacePath))
+	}
+	// Values from the config file are subject to the same policy as the host environment.
+	extra, _ = policy.EngineEnv(extra)
+	cmd.Env = append(env, extra...)
+
+	s.SetEngineMeta(map[string]any{
+		"config_engine": true,
+		"bin":           e.cfg.Bin,
+		"mode":          e.cfg.Mode,
+	})
+	if e.cfg.Mode == configModeNDJSON {
+		return startConfigNDJSON(s, cmd, e.cfg.NDJSON)
+	}
+	return s.StartPTY(cmd)
+}
+
+func (e *configEngine) commandArgs(prompt, workspace string) []string {
+	out := make([]string, 0, len(e.cfg.Args)+len(e.cfg.PromptArgs))
+	add := func(list []string) {
+		for _, a := range list {
+			v := expandPlaceholders(a, prompt, workspace)
+			if v == "" && (a == "{prompt}" || a == "{workspace}") {
+				continue
+			}
+			out = append(out, v)
+		}
+	}
+	add(e.cfg.Args)
+	if prompt != "" {
+		add(e.cfg.PromptArgs)
+	}
+	return out
+}
+
+func expandPlaceholders(s, prompt, workspace string) string {
+	return strings.NewReplacer("{prompt}", prompt, "{workspace}", workspace).Replace(s)
+}
+
+func startConfigNDJSON(s *Session, cmd *exec.Cmd, m *NDJSONConfig) (Process, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.prepareCmd(cmd); err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	s.trackProcess(cmd.Process.Pid)
+	p := &configNDJSONProc{s: s, cmd: cmd, stdin: stdin}
+	p.readers.Add(2)
+	go func() {
+		defer p.readers.Done()
+		s.readConfigNDJSON(stdout, m)
+	}()
+	go func() {
+		defer p.readers.Done()
+		s.readStderrErrors(stderr)
+	}()
+	return p, nil
+}
+
+// configNDJSONProc is the Process of an ndjson config engine. Each input is written to the
+// process's stdin as one line, with a newline added when it lacks one.
+type configNDJSONProc struct {
+	s       *Session
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	mu      sync.Mutex
+	readers sync.WaitGroup
+}
+
+func (p *configNDJSONProc) SendInput(data []byte) error {
+	line := data
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		line = append(append([]byte(nil), data...), '\n')
+	}
+	p.mu.Lock()
+	_, err := p.stdin.Write(line)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, _ = p.s.PublishEvent(events.EventKindUser, map[string]any{"data": string(data)})
+	return nil
+}
+
+func (p *configNDJSONProc) Interrupt() error { return ErrUnsupported }
+
+func (p *configNDJSONProc) Stop() error {
+	if p.cmd.Process == nil {
+		return nil
+	}
+	return p.cmd.Process.Kill()
+}
+
+func (p *configNDJSONProc) Wait() (int, error) {
+	p.readers.Wait()
+	err := p.cmd.Wait()
+	return exitCodeOf(err), err
+}
+
+func (s *Session) readConfigNDJSON(r io.Reader, m *NDJSONConfig) {
+	typeField := m.TypeField
+	if typeField == "" {
+		typeField = "type"
+	}
+	tooLong := func() {
+		_, _ = s.PublishEvent(events.EventKindError, map[string]any{"message": fmt.Sprintf("ndjson line longer than %d bytes skipped", configNDJSONMaxLine)})
+	}
+	readLines(r, configNDJSONMaxLine, tooLong, func(line string) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return
+		}
+		s.WriteOutput([]byte(line + "\n"))
+		var row map[string]any
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			_, _ = s.PublishEvent(events.EventKindError, map[string]any{"message": "invalid ndjson line", "line": line})
+			return
+		}
+		typ, _ := lookupPath(row, typeField).(string)
+		mapping, ok := m.Events[typ]
+		if !ok {
+			return
+		}
+		textField := mapping.TextField
+		if textField == "" {
+			textField = "text"
+		}
+		text, _ := lookupPath(row, textField).(string)
+		payload := map[string]any{"type": typ}
+		switch mapping.Kind {
+		case events.EventKindThinkingDelta:
+			payload["delta"] = text
+		case events.EventKindError:
+			payload["message"] = text
+		case events.EventKindToolCall, events.EventKindToolOutput, events.EventKindStatus, events.EventKindMetrics, events.EventKindThinkingDone:
+			payload["raw"] = row
+			if text != "" {
+				payload["data"] = text
+			}
+		default:
+			payload["data"] = text
+		}
+		if text == "" && (mapping.Kind == events.EventKindAssistant || mapping.Kind == events.EventKindUser ||
+			mapping.Kind == events.EventKindThinkingDelta || mapping.Kind == events.EventKindSystem) {
+			return
+		}
+		_, _ = s.PublishEvent(mapping.Kind, payload)
+	})
+}
+
+// readLines calls line for each line of r until it ends. Lines longer than max bytes are
+// discarded with a call to tooLong instead, and reading goes on: a reader that stopped would leave
+// the writer blocked on a full pipe.
+func readLines(r io.Reader, max int, tooLong func(), line func(string)) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var buf []byte
+	skipping := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !skipping {
+			buf = append(buf, chunk...)
+			if len(buf) > max {
+				skipping = true
+				buf = buf[:0]
+				tooLong()
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if !skipping && len(buf) > 0 {
+			line(string(buf))
+		}
+		skipping = false
+		buf = buf[:0]
+		if err != nil {
+			return
+		}
+	}
+}
+
+// lookupPath resolves a dotted path such as "message.text" in a decoded JSON object.
+func lookupPath(v map[string]any, path string) any {
+	var cur any = v
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = obj[part]
+	}
+	return cur
+}
@@ -0,0 +1,202 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+func writeEngineConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "engines.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadEngineConfig_Validates(t *testing.T) {
+	cases := map[string]string{
+		"builtin name":  `{"engines":[{"name":"shell","bin":"sh"}]}`,
+		"missing bin":   `{"engines":[{"name":"x"}]}`,
+		"bad mode":      `{"engines":[{"name":"x","bin":"sh","mode":"grpc"}]}`,
+		"bad kind":      `{"engines":[{"name":"x","bin":"sh","mode":"ndjson","ndjson":{"events":{"m":{"kind":"nope"}}}}]}`,
+		"no mapping":    `{"engines":[{"name":"x","bin":"sh","mode":"ndjson"}]}`,
+		"duplicate":     `{"engines":[{"name":"x","bin":"sh"},{"name":"x","bin":"sh"}]}`,
+		"unknown field": `{"engines":[{"name":"x","bin":"sh","argz":[]}]}`,
+	}
+	for name, body := range cases {
+		if _, err := LoadEngineConfig(writeEngineConfig(t, body)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestConfigEngine_CommandArgs(t *testing.T) {
+	e := &configEngine{cfg: EngineConfig{
+		Name:       "aider",
+		Bin:        "aider",
+		Args:       []string{"--root={workspace}", "{workspace}"},
+		PromptArgs: []string{"--message", "{prompt}"},
+	}}
+	if got := strings.Join(e.commandArgs("", ""), " "); got != "--root=" {
+		t.Fatalf("args without prompt=%q", got)
+	}
+	if got := strings.Join(e.commandArgs("fix it", "/w"), "|"); got != "--root=/w|/w|--message|fix it" {
+		t.Fatalf("args with prompt=%q", got)
+	}
+}
+
+func TestConfigEngine_NDJSONMapping(t *testing.T) {
+	path := writeEngineConfig(t, `{"engines":[{
+		"name": "lines",
+		"bin": "sh",
+		"args": ["-c", "echo '{\"type\":\"say\",\"msg\":{\"text\":\"hello\"}}'; echo '{\"type\":\"skip\"}'; echo '{\"type\":\"think\",\"text\":\"hmm\"}'"],
+		"mode": "ndjson",
+		"ndjson": {"events": {
+			"say": {"kind": "assistant", "text_field": "msg.text"},
+			"think": {"kind": "thinking_delta"}
+		}}
+	}]}`)
+	engines, err := LoadEngineConfig(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	for _, e := range engines {
+		m.Engines().Register(e)
+	}
+	if info := engines[0].Detect(context.Background()); !info.Available || !info.Capabilities.Structured {
+		t.Fatalf("detect=%+v", info)
+	}
+
+	s, err := m.Create(context.Background(), "lines", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if state, _ := s.State(); state == "exited" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for exit")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	var got []string
+	for _, ev := range s.ReplayEventsLastN(100) {
+		var p struct {
+			Data  string `json:"data"`
+			Delta string `json:"delta"`
+		}
+		_ = json.Unmarshal(ev.Payload, &p)
+		switch ev.Kind {
+		case events.EventKindAssistant:
+			got = append(got, "assistant:"+p.Data)
+		case events.EventKindThinkingDelta:
+			got = append(got, "thinking:"+p.Delta)
+		}
+	}
+	if strings.Join(got, ",") != "assistant:hello,thinking:hmm" {
+		t.Fatalf("events=%v", got)
+	}
+	if meta, _ := s.Info()["engine_meta"].(map[string]any); meta["mode"] != "ndjson" {
+		t.Fatalf("engine_meta=%v", s.Info()["engine_meta"])
+	}
+}
+
+func TestReadLinesSkipsLongLines(t *testing.T) {
+	in := "short\n" + strings.Repeat("x", 100) + "\nafter\nlast"
+	var lines []string
+	skipped := 0
+	readLines(strings.NewReader(in), 16, func() { skipped++ }, func(l string) { lines = append(lines, l) })
+	if strings.Join(lines, "|") != "short\n|after\n|last" || skipped != 1 {
+		t.Fatalf("lines=%q skipped=%d", lines, skipped)
+	}
+}
+
+func TestConfigEngine_NDJSONLongLine(t *testing.T) {
+	path := writeEngineConfig(t, `{"engines":[{
+		"name": "long",
+		"bin": "sh",
+		"args": ["-c", "head -c 3000000 /dev/zero | tr '\\0' x; echo; echo '{\"type\":\"say\",\"text\":\"after\"}'"],
+		"mode": "ndjson",
+		"ndjson": {"events": {"say": {"kind": "assistant"}}}
+	}]}`)
+	engines, err := LoadEngineConfig(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.Engines().Register(engines[0])
+	s, err := m.Create(context.Background(), "long", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if state, _ := s.State(); state == "exited" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("engine blocked after an overlong line")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	var got []string
+	for _, ev := range s.ReplayEventsLastN(100) {
+		switch ev.Kind {
+		case events.EventKindAssistant, events.EventKindError:
+			got = append(got, string(ev.Kind)+":"+string(ev.Payload))
+		}
+	}
+	if len(got) != 2 || !strings.Contains(got[0], "skipped") || !strings.Contains(got[1], "after") {
+		t.Fatalf("events=%v", got)
+	}
+}
+
+func TestConfigEngine_NDJSONInputLines(t *testing.T) {
+	path := writeEngineConfig(t, `{"engines":[{
+		"name": "reader",
+		"bin": "sh",
+		"args": ["-c", "while read -r l; do echo \"{\\\"type\\\":\\\"say\\\",\\\"text\\\":\\\"got [$l]\\\"}\"; done"],
+		"mode": "ndjson",
+		"ndjson": {"events": {"say": {"kind": "assistant"}}}
+	}]}`)
+	engines, err := LoadEngineConfig(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.Engines().Register(engines[0])
+	s, err := m.Create(context.Background(), "reader", "", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer stopSession(t, m, s)
+	// Each input is one line, whether or not it ends in a newline.
+	for _, in := range []string{"hi", "there\n"} {
+		if err := s.WriteInput([]byte(in)); err != nil {
+			t.Fatalf("input %q: %v", in, err)
+		}
+	}
+	waitEvent(t, s, events.EventKindAssistant, "got [hi]")
+	waitEvent(t, s, events.EventKindAssistant, "got [there]")
+	var n int
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		if ev.Kind == events.EventKindAssistant {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Fatalf("assistant events=%d want 2", n)
+	}
+}
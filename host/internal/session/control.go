@@ -0,0 +1,241 @@
+package session
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+var (
+	// ErrNotController is returned when a client that does not hold the input lock writes input.
+	ErrNotController = errors.New("another client has control of this session")
+	// ErrUnknownClient is returned for client IDs that are not attached to the session.
+	ErrUnknownClient = errors.New("client not attached")
+	// ErrReadOnlyClient is returned when a read-only client tries to write input or take control.
+	ErrReadOnlyClient = errors.New("client is read-only")
+)
+
+// ClientInfo describes a client attached to a session over WebSocket.
+type ClientInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Role string `json:"role"` // "controller" or "viewer"
+	// ReadOnly clients (e.g. view-only share links) can never control the session.
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// control implements the controller/viewer model: at most one attached client holds the input
+// lock, the others only watch. Every change is sent as a status event with state "control";
+// clients attaching and detaching are only sent live (see broadcastEvent), as reconnecting clients
+// would otherwise fill the session's history.
+type control struct {
+	mu         sync.Mutex
+	next       int
+	order      []string // attach order
+	names      map[string]string
+	readOnly   map[string]bool
+	controller string
+}
+
+// AttachClient registers a client (name is a free-form label, e.g. a device name) and returns its
+// ID. The first client that is not readOnly to attach to an uncontrolled session becomes the
+// controller.
+func (s *Session) AttachClient(name string, readOnly bool) string {
+	c := &s.control
+	c.mu.Lock()
+	if c.names == nil {
+		c.names = make(map[string]string)
+		c.readOnly = make(map[string]bool)
+	}
+	c.next++
+	id := "c" + strconv.Itoa(c.next)
+	c.names[id] = name
+	c.readOnly[id] = readOnly
+	c.order = append(c.order, id)
+	if c.controller == "" && !readOnly {
+		c.controller = id
+	}
+	c.mu.Unlock()
+	s.broadcastEvent(events.EventKindStatus, s.ControlPayload("attached", id))
+	return id
+}
+
+// DetachClient removes a client. If it held control, the session is left without a controller
+// until another client requests control or sends input.
+func (s *Session) DetachClient(id string) {
+	c := &s.control
+	c.mu.Lock()
+	if _, ok := c.names[id]; !ok {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.names, id)
+	delete(c.readOnly, id)
+	for i, o := range c.order {
+		if o == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	if c.controller == id {
+		c.controller = ""
+	}
+	c.mu.Unlock()
+	s.broadcastEvent(events.EventKindStatus, s.ControlPayload("detached", id))
+}
+
+// RequestControl asks for the input lock on behalf of client id. It is granted at once when the
+// session has no controller; otherwise the request is announced so the controller can grant it,
+// unless force is set, in which case control is taken over. It reports whether id now controls.
+func (s *Session) RequestControl(id string, force bool) (bool, error) {
+	c := &s.control
+	c.mu.Lock()
+	if _, ok := c.names[id]; !ok {
+		c.mu.Unlock()
+		return false, ErrUnknownClient
+	}
+	if c.readOnly[id] {
+		c.mu.Unlock()
+		return false, ErrReadOnlyClient
+	}
+	reason := "requested"
+	switch {
+	case c.controller == id:
+		c.mu.Unlock()
+		return true, nil
+	case c.controller == "":
+		c.controller, reason = id, "granted"
+	case force:
+		c.controller, reason = id, "taken"
+	}
+	granted := c.controller == id
+	c.mu.Unlock()
+	s.publishControl(reason, id)
+	return granted, nil
+}
+
+// GrantControl hands the input lock from its current holder, from, to another attached client.
+func (s *Session) GrantControl(from, to string) error {
+	c := &s.control
+	c.mu.Lock()
+	if c.controller != from {
+		c.mu.Unlock()
+		return ErrNotController
+	}
+	if _, ok := c.names[to]; !ok {
+		c.mu.Unlock()
+		return ErrUnknownClient
+	}
+	if c.readOnly[to] {
+		c.mu.Unlock()
+		return ErrReadOnlyClient
+	}
+	c.controller = to
+	c.mu.Unlock()
+	s.publishControl("granted", to)
+	return nil
+}
+
+// ReleaseControl gives up the input lock if id holds it.
+func (s *Session) ReleaseControl(id string) error {
+	c := &s.control
+	c.mu.Lock()
+	if c.controller != id {
+		c.mu.Unlock()
+		return ErrNotController
+	}
+	c.controller = ""
+	c.mu.Unlock()
+	s.publishControl("released", id)
+	return nil
+}
+
+// WriteInputFrom is WriteInput on behalf of an attached client. Input from viewers is rejected
+// with ErrNotController (ErrReadOnlyClient for read-only ones); input into an uncontrolled
+// session claims control first.
+func (s *Session) WriteInputFrom(id string, data []byte) error {
+	if err := s.claimInput(id); err != nil {
+		return err
+	}
+	return s.WriteInput(data)
+}
+
+// WriteTurnFrom is WriteTurn on behalf of an attached client, with the checks of WriteInputFrom.
+func (s *Session) WriteTurnFrom(id string, data []byte, opts TurnOptions) error {
+	if err := s.claimInput(id); err != nil {
+		return err
+	}
+	return s.WriteTurn(data, opts)
+}
+
+// InterruptFrom is Interrupt on behalf of an attached client; like input, only the controller may
+// interrupt.
+func (s *Session) InterruptFrom(id string) error {
+	if err := s.claimInput(id); err != nil {
+		return err
+	}
+	return s.Interrupt()
+}
+
+// claimInput checks that client id may send input, making it the controller of an uncontrolled
+// session.
+func (s *Session) claimInput(id string) error {
+	c := &s.control
+	c.mu.Lock()
+	if _, ok := c.names[id]; !ok {
+		c.mu.Unlock()
+		return ErrUnknownClient
+	}
+	if c.readOnly[id] {
+		c.mu.Unlock()
+		return ErrReadOnlyClient
+	}
+	claimed := false
+	if c.controller == "" {
+		c.controller, claimed = id, true
+	}
+	if c.controller != id {
+		c.mu.Unlock()
+		return ErrNotController
+	}
+	c.mu.Unlock()
+	if claimed {
+		s.publishControl("granted", id)
+	}
+	return nil
+}
+
+// Clients returns the attached clients in attach order and the controller's ID ("" if none).
+func (s *Session) Clients() (clients []ClientInfo, controller string) {
+	c := &s.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clients = make([]ClientInfo, 0, len(c.order))
+	for _, id := range c.order {
+		role := "viewer"
+		if id == c.controller {
+			role = "controller"
+		}
+		clients = append(clients, ClientInfo{ID: id, Name: c.names[id], Role: role, ReadOnly: c.readOnly[id]})
+	}
+	return clients, c.controller
+}
+
+// ControlPayload is the payload of control status events; client is the client the reason
+// ("attached", "detached", "requested", "granted", "taken", "released") refers to.
+func (s *Session) ControlPayload(reason, client string) map[string]any {
+	clients, controller := s.Clients()
+	return map[string]any{
+		"state":      "control",
+		"reason":     reason,
+		"client":     client,
+		"controller": controller,
+		"clients":    clients,
+	}
+}
+
+func (s *Session) publishControl(reason, client string) {
+	_, _ = s.PublishEvent(events.EventKindStatus, s.ControlPayload(reason, client))
+}
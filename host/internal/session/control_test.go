@@ -0,0 +1,103 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestControl_ControllerAndViewers(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.Engines().Register(echoEngine{})
+	s, err := m.Create(context.Background(), "echo", "e", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer m.Terminate(s.ID)
+
+	watcher := s.AttachClient("share", true)
+	desk := s.AttachClient("desktop", false)
+	phone := s.AttachClient("phone", false)
+	live := s.SubscribeEvents()
+	defer s.UnsubscribeEvents(live)
+	if _, controller := s.Clients(); controller != desk {
+		t.Fatalf("controller=%q want first client %q", controller, desk)
+	}
+	if _, err := s.RequestControl(watcher, true); !errors.Is(err, ErrReadOnlyClient) {
+		t.Fatalf("read-only take err=%v", err)
+	}
+	s.DetachClient(watcher)
+	if err := s.WriteInputFrom(phone, []byte("x")); !errors.Is(err, ErrNotController) {
+		t.Fatalf("viewer input err=%v", err)
+	}
+	if err := s.WriteInputFrom(desk, []byte("x")); err != nil {
+		t.Fatalf("controller input: %v", err)
+	}
+
+	if granted, _ := s.RequestControl(phone, false); granted {
+		t.Fatal("request granted while controlled")
+	}
+	if err := s.GrantControl(phone, desk); !errors.Is(err, ErrNotController) {
+		t.Fatalf("viewer grant err=%v", err)
+	}
+	if err := s.GrantControl(desk, phone); err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	if granted, _ := s.RequestControl(desk, true); !granted {
+		t.Fatal("take did not transfer control")
+	}
+
+	// A controller leaving frees the lock; the next input claims it.
+	s.DetachClient(desk)
+	if _, controller := s.Clients(); controller != "" {
+		t.Fatalf("controller=%q after detach", controller)
+	}
+	if err := s.WriteInputFrom(phone, []byte("y")); err != nil {
+		t.Fatalf("claim by input: %v", err)
+	}
+	clients, controller := s.Clients()
+	if controller != phone || len(clients) != 1 || clients[0].Role != "controller" || clients[0].Name != "phone" {
+		t.Fatalf("clients=%+v controller=%q", clients, controller)
+	}
+
+	var reasons []string
+	for _, ev := range s.ReplayEventsLastN(100) {
+		var p struct {
+			State  string `json:"state"`
+			Reason string `json:"reason"`
+		}
+		_ = json.Unmarshal(ev.Payload, &p)
+		if p.State == "control" {
+			reasons = append(reasons, p.Reason)
+		}
+	}
+	// Clients attaching and detaching are not kept in the history.
+	want := []string{"requested", "granted", "taken", "granted"}
+	if strings.Join(reasons, ",") != strings.Join(want, ",") {
+		t.Fatalf("control events=%v want %v", reasons, want)
+	}
+
+	// They are still sent to live subscribers, without a seq.
+	var liveReasons []string
+	for len(live) > 0 {
+		ev := <-live
+		var p struct {
+			State  string `json:"state"`
+			Reason string `json:"reason"`
+		}
+		_ = json.Unmarshal(ev.Payload, &p)
+		if p.State != "control" {
+			continue
+		}
+		liveReasons = append(liveReasons, p.Reason)
+		if ephemeral := p.Reason == "attached" || p.Reason == "detached"; ephemeral != (ev.Seq == 0) {
+			t.Fatalf("%s event has seq %d", p.Reason, ev.Seq)
+		}
+	}
+	if want := "requested,granted,taken,detached,granted"; strings.Join(liveReasons[len(liveReasons)-5:], ",") != want {
+		t.Fatalf("live control events=%v", liveReasons)
+	}
+}
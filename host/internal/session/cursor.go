@@ -0,0 +1,92 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/policy"
+)
+
+func init() {
+	registerBuiltin(cursorEngine{})
+}
+
+// cursorEngine runs the Cursor CLI agent. It prefers the structured NDJSON chat (see
+// startCursorNDJSON), then falls back to the interactive agent in a PTY when the agent lacks
+// stream-json output, and finally to a shell PTY mock (engine "cursor-mock") when no agent
+// entrypoint works.
+type cursorEngine struct{}
+
+func (cursorEngine) Name() string { return "cursor" }
+
+func (cursorEngine) Detect(context.Context) EngineInfo {
+	info := EngineInfo{
+		Name:         "cursor",
+		Capabilities: Capabilities{PTY: true, Structured: true, Prompt: true, Interrupt: true},
+	}
+	// Cursor support is best-effort; it may rely on cursor-agent/agent/cursor.
+	// Full entrypoint detection runs `--help` and is deferred to Start.
+	for _, bin := range []string{"cursor-agent", "agent", "cursor"} {
+		if _, err := exec.LookPath(bin); err == nil {
+			info.Available = true
+			return info
+		}
+	}
+	info.Detail = "cursor engine entrypoint not found (need cursor-agent, agent, or Cursor IDE)"
+	return info
+}
+
+func (cursorEngine) Start(ctx context.Context, s *Session, args map[string]interface{}) (Process, error) {
+	p, err := startCursorNDJSON(ctx, s, args)
+	if err == nil {
+		return p, nil
+	}
+	log.Printf("cursor NDJSON engine unavailable (%v); falling back to cursor PTY", err)
+	p, err = startCursorPTY(ctx, s, args)
+	if err == nil {
+		return p, nil
+	}
+	log.Printf("cursor engine unavailable (%v); falling back to shell PTY mock", err)
+	s.Engine = "cursor-mock"
+	return startShell(ctx, s, shellOptions{})
+}
+
+// startCursorPTY starts the Cursor CLI agent in a PTY.
+// It uses the official "agent" entrypoint and relies on browser-based login.
+// If the agent binary is missing or fails to start, this returns an error so the caller can fall back.
+func startCursorPTY(ctx context.Context, s *Session, args map[string]interface{}) (Process, error) {
+	workspacePath, _ := args["workspacePath"].(string)
+	prompt, _ := args["prompt"].(string)
+
+	ep, err := detectCursorEngineEntrypoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cmdArgs := []string{}
+	cmdArgs = append(cmdArgs, ep.ArgsPrefix...)
+	if prompt != "" && ep.SupportsPromptFlag {
+		cmdArgs = append(cmdArgs, "-p", prompt)
+	}
+
+	cmd := exec.CommandContext(ctx, ep.Bin, cmdArgs...)
+	if workspacePath != "" {
+		cmd.Dir = workspacePath
+	}
+	env, _ := policy.EngineEnv(os.Environ())
+	cmd.Env = append(env, "TERM=xterm-256color")
+
+	p, err := s.StartPTY(cmd)
+	if err != nil {
+		// Wrap error to signal cursor unavailability; caller will fall back.
+		return nil, errors.New("failed to start cursor engine")
+	}
+	s.SetEngineMeta(map[string]any{
+		"cursor_engine_entrypoint": ep.Name,
+		"cursor_engine_mode":       "pty",
+	})
+	return p, nil
+}
@@ -1,17 +1,17 @@
 package session
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"sort"
 	"strings"
-	"time"
+	"sync"
+	"syscall"
 
 	"github.com/ericbosch/cli-remote-control/host/internal/events"
 	"github.com/ericbosch/cli-remote-control/host/internal/policy"
@@ -25,6 +25,27 @@ type cursorNDJSONRow struct {
 
 	TimestampMS *int64 `json:"timestamp_ms,omitempty"`
 
+	// system/init rows
+	Model          string `json:"model,omitempty"`
+	Cwd            string `json:"cwd,omitempty"`
+	PermissionMode string `json:"permissionMode,omitempty"`
+
+	// tool_call rows: tool_call holds a single key naming the tool, e.g. "readToolCall".
+	CallID   string                     `json:"call_id,omitempty"`
+	ToolCall map[string]json.RawMessage `json:"tool_call,omitempty"`
+
+	// result rows
+	Result     string `json:"result,omitempty"`
+	IsError    bool   `json:"is_error,omitempty"`
+	DurationMS *int64 `json:"duration_ms,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	Usage      *struct {
+		InputTokens      int64 `json:"inputTokens"`
+		OutputTokens     int64 `json:"outputTokens"`
+		CacheReadTokens  int64 `json:"cacheReadTokens"`
+		CacheWriteTokens int64 `json:"cacheWriteTokens"`
+	} `json:"usage,omitempty"`
+
 	Message struct {
 		Role    string `json:"role"`
 		Content []struct {
@@ -34,142 +55,321 @@ type cursorNDJSONRow struct {
 	} `json:"message,omitempty"`
 }
 
-func newCursorSession(ctx context.Context, id, name string, args map[string]interface{}, logDir string, eventsDir string, bufKB int) (*Session, error) {
-	s, err := newCursorNDJSONSession(ctx, id, name, args, logDir, eventsDir, bufKB)
-	if err == nil {
-		return s, nil
-	}
-	log.Printf("cursor NDJSON engine unavailable (%v); falling back to cursor PTY", err)
-	return newCursorPTYSession(ctx, id, name, args, logDir, eventsDir, bufKB)
-}
-
-func newCursorNDJSONSession(ctx context.Context, id, name string, args map[string]interface{}, logDir string, eventsDir string, bufKB int) (*Session, error) {
+// startCursorNDJSON starts a structured cursor chat. Every user message, starting with the prompt,
+// is one `--print --output-format stream-json` run; later runs resume the chat id the stream
+// reported, so the session is one continuous conversation. Without a prompt the chat starts idle.
+func startCursorNDJSON(ctx context.Context, s *Session, args map[string]interface{}) (Process, error) {
 	prompt, _ := args["prompt"].(string)
 	prompt = strings.TrimSpace(prompt)
-	if prompt == "" {
-		return nil, errors.New("no prompt provided for NDJSON mode")
-	}
-
-	if bufKB <= 0 {
-		bufKB = defaultBufKB
-	}
-	ctx, cancel := context.WithCancel(ctx)
-	s := &Session{
-		ID:        id,
-		Name:      name,
-		Engine:    "cursor",
-		Created:   time.Now(),
-		state:     "running",
-		ring:      NewRingBuffer(bufKB * 1024),
-		eventsBuf: events.NewBuffer(2048),
-		subs:      make(map[chan []byte]struct{}),
-		eventSubs: make(map[chan events.SessionEvent]struct{}),
-		cancel:    cancel,
-		done:      make(chan struct{}),
-	}
-	if eventsDir != "" {
-		if store, err := events.NewJSONLStore(eventsDir); err == nil {
-			s.eventsStore = store
-		} else {
-			log.Printf("events persistence disabled (dir=%s): %v", eventsDir, err)
-		}
-	}
-	if err := os.MkdirAll(logDir, 0o750); err != nil {
-		cancel()
-		return nil, err
-	}
-	logPath := filepath.Join(logDir, id+".log")
-	lf, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
-	if err != nil {
-		cancel()
-		return nil, err
-	}
-	s.logFile = lf
-
 	workspacePath, _ := args["workspacePath"].(string)
 
 	ep, err := detectCursorEngineEntrypoint(ctx)
 	if err != nil {
-		lf.Close()
-		cancel()
 		return nil, err
 	}
 	if !ep.SupportsStructuredStreaming {
-		lf.Close()
-		cancel()
 		return nil, errors.New("cursor engine structured streaming unsupported")
 	}
+	if err := s.enableAttachments(); err != nil {
+		return nil, err
+	}
+
+	p := &cursorNDJSONProc{
+		s:    s,
+		ctx:  ctx,
+		ep:   ep,
+		dir:  workspacePath,
+		done: make(chan struct{}),
+	}
+	if prompt != "" {
+		p.mu.Lock()
+		err := p.startRun(prompt)
+		p.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.SetEngineMeta(map[string]any{
+		"cursor_engine_entrypoint": ep.Name,
+		"cursor_engine_mode":       "structured",
+	})
+	return p, nil
+}
+
+// cursorNDJSONProc is the Process of a structured cursor chat. It runs one agent process per user
+// message; messages sent while a run is in progress are queued and sent in order.
+type cursorNDJSONProc struct {
+	s    *Session
+	ctx  context.Context
+	ep   cursorEngineEntrypoint
+	dir  string
+	runs sync.WaitGroup
+
+	mu          sync.Mutex
+	chatID      string
+	cmd         *exec.Cmd // the run in progress, if any
+	interrupted bool      // cmd is being killed by Interrupt
+	queue       []string
+	lastErr     error
+	stopped     bool
+	done        chan struct{}
+	stopOnce    sync.Once
+}
+
+func (p *cursorNDJSONProc) SendInput(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return nil
+	}
+	return p.send(text, map[string]any{"data": text})
+}
+
+// SendTurn sends a message with attachments, which the agent gets as a list of file paths after
+// the text. cursor's model cannot change per message.
+func (p *cursorNDJSONProc) SendTurn(data []byte, t TurnOptions) error {
+	if t.Model != "" || t.Effort != "" {
+		return fmt.Errorf("%w: the cursor engine does not take a model or effort per message", ErrInvalidArgs)
+	}
+	text := strings.TrimSpace(string(data))
+	atts, err := p.s.lookupAttachments(t.Attachments)
+	if err != nil {
+		return err
+	}
+	if len(atts) == 0 {
+		return p.SendInput(data)
+	}
+	user := map[string]any{"data": text, "attachments": atts}
+	return p.send(strings.TrimSpace(text+"\n\n"+attachmentText(atts)), user)
+}
+
+// send starts a run with msg, or queues it while a run is in progress, and publishes user as the
+// user event.
+func (p *cursorNDJSONProc) send(msg string, user map[string]any) error {
+	p.mu.Lock()
+	var err error
+	switch {
+	case p.stopped:
+		err = io.ErrClosedPipe
+	case p.cmd != nil:
+		p.queue = append(p.queue, msg)
+	default:
+		err = p.startRun(msg)
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, _ = p.s.PublishEvent(events.EventKindUser, user)
+	return nil
+}
+
+// Interrupt kills the run in progress and drops the queued messages; the chat stays open and the
+// next message resumes it.
+func (p *cursorNDJSONProc) Interrupt() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil || p.cmd.Process == nil {
+		return ErrIdle
+	}
+	p.interrupted = true
+	p.queue = nil
+	return killRun(p.cmd)
+}
+
+// Stop ends the chat, killing the run in progress.
+func (p *cursorNDJSONProc) Stop() error {
+	p.mu.Lock()
+	p.stopped = true
+	p.queue = nil
+	cmd := p.cmd
+	p.mu.Unlock()
+	p.stopOnce.Do(func() { close(p.done) })
+	if cmd != nil && cmd.Process != nil {
+		return killRun(cmd)
+	}
+	return nil
+}
+
+// killRun kills an agent run with the processes it started, which would otherwise keep its
+// output pipes open.
+func killRun(cmd *exec.Cmd) error {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// Wait blocks until the chat is stopped (or its context is cancelled) and the last run has exited.
+// It reports the exit of the last run.
+func (p *cursorNDJSONProc) Wait() (int, error) {
+	select {
+	case <-p.done:
+	case <-p.ctx.Done():
+		_ = p.Stop()
+	}
+	p.runs.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return exitCodeOf(p.lastErr), p.lastErr
+}
 
+// startRun starts the agent for one message. The caller holds p.mu.
+func (p *cursorNDJSONProc) startRun(message string) error {
 	cmdArgs := []string{}
-	cmdArgs = append(cmdArgs, ep.ArgsPrefix...)
-	cmdArgs = append(cmdArgs, "--print", "--output-format", "stream-json", "--stream-partial-output", prompt)
+	cmdArgs = append(cmdArgs, p.ep.ArgsPrefix...)
+	cmdArgs = append(cmdArgs, "--print", "--output-format", "stream-json", "--stream-partial-output")
+	if p.chatID != "" {
+		cmdArgs = append(cmdArgs, "--resume", p.chatID)
+	}
+	// The message is user text: "--" keeps one starting with "-" from being read as a flag.
+	cmdArgs = append(cmdArgs, "--", message)
 
-	cmd := exec.CommandContext(ctx, ep.Bin, cmdArgs...)
-	if workspacePath != "" {
-		cmd.Dir = workspacePath
+	cmd := exec.CommandContext(p.ctx, p.ep.Bin, cmdArgs...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if p.dir != "" {
+		cmd.Dir = p.dir
 	}
 	env, _ := policy.EngineEnv(os.Environ())
 	cmd.Env = append(env, "TERM=xterm-256color")
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		lf.Close()
-		cancel()
-		return nil, err
+		return err
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		lf.Close()
-		cancel()
-		return nil, err
+		return err
 	}
 
-	s.cmd = cmd
-	if err := cmd.Start(); err != nil {
-		lf.Close()
-		cancel()
-		return nil, err
+	if err := p.s.prepareCmd(cmd); err != nil {
+		return err
 	}
-	s.engineMeta = map[string]any{
-		"cursor_engine_entrypoint": ep.Name,
-		"cursor_engine_mode":       "structured",
+	if err := cmd.Start(); err != nil {
+		return err
 	}
+	p.s.trackProcess(cmd.Process.Pid)
+	p.cmd = cmd
+	p.runs.Add(1)
+	go p.run(cmd, stdout, stderr)
+	return nil
+}
 
-	_, _ = s.PublishEvent(events.EventKindStatus, map[string]any{"state": "running"})
+// run waits for one agent run, records the chat id it reported and starts the next queued
+// message.
+func (p *cursorNDJSONProc) run(cmd *exec.Cmd, stdout, stderr io.Reader) {
+	defer p.runs.Done()
 
+	// Each run gets its own deduper: a later turn may well repeat an earlier reply.
 	deduper := events.NewDeduper(4096, events.DedupeOptions{IncludeTimestampMS: false})
-	go s.readCursorNDJSON(stdout, deduper)
-	go s.readCursorStderr(stderr)
-	return s, nil
-}
+	var chatID string
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		chatID = p.s.readCursorNDJSON(stdout, deduper)
+	}()
+	go func() {
+		defer readers.Done()
+		p.s.readStderrErrors(stderr)
+	}()
+	// Wait closes the pipes, so drain them first.
+	readers.Wait()
+	err := cmd.Wait()
 
-func (s *Session) readCursorStderr(r io.Reader) {
-	sc := bufio.NewScanner(r)
-	sc.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
-	for sc.Scan() {
-		line := strings.TrimSpace(sc.Text())
-		if line == "" {
-			continue
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cmd = nil
+	p.lastErr = err
+	interrupted := p.interrupted
+	p.interrupted = false
+	if chatID != "" && chatID != p.chatID {
+		p.chatID = chatID
+		p.s.SetEngineMeta(map[string]any{"cursor_chat_id": chatID})
+	}
+	if p.stopped {
+		return
+	}
+	if err != nil && !interrupted {
+		_, _ = p.s.PublishEvent(events.EventKindError, map[string]any{"message": "cursor agent run failed: " + err.Error()})
+	}
+	for len(p.queue) > 0 {
+		next := p.queue[0]
+		p.queue = p.queue[1:]
+		err := p.startRun(next)
+		if err == nil {
+			return
 		}
-		_, _ = s.PublishEvent(events.EventKindError, map[string]any{"message": line})
+		_, _ = p.s.PublishEvent(events.EventKindError, map[string]any{"message": "cursor agent run failed: " + err.Error()})
+	}
+}
+
+// Longest stdout row and stderr line read from an engine; longer ones are skipped.
+const (
+	cursorNDJSONMaxLine = 8 * 1024 * 1024
+	stderrMaxLine       = 2 * 1024 * 1024
+)
+
+// readStderrErrors publishes each non-empty stderr line of an engine as an error event.
+func (s *Session) readStderrErrors(r io.Reader) {
+	tooLong := func() {
+		_, _ = s.PublishEvent(events.EventKindError, map[string]any{"message": fmt.Sprintf("stderr line longer than %d bytes skipped", stderrMaxLine)})
 	}
+	readLines(r, stderrMaxLine, tooLong, func(line string) {
+		if line = strings.TrimSpace(line); line != "" {
+			_, _ = s.PublishEvent(events.EventKindError, map[string]any{"message": line})
+		}
+	})
 }
 
-func (s *Session) readCursorNDJSON(r io.Reader, deduper *events.Deduper) {
-	sc := bufio.NewScanner(r)
-	sc.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
-	for sc.Scan() {
-		line := strings.TrimSpace(sc.Text())
+// readCursorNDJSON publishes the events of one cursor run and returns the chat id it reported.
+func (s *Session) readCursorNDJSON(r io.Reader, deduper *events.Deduper) (chatID string) {
+	tooLong := func() {
+		_, _ = s.PublishEvent(events.EventKindError, map[string]any{"message": fmt.Sprintf("NDJSON line longer than %d bytes skipped", cursorNDJSONMaxLine)})
+	}
+	readLines(r, cursorNDJSONMaxLine, tooLong, func(line string) {
+		line = strings.TrimSpace(line)
 		if line == "" {
-			continue
+			return
 		}
 
 		var row cursorNDJSONRow
 		if err := json.Unmarshal([]byte(line), &row); err != nil {
 			_, _ = s.PublishEvent(events.EventKindError, map[string]any{"message": "invalid NDJSON line"})
-			continue
+			return
+		}
+		if row.SessionID != "" {
+			chatID = row.SessionID
 		}
 
 		switch row.Type {
+		case "system":
+			if row.Subtype == "init" {
+				_, _ = s.PublishEvent(events.EventKindSystem, map[string]any{
+					"subtype":         row.Subtype,
+					"model":           row.Model,
+					"cwd":             row.Cwd,
+					"session_id":      row.SessionID,
+					"permission_mode": row.PermissionMode,
+				})
+			}
+		case "tool_call":
+			if kind, payload, ok := cursorToolEvent(row); ok {
+				_, _ = s.PublishEvent(kind, payload)
+			}
+		case "result":
+			payload := map[string]any{
+				"state":    "turn_completed",
+				"result":   row.Subtype,
+				"is_error": row.IsError,
+			}
+			if row.DurationMS != nil {
+				payload["duration_ms"] = *row.DurationMS
+			}
+			if row.RequestID != "" {
+				payload["request_id"] = row.RequestID
+			}
+			_, _ = s.PublishEvent(events.EventKindStatus, payload)
+			reportCursorUsage(s, row)
+			s.saveUsage()
 		case "thinking":
 			if row.Subtype == "delta" && row.Text != "" {
 				_, _ = s.PublishEvent(events.EventKindThinkingDelta, map[string]any{"delta": row.Text})
@@ -180,12 +380,12 @@ func (s *Session) readCursorNDJSON(r io.Reader, deduper *events.Deduper) {
 		case "assistant":
 			txt := cursorExtractText(row)
 			if strings.TrimSpace(txt) == "" {
-				continue
+				return
 			}
 
 			raw, err := events.MarshalPayload(map[string]any{"data": txt})
 			if err != nil {
-				continue
+				return
 			}
 			probe := events.SessionEvent{
 				SessionID: s.ID,
@@ -195,13 +395,94 @@ func (s *Session) readCursorNDJSON(r io.Reader, deduper *events.Deduper) {
 				Payload:   raw,
 			}
 			if deduper.Seen(probe) {
-				continue
+				return
 			}
 
-			s.writeLegacyOutput([]byte(txt))
+			s.WriteOutput([]byte(txt))
 			_, _ = s.PublishEvent(events.EventKindAssistant, map[string]any{"data": txt})
 		}
+	})
+	return chatID
+}
+
+// reportCursorUsage counts the usage and duration of a result row. As with codex, cached input
+// is part of the input tokens.
+func reportCursorUsage(s *Session, row cursorNDJSONRow) {
+	var u Usage
+	if row.DurationMS != nil {
+		u.DurationMS = *row.DurationMS
+	}
+	if row.Usage != nil {
+		u.CachedInputTokens = row.Usage.CacheReadTokens
+		u.InputTokens = row.Usage.InputTokens + row.Usage.CacheReadTokens + row.Usage.CacheWriteTokens
+		u.OutputTokens = row.Usage.OutputTokens
+		u.TotalTokens = u.InputTokens + u.OutputTokens
+	}
+	if u == (Usage{}) {
+		return
+	}
+	var extra map[string]any
+	if row.RequestID != "" {
+		extra = map[string]any{"request_id": row.RequestID}
+	}
+	s.ReportUsage(u, extra)
+}
+
+// cursorToolEvent maps a tool_call row: "started" becomes a tool_call event with the tool's
+// arguments, "completed" a tool_output event with its result.
+func cursorToolEvent(row cursorNDJSONRow) (events.EventKind, map[string]any, bool) {
+	keys := make([]string, 0, len(row.ToolCall))
+	for k := range row.ToolCall {
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return "", nil, false
+	}
+	sort.Strings(keys)
+	var body struct {
+		Args   json.RawMessage            `json:"args,omitempty"`
+		Result map[string]json.RawMessage `json:"result,omitempty"`
+		// "function" tool calls carry a name and JSON-encoded arguments instead.
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	}
+	if err := json.Unmarshal(row.ToolCall[keys[0]], &body); err != nil {
+		return "", nil, false
+	}
+	tool := strings.TrimSuffix(keys[0], "ToolCall")
+	var args any = body.Args
+	switch {
+	case keys[0] == "function":
+		tool, args = body.Name, body.Arguments
+		if json.Valid([]byte(body.Arguments)) {
+			args = json.RawMessage(body.Arguments)
+		}
+	case len(body.Args) == 0:
+		args = map[string]any{}
+	}
+	payload := map[string]any{"call_id": row.CallID, "tool": tool}
+
+	switch row.Subtype {
+	case "started":
+		payload["status"] = "started"
+		payload["args"] = args
+		return events.EventKindToolCall, payload, true
+	case "completed":
+		payload["status"] = "completed"
+		if out, ok := body.Result["success"]; ok {
+			payload["output"] = out
+		} else {
+			for _, k := range []string{"error", "failure", "rejected"} {
+				if out, ok := body.Result[k]; ok {
+					payload["status"] = "failed"
+					payload["error"] = out
+					break
+				}
+			}
+		}
+		return events.EventKindToolOutput, payload, true
 	}
+	return "", nil, false
 }
 
 func cursorExtractText(row cursorNDJSONRow) string {
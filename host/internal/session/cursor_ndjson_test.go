@@ -2,12 +2,14 @@ package session
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ericbosch/cli-remote-control/host/internal/events"
 )
@@ -86,3 +88,218 @@ func TestCursorFixtureMapsAndDedupesAssistant(t *testing.T) {
 		t.Fatalf("assistant after dedupe=%d want=1", assistant)
 	}
 }
+
+// fakeCursorAgent puts a cursor-agent on PATH that answers each --print run with "echo: <message>"
+// in chat "chat-1" (or with the file named by $FAKE_CURSOR_NDJSON) and logs its arguments, one
+// run per line, to the returned file.
+func fakeCursorAgent(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	logPath := filepath.Join(t.TempDir(), "agent.args")
+	script := `#!/bin/sh
+if [ "$1" = --help ]; then echo "usage: cursor-agent [-p] [--output-format text|json|stream-json]"; exit 0; fi
+echo "$@" >> ` + logPath + `
+if [ -n "$FAKE_CURSOR_NDJSON" ]; then cat "$FAKE_CURSOR_NDJSON"; exit 0; fi
+for a; do msg=$a; done
+if [ "$msg" = slow ]; then sleep 30; fi
+sleep 0.1
+echo '{"type":"system","subtype":"init","session_id":"chat-1"}'
+printf '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"echo: %s"}]},"session_id":"chat-1"}\n' "$msg"
+echo '{"type":"result","subtype":"success","session_id":"chat-1"}'
+`
+	if err := os.WriteFile(filepath.Join(bin, "cursor-agent"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+// waitAssistant waits until s has published n assistant events and returns their texts.
+func waitAssistant(t *testing.T, s *Session, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var out []string
+		for _, ev := range s.ReplayEventsFromSeq(0) {
+			if ev.Kind != events.EventKindAssistant {
+				continue
+			}
+			var p struct {
+				Data string `json:"data"`
+			}
+			_ = json.Unmarshal(ev.Payload, &p)
+			out = append(out, p.Data)
+		}
+		if len(out) >= n {
+			return out
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("assistant events=%q, want %d", out, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCursorNDJSON_ResumesChat(t *testing.T) {
+	argsLog := fakeCursorAgent(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "cursor", "", map[string]interface{}{"prompt": "hello"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	waitAssistant(t, s, 1)
+
+	// Follow-ups sent while a run is in progress are queued and answered in order.
+	for _, msg := range []string{"second", "--resume other"} {
+		if err := s.WriteInput([]byte(msg)); err != nil {
+			t.Fatalf("input %q: %v", msg, err)
+		}
+	}
+	got := waitAssistant(t, s, 3)
+	if strings.Join(got, "|") != "echo: hello|echo: second|echo: --resume other" {
+		t.Fatalf("assistant=%q", got)
+	}
+	if state, _ := s.State(); state != "running" {
+		t.Fatalf("state=%s, want the chat to stay open between runs", state)
+	}
+	meta, _ := s.Info()["engine_meta"].(map[string]any)
+	if meta["cursor_chat_id"] != "chat-1" || meta["cursor_engine_mode"] != "structured" {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+
+	b, err := os.ReadFile(argsLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(runs) != 3 || strings.Contains(runs[0], "--resume") ||
+		!strings.HasSuffix(runs[1], "--resume chat-1 -- second") || !strings.HasSuffix(runs[2], "--resume chat-1 -- --resume other") {
+		t.Fatalf("runs=%q", runs)
+	}
+
+	s.Terminate()
+	waitExited(t, s)
+}
+
+func TestCursorNDJSON_RepeatedReplies(t *testing.T) {
+	fakeCursorAgent(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "cursor", "", map[string]interface{}{"prompt": "done?"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	waitAssistant(t, s, 1)
+	if err := s.WriteInput([]byte("done?")); err != nil {
+		t.Fatal(err)
+	}
+	// The second run answers exactly like the first; both replies are published.
+	if got := waitAssistant(t, s, 2); strings.Join(got, "|") != "echo: done?|echo: done?" {
+		t.Fatalf("assistant=%q", got)
+	}
+}
+
+func TestCursorNDJSON_StartsIdleWithoutPrompt(t *testing.T) {
+	fakeCursorAgent(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "cursor", "", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	if s.Engine != "cursor" {
+		t.Fatalf("engine=%s", s.Engine)
+	}
+	meta, _ := s.Info()["engine_meta"].(map[string]any)
+	if meta["cursor_engine_mode"] != "structured" {
+		t.Fatalf("engine_meta=%v, want structured mode without a prompt", meta)
+	}
+	if err := s.WriteInput([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if got := waitAssistant(t, s, 1); got[0] != "echo: hi" {
+		t.Fatalf("assistant=%q", got)
+	}
+}
+
+func TestCursorNDJSON_ToolsInitAndResult(t *testing.T) {
+	fakeCursorAgent(t)
+	t.Setenv("FAKE_CURSOR_NDJSON", filepath.Join(findRepoRoot(t), "fixtures", "cursor-tools.ndjson"))
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "cursor", "", map[string]interface{}{"prompt": "go"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	waitAssistant(t, s, 1)
+
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got = got[:0]
+		for _, ev := range s.ReplayEventsFromSeq(0) {
+			switch ev.Kind {
+			case events.EventKindSystem, events.EventKindToolCall, events.EventKindToolOutput, events.EventKindStatus:
+				got = append(got, string(ev.Kind)+" "+string(ev.Payload))
+			}
+		}
+		if len(got) > 0 && strings.Contains(got[len(got)-1], "turn_completed") || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := []string{
+		`system {"cwd":"/tmp/example","model":"Auto","permission_mode":"default","session_id":"sess-fixture-2","subtype":"init"}`,
+		`tool_call {"args":{"path":"README.md"},"call_id":"call-1","status":"started","tool":"read"}`,
+		`tool_output {"call_id":"call-1","output":{"content":"# example\n","isEmpty":false,"exceededLimit":false,"totalLines":1,"totalChars":10},"status":"completed","tool":"read"}`,
+		`tool_call {"args":{"command":"make test"},"call_id":"call-2","status":"started","tool":"shell"}`,
+		`tool_output {"call_id":"call-2","error":{"message":"make: *** No rule to make target 'test'."},"status":"failed","tool":"shell"}`,
+		`tool_call {"args":{"query":"make test"},"call_id":"call-3","status":"started","tool":"web_search"}`,
+		`status {"duration_ms":4200,"is_error":false,"request_id":"req-fixture-2","result":"success","state":"turn_completed"}`,
+	}
+	// The session's own "running" status comes first.
+	if len(got) > 0 && strings.Contains(got[0], `"running"`) {
+		got = got[1:]
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// The result row's usage and duration count towards the session's usage.
+	p := waitEvent(t, s, events.EventKindMetrics, "token_usage")
+	if p["request_id"] != "req-fixture-2" {
+		t.Fatalf("metrics=%v", p)
+	}
+	if got, want := s.Info()["usage"], (Usage{InputTokens: 2000, CachedInputTokens: 800, OutputTokens: 85, TotalTokens: 2085, DurationMS: 4200}); got != want {
+		t.Fatalf("usage=%+v want %+v", got, want)
+	}
+}
+
+func TestCursorNDJSON_LongLine(t *testing.T) {
+	fakeCursorAgent(t)
+	rows := filepath.Join(t.TempDir(), "long.ndjson")
+	long := strings.Repeat("x", cursorNDJSONMaxLine+1)
+	after := `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"after"}]},"session_id":"chat-1"}`
+	if err := os.WriteFile(rows, []byte(long+"\n"+after+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_CURSOR_NDJSON", rows)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "cursor", "", map[string]interface{}{"prompt": "go"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	if got := waitAssistant(t, s, 1); got[0] != "after" {
+		t.Fatalf("assistant=%q", got)
+	}
+	var skipped bool
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		if ev.Kind == events.EventKindError && strings.Contains(string(ev.Payload), "skipped") {
+			skipped = true
+		}
+	}
+	if !skipped {
+		t.Fatal("no error event for the overlong line")
+	}
+}
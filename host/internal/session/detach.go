@@ -0,0 +1,80 @@
+package session
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/ericbosch/cli-remote-control/host/internal/holder"
+	"github.com/ericbosch/cli-remote-control/host/internal/vt"
+)
+
+// reattachSession reconnects to the holder of a session that was running when the host stopped.
+// The session gets the manager's settings as if it had just been created. Output the holder
+// buffered while the host was down is only used to seed the replay buffer; it is not re-logged or
+// re-published as events.
+func reattachSession(rec registryRecord, conn *holder.Conn, logDir string, eventsDir string, bufKB int, opts sessionOptions) (*Session, error) {
+	s, err := newSessionBase(rec.ID, rec.Name, rec.Engine, rec.Created, logDir, eventsDir, bufKB, opts.logOpts, func() {})
+	if err != nil {
+		return nil, err
+	}
+	s.applyOptions(opts)
+	s.args, s.engineMeta, s.holderSock = rec.Args, rec.EngineMeta, rec.Holder
+	if rec.Usage != nil {
+		s.usage = *rec.Usage
+	}
+	// The PTY already runs in its sandbox; the options only apply to processes started later.
+	if sb, err := parseSandboxArgs(opts.sandbox, rec.Engine, rec.Args); err == nil {
+		s.sandbox = sb
+	} else {
+		log.Printf("session %s: sandbox options: %v", rec.ID, err)
+	}
+	if s.eventsStore != nil {
+		if tail, err := s.eventsStore.LoadTail(rec.ID, 2048); err == nil {
+			s.eventsBuf.Restore(tail)
+		} else {
+			log.Printf("events restore failed (session=%s): %v", rec.ID, err)
+		}
+	}
+	if s.cast != nil {
+		s.cast.recordInput, _ = rec.Args["record_input"].(bool)
+	}
+	// The holder's replay is a raw tail; the emulator recovers once the program redraws.
+	s.screen = vt.New(defaultCols, defaultRows, screenScrollback)
+	_, _ = s.screen.Write(conn.Replay())
+	s.ring.Write(conn.Replay())
+	s.proc = &ptyProc{s: s, term: conn}
+
+	go s.copyOutput(conn)
+	_, _ = s.PublishEvent(events.EventKindStatus, map[string]any{"state": "running", "reattached": true})
+	return s, nil
+}
+
+// holderExitCode returns the exit code a holder recorded for a session whose child exited while
+// the host was down.
+func holderExitCode(rec registryRecord) (int, bool) {
+	if rec.Holder == "" {
+		return 0, false
+	}
+	_, exitPath, _ := holder.Paths(filepath.Dir(rec.Holder), rec.ID)
+	code, err := holder.ReadExitFile(exitPath)
+	if err != nil {
+		return 0, false
+	}
+	return code, true
+}
+
+// cleanupHolder removes the exit file of a holder whose exit this session has observed.
+func (s *Session) cleanupHolder() {
+	if s.holderSock == "" {
+		return
+	}
+	removeHolderExit(s.holderSock, s.ID)
+}
+
+// removeHolderExit removes the exit file of the holder listening on sock.
+func removeHolderExit(sock, id string) {
+	_, exitPath, _ := holder.Paths(filepath.Dir(sock), id)
+	_ = os.Remove(exitPath)
+}
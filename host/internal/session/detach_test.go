@@ -0,0 +1,177 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/ericbosch/cli-remote-control/host/internal/holder"
+)
+
+// TestMain lets this test binary stand in for rc-host when a detached session spawns its holder
+// ("rc-host holder --spec <file>").
+func TestMain(m *testing.M) {
+	if len(os.Args) == 4 && os.Args[1] == "holder" && os.Args[2] == "--spec" {
+		if err := holder.RunSpecFile(os.Args[3]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// detachedHostDirs are the log, events and holder directories of a host rooted at dir.
+func detachedHostDirs(dir string) (logDir, eventsDir, holderDir string) {
+	return filepath.Join(dir, "logs"), filepath.Join(dir, "events"), filepath.Join(dir, "h")
+}
+
+// TestDetachedHost is not a test: it is the first host of TestDetachedSessionSurvivesRestart. It
+// starts a detached shell session, prints its id and exits without terminating it, like a host
+// that is stopped or crashes.
+func TestDetachedHost(t *testing.T) {
+	dir := os.Getenv("DETACHED_HOST_DIR")
+	if dir == "" {
+		t.Skip("first host for TestDetachedSessionSurvivesRestart")
+	}
+	logDir, eventsDir, holderDir := detachedHostDirs(dir)
+	m := NewManager(logDir, 8, eventsDir)
+	m.EnableDetached(holderDir)
+	s, err := m.Create(context.Background(), "shell", "detached", map[string]interface{}{"shell": "sh"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := s.WriteInput([]byte("echo before-$((1+1))\n")); err != nil {
+		t.Fatalf("input: %v", err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, "before-2")
+	fmt.Printf("session=%s\n", s.ID)
+	os.Exit(0)
+}
+
+func TestDetachedSessionSurvivesRestart(t *testing.T) {
+	requirePTY(t)
+	// Holder sockets live under dir; keep it short for the unix socket path limit.
+	dir, err := os.MkdirTemp("", "rch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDetachedHost$")
+	cmd.Env = append(os.Environ(), "DETACHED_HOST_DIR="+dir)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("first host: %v\n%s%s", err, out, stderr.String())
+	}
+	var id string
+	for sc := bufio.NewScanner(bytes.NewReader(out)); sc.Scan(); {
+		if v, ok := strings.CutPrefix(sc.Text(), "session="); ok {
+			id = v
+		}
+	}
+	if id == "" {
+		t.Fatalf("first host printed no session id:\n%s", out)
+	}
+
+	logDir, eventsDir, holderDir := detachedHostDirs(dir)
+	m := NewManager(logDir, 8, eventsDir)
+	m.EnableDetached(holderDir)
+	if err := m.Restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	s := m.Get(id)
+	if s == nil {
+		t.Fatalf("session %s not restored", id)
+	}
+	defer m.Terminate(id)
+	if state, _ := s.State(); state != "running" {
+		t.Fatalf("state=%s, want the session reattached", state)
+	}
+	if s.persist == nil || s.attach.root != m.attachmentDir(id) || s.Created.IsZero() {
+		t.Fatalf("reattached session lacks the manager settings: persist=%t attachments=%q created=%v", s.persist != nil, s.attach.root, s.Created)
+	}
+	if !strings.Contains(string(s.Replay(0)), "before-2") {
+		t.Fatalf("replay=%q, want the output from before the restart", s.Replay(0))
+	}
+
+	// Seqs continue from the events the first host persisted.
+	var beforeSeq, reattachedSeq uint64
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		switch {
+		case ev.Kind == events.EventKindAssistant && strings.Contains(string(ev.Payload), "before-2"):
+			beforeSeq = ev.Seq
+		case ev.Kind == events.EventKindStatus && strings.Contains(string(ev.Payload), `"reattached":true`):
+			reattachedSeq = ev.Seq
+		}
+	}
+	if beforeSeq == 0 || reattachedSeq <= beforeSeq {
+		t.Fatalf("seq of the output before the restart=%d, of the reattached status=%d", beforeSeq, reattachedSeq)
+	}
+
+	if err := s.WriteInput([]byte("echo after-$((2+2))\n")); err != nil {
+		t.Fatalf("input after restore: %v", err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, "after-4")
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		if ev.Kind == events.EventKindAssistant && strings.Contains(string(ev.Payload), "after-4") && ev.Seq <= reattachedSeq {
+			t.Fatalf("output after the restart has seq %d, want more than %d", ev.Seq, reattachedSeq)
+		}
+	}
+
+	if err := m.Terminate(id); err != nil {
+		t.Fatalf("terminate: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := holder.Dial(s.holderSock); err == holder.ErrNotRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("holder still running after terminate")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRestoreRecordsHolderExit(t *testing.T) {
+	dir := t.TempDir()
+	logDir, eventsDir, holderDir := detachedHostDirs(dir)
+	sock, exitPath, _ := holder.Paths(holderDir, "01EXITEDHOLDER")
+	if err := os.MkdirAll(holderDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(exitPath, []byte("7\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rec := registryRecord{ID: "01EXITEDHOLDER", Name: "gone", Engine: "shell", State: "running", Created: time.Now(), Holder: sock}
+	if err := newRegistry(eventsDir).save([]registryRecord{rec}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(logDir, 8, eventsDir)
+	m.EnableDetached(holderDir)
+	if err := m.Restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	s := m.Get(rec.ID)
+	if s == nil {
+		t.Fatal("session not restored")
+	}
+	if state, code := s.State(); state != "exited" || code != 7 {
+		t.Fatalf("state=%s code=%d, want the exit the holder recorded", state, code)
+	}
+	if _, err := os.Stat(exitPath); !os.IsNotExist(err) {
+		t.Fatalf("holder exit file kept after restore: %v", err)
+	}
+}
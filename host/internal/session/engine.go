@@ -0,0 +1,154 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownEngine is returned when a session is requested for an engine that is not registered.
+var ErrUnknownEngine = errors.New("unknown engine")
+
+// ErrUnsupported is returned by Process methods an engine does not implement.
+var ErrUnsupported = errors.New("operation not supported by engine")
+
+// ErrIdle is returned by Process.Interrupt when there is no operation to interrupt.
+var ErrIdle = errors.New("nothing to interrupt")
+
+// Engine is a CLI backend that sessions can be created with. Engines are looked up by name in an
+// EngineRegistry; GET /api/engines and POST /api/sessions are driven by the registry, so adding a
+// CLI agent only requires implementing Engine and registering it.
+type Engine interface {
+	// Name is the identifier clients use to select the engine (e.g. "shell", "codex").
+	Name() string
+	// Detect reports whether the engine can run on this host and what it supports.
+	// It must be cheap enough to call on every GET /api/engines.
+	Detect(ctx context.Context) EngineInfo
+	// Start launches the engine for s using the session creation args and returns the process
+	// controlling it. s already has its log and event stream set up.
+	Start(ctx context.Context, s *Session, args map[string]interface{}) (Process, error)
+}
+
+// Capabilities describes what an engine supports.
+type Capabilities struct {
+	PTY        bool `json:"pty"`        // raw terminal I/O; resize applies
+	Structured bool `json:"structured"` // emits assistant/thinking/tool events rather than raw output
+	Prompt     bool `json:"prompt"`     // accepts an initial prompt
+	Interrupt  bool `json:"interrupt"`  // can interrupt the current operation without ending the session
+}
+
+// EngineInfo is the result of Engine.Detect.
+type EngineInfo struct {
+	Name         string       `json:"name"`
+	Available    bool         `json:"available"`
+	Capabilities Capabilities `json:"capabilities"`
+	Detail       string       `json:"detail,omitempty"`
+}
+
+// Process controls the running engine behind one session.
+type Process interface {
+	// SendInput delivers user input: raw bytes for PTY engines, a message for structured ones.
+	SendInput(data []byte) error
+	// Interrupt stops the current operation without ending the session.
+	Interrupt() error
+	// Stop ends the process.
+	Stop() error
+	// Wait blocks until the process has exited and returns its exit code.
+	Wait() (exitCode int, err error)
+}
+
+// Resizer is implemented by processes attached to a PTY.
+type Resizer interface {
+	Resize(cols, rows int) error
+}
+
+// Approver is implemented by processes whose agent asks the user to approve actions; see
+// Session.Approve.
+type Approver interface {
+	Approve(id, decision string) error
+}
+
+// TurnOptions change the model settings of a structured session from one message on, and attach
+// uploaded files to the message. Empty fields keep the current setting.
+type TurnOptions struct {
+	Model  string
+	Effort string
+	// Attachments are ids of the session's attachments (see Session.AddAttachment).
+	Attachments []string
+}
+
+// TurnConfigurer is implemented by processes whose model settings can change between messages;
+// see Session.WriteTurn.
+type TurnConfigurer interface {
+	SendTurn(data []byte, opts TurnOptions) error
+}
+
+// EngineRegistry maps engine names to engines.
+type EngineRegistry struct {
+	mu      sync.RWMutex
+	engines map[string]Engine
+}
+
+// NewEngineRegistry returns an empty registry.
+func NewEngineRegistry() *EngineRegistry {
+	return &EngineRegistry{engines: make(map[string]Engine)}
+}
+
+// Register adds e, replacing any engine with the same name.
+func (r *EngineRegistry) Register(e Engine) {
+	r.mu.Lock()
+	r.engines[e.Name()] = e
+	r.mu.Unlock()
+}
+
+// Get returns the engine registered under name.
+func (r *EngineRegistry) Get(name string) (Engine, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.engines[name]
+	return e, ok
+}
+
+// List returns all registered engines sorted by name, with shell first (the safe default).
+func (r *EngineRegistry) List() []Engine {
+	r.mu.RLock()
+	out := make([]Engine, 0, len(r.engines))
+	for _, e := range r.engines {
+		out = append(out, e)
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].Name() == "shell") != (out[j].Name() == "shell") {
+			return out[i].Name() == "shell"
+		}
+		return out[i].Name() < out[j].Name()
+	})
+	return out
+}
+
+// Detect runs Detect for every registered engine.
+func (r *EngineRegistry) Detect(ctx context.Context) []EngineInfo {
+	list := r.List()
+	out := make([]EngineInfo, 0, len(list))
+	for _, e := range list {
+		out = append(out, e.Detect(ctx))
+	}
+	return out
+}
+
+var builtinEngines = NewEngineRegistry()
+
+// registerBuiltin is called from init functions of the built-in engines.
+func registerBuiltin(e Engine) {
+	builtinEngines.Register(e)
+}
+
+// DefaultEngines returns a new registry with the built-in engines (shell, codex, cursor).
+func DefaultEngines() *EngineRegistry {
+	r := NewEngineRegistry()
+	for _, e := range builtinEngines.List() {
+		r.Register(e)
+	}
+	return r
+}
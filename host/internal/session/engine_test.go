@@ -0,0 +1,155 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+// echoEngine is a minimal in-process engine: every input is echoed back as an assistant event.
+type echoEngine struct{}
+
+func (echoEngine) Name() string { return "echo" }
+
+func (echoEngine) Detect(context.Context) EngineInfo {
+	return EngineInfo{Name: "echo", Available: true, Capabilities: Capabilities{Structured: true}}
+}
+
+func (echoEngine) Start(_ context.Context, s *Session, _ map[string]interface{}) (Process, error) {
+	s.SetEngineMeta(map[string]any{"echo": true})
+	return &echoProc{s: s, stop: make(chan struct{})}, nil
+}
+
+type echoProc struct {
+	s    *Session
+	stop chan struct{}
+}
+
+func (p *echoProc) SendInput(data []byte) error {
+	_, err := p.s.PublishEvent(events.EventKindAssistant, map[string]any{"data": string(data)})
+	return err
+}
+
+func (p *echoProc) Interrupt() error { return ErrUnsupported }
+
+func (p *echoProc) Stop() error {
+	close(p.stop)
+	return nil
+}
+
+func (p *echoProc) Wait() (int, error) {
+	<-p.stop
+	return 0, nil
+}
+
+func TestManager_CustomEngineFromRegistry(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.Engines().Register(echoEngine{})
+
+	s, err := m.Create(context.Background(), "echo", "e", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	ch := s.SubscribeEvents()
+	defer s.UnsubscribeEvents(ch)
+	if err := s.WriteInput([]byte("hi")); err != nil {
+		t.Fatalf("input: %v", err)
+	}
+	select {
+	case ev := <-ch:
+		var p struct {
+			Data string `json:"data"`
+		}
+		_ = json.Unmarshal(ev.Payload, &p)
+		if ev.Kind != events.EventKindAssistant || p.Data != "hi" {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for echo")
+	}
+	if meta, _ := s.Info()["engine_meta"].(map[string]any); meta["echo"] != true {
+		t.Fatalf("engine_meta=%v", s.Info()["engine_meta"])
+	}
+
+	if err := m.Terminate(s.ID); err != nil {
+		t.Fatalf("terminate: %v", err)
+	}
+	if state, _ := s.State(); state != "exited" {
+		t.Fatalf("state=%s want exited", state)
+	}
+}
+
+func TestManager_UnknownEngine(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	if _, err := m.Create(context.Background(), "nope", "", nil); !errors.Is(err, ErrUnknownEngine) {
+		t.Fatalf("create err=%v want ErrUnknownEngine", err)
+	}
+}
+
+// Info() is encoded while engines keep reporting engine_meta; run with -race.
+func TestSession_EngineMetaWhileEncodingInfo(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.Engines().Register(echoEngine{})
+	s, err := m.Create(context.Background(), "echo", "e", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer m.Terminate(s.ID)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			s.SetEngineMeta(map[string]any{"turn": i})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		if _, err := json.Marshal(s.Info()); err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		m.persist()
+	}
+	<-done
+	if meta, _ := s.Info()["engine_meta"].(map[string]any); meta["turn"] != 199 || meta["echo"] != true {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+}
+
+func TestPublishEventWhileSessionExits(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.Engines().Register(echoEngine{})
+	for i := 0; i < 20; i++ {
+		s, err := m.Create(context.Background(), "echo", "", nil)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		ch := s.SubscribeEvents()
+		stop := make(chan struct{})
+		published := make(chan struct{})
+		go func() {
+			defer close(published)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, _ = s.PublishEvent(events.EventKindAssistant, map[string]any{"data": "x"})
+				s.broadcastEvent(events.EventKindStatus, map[string]any{"state": "x"})
+			}
+		}()
+		go func() {
+			for range ch {
+			}
+		}()
+		_ = m.Terminate(s.ID)
+		<-s.Done()
+		close(stop)
+		<-published
+	}
+}
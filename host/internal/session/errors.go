@@ -4,4 +4,8 @@ import "errors"
 
 var (
 	ErrNotFound = errors.New("session not found")
+	// ErrSessionExists is returned when a session ID already has a log or events file on disk.
+	ErrSessionExists = errors.New("session files already exist")
+	// ErrInvalidArgs is wrapped by engines when session creation args are malformed or not allowed.
+	ErrInvalidArgs = errors.New("invalid session args")
 )
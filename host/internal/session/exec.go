@@ -0,0 +1,320 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/ericbosch/cli-remote-control/host/internal/policy"
+)
+
+func init() {
+	registerBuiltin(execEngine{})
+}
+
+// timedOutExitCode is reported for jobs killed by their timeout, like timeout(1).
+const timedOutExitCode = 124
+
+// execDrainTimeout bounds how long a finished job's output is read while a process that left the
+// job's process group still holds the pipes open.
+const execDrainTimeout = 2 * time.Second
+
+// execEngine runs a non-interactive job without a PTY: stdout and stderr are published as
+// separate output streams and the exit code, duration and whether the timeout fired are recorded
+// in engine_meta when the job ends.
+type execEngine struct{}
+
+func (execEngine) Name() string { return "exec" }
+
+func (execEngine) Detect(context.Context) EngineInfo {
+	info := EngineInfo{Name: "exec", Capabilities: Capabilities{Interrupt: true}}
+	if _, err := exec.LookPath("sh"); err == nil {
+		info.Available = true
+	} else {
+		info.Detail = "sh not found on PATH"
+	}
+	return info
+}
+
+// execOptions are the args accepted by the exec engine:
+//
+//	command          a command line run with sh -c
+//	argv             the program and its arguments, run directly (instead of command)
+//	timeout_seconds  kill the job after this many seconds (default: no timeout)
+//	env              extra environment variables (object of strings)
+type execOptions struct {
+	Command   string
+	Argv      []string
+	Timeout   time.Duration
+	Env       map[string]string
+	Workspace string
+}
+
+func parseExecOptions(args map[string]interface{}) (execOptions, error) {
+	var opts execOptions
+	if v, ok := args["command"]; ok {
+		cmd, ok := v.(string)
+		if !ok {
+			return opts, fmt.Errorf("%w: command must be a string", ErrInvalidArgs)
+		}
+		opts.Command = strings.TrimSpace(cmd)
+	}
+	if v, ok := args["argv"]; ok && v != nil {
+		list, ok := v.([]interface{})
+		if !ok {
+			return opts, fmt.Errorf("%w: argv must be an array of strings", ErrInvalidArgs)
+		}
+		for _, a := range list {
+			str, ok := a.(string)
+			if !ok {
+				return opts, fmt.Errorf("%w: argv must be an array of strings", ErrInvalidArgs)
+			}
+			opts.Argv = append(opts.Argv, str)
+		}
+	}
+	if (opts.Command == "") == (len(opts.Argv) == 0) {
+		return opts, fmt.Errorf("%w: exactly one of command or argv is required", ErrInvalidArgs)
+	}
+	if len(opts.Argv) > 0 && opts.Argv[0] == "" {
+		return opts, fmt.Errorf("%w: argv[0] must not be empty", ErrInvalidArgs)
+	}
+	if v, ok := args["timeout_seconds"]; ok && v != nil {
+		secs, ok := v.(float64)
+		if !ok || secs < 0 {
+			return opts, fmt.Errorf("%w: timeout_seconds must be a non-negative number", ErrInvalidArgs)
+		}
+		opts.Timeout = time.Duration(secs * float64(time.Second))
+	}
+	env, err := parseEnvArg(args)
+	if err != nil {
+		return opts, err
+	}
+	opts.Env = env
+	opts.Workspace, _ = args["workspacePath"].(string)
+	return opts, nil
+}
+
+func (execEngine) Start(ctx context.Context, s *Session, args map[string]interface{}) (Process, error) {
+	opts, err := parseExecOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	return startExec(ctx, s, opts)
+}
+
+func startExec(ctx context.Context, s *Session, opts execOptions) (Process, error) {
+	argv := opts.Argv
+	if opts.Command != "" {
+		argv = []string{"sh", "-c", opts.Command}
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if opts.Workspace != "" {
+		cmd.Dir = opts.Workspace
+	}
+	// Run the job in its own process group so a timeout or Stop also kills its children.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	env := os.Environ()
+	envKeys := make([]string, 0, len(opts.Env))
+	for k, v := range opts.Env {
+		env = append(env, k+"="+v)
+		envKeys = append(envKeys, k)
+	}
+	sort.Strings(envKeys)
+	env, removed := policy.EngineEnv(env)
+	cmd.Env = env
+
+	// Plain pipes rather than cmd.StdoutPipe: Wait must not depend on the job's children closing
+	// them (see execProc.Wait).
+	stdout, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, stderrW, err := os.Pipe()
+	if err != nil {
+		stdout.Close()
+		stdoutW.Close()
+		return nil, err
+	}
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	closeAll := func() {
+		for _, f := range []*os.File{stdout, stdoutW, stderr, stderrW} {
+			f.Close()
+		}
+	}
+	if err := s.prepareCmd(cmd); err != nil {
+		closeAll()
+		return nil, err
+	}
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		closeAll()
+		return nil, err
+	}
+	stdoutW.Close()
+	stderrW.Close()
+	s.trackProcess(cmd.Process.Pid)
+
+	meta := map[string]any{}
+	if opts.Command != "" {
+		meta["command"] = opts.Command
+	} else {
+		meta["argv"] = opts.Argv
+	}
+	if opts.Timeout > 0 {
+		meta["timeout_seconds"] = opts.Timeout.Seconds()
+	}
+	if len(envKeys) > 0 {
+		// Only names are reported; values may be sensitive.
+		meta["env"] = envKeys
+	}
+	if dropped := intersect(envKeys, removed); len(dropped) > 0 {
+		meta["env_removed"] = dropped
+	}
+	s.SetEngineMeta(meta)
+
+	p := &execProc{s: s, cmd: cmd, started: started, stopped: make(chan struct{}), outputs: []*os.File{stdout, stderr}}
+	p.readers.Add(2)
+	go p.copyStream(stdout, "stdout")
+	go p.copyStream(stderr, "stderr")
+	go p.watch(ctx, opts.Timeout)
+	return p, nil
+}
+
+// execProc is the Process of a job. It takes no input.
+type execProc struct {
+	s       *Session
+	cmd     *exec.Cmd
+	started time.Time
+	outputs []*os.File // read ends of stdout and stderr
+	readers sync.WaitGroup
+
+	mu       sync.Mutex
+	timedOut bool
+	stopped  chan struct{} // closed once the job has exited
+	outMu    sync.Mutex    // serializes output from the two streams
+}
+
+func (p *execProc) SendInput([]byte) error { return ErrUnsupported }
+
+func (p *execProc) Interrupt() error { return p.signal(syscall.SIGINT) }
+
+func (p *execProc) Stop() error { return p.signal(syscall.SIGKILL) }
+
+// signal sends sig to the job's process group.
+func (p *execProc) signal(sig syscall.Signal) error {
+	if p.cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-p.cmd.Process.Pid, sig)
+}
+
+// watch kills the job when its timeout expires or the session context is cancelled.
+func (p *execProc) watch(ctx context.Context, timeout time.Duration) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case <-p.stopped:
+	case <-ctx.Done():
+		_ = p.Stop()
+	case <-expired:
+		p.mu.Lock()
+		p.timedOut = true
+		p.mu.Unlock()
+		_, _ = p.s.PublishEvent(events.EventKindError, map[string]any{"message": fmt.Sprintf("job timed out after %s", timeout)})
+		_ = p.Stop()
+	}
+}
+
+// copyStream publishes the output of one stream as assistant events tagged with stream, keeping
+// multi-byte characters split across reads together.
+func (p *execProc) copyStream(r io.Reader, stream string) {
+	defer p.readers.Done()
+	buf := make([]byte, 4096)
+	var carry []byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			data := append(carry, buf[:n]...)
+			cut := len(data) - incompleteUTF8Suffix(data)
+			carry = append([]byte(nil), data[cut:]...)
+			p.emit(stream, data[:cut])
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, os.ErrClosed) {
+				log.Printf("session %s %s read error: %v", p.s.ID, stream, err)
+			}
+			p.emit(stream, carry)
+			return
+		}
+	}
+}
+
+func (p *execProc) emit(stream string, chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	p.outMu.Lock()
+	defer p.outMu.Unlock()
+	p.s.WriteOutput(chunk)
+	_, _ = p.s.PublishEvent(events.EventKindAssistant, map[string]any{
+		"stream": stream,
+		"data":   string(chunk),
+	})
+}
+
+// Wait waits for the job's process, then kills what it left running in its process group (a
+// backgrounded `sleep 1000 &` would otherwise hold the output open) and reads the rest of the
+// output.
+func (p *execProc) Wait() (int, error) {
+	err := p.cmd.Wait()
+	_ = p.signal(syscall.SIGKILL)
+	drained := make(chan struct{})
+	go func() {
+		p.readers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(execDrainTimeout):
+		for _, f := range p.outputs {
+			f.Close()
+		}
+		<-drained
+	}
+	for _, f := range p.outputs {
+		f.Close()
+	}
+	close(p.stopped)
+	code := exitCodeOf(err)
+	p.mu.Lock()
+	timedOut := p.timedOut
+	p.mu.Unlock()
+	if timedOut {
+		code = timedOutExitCode
+	}
+	result := map[string]any{
+		"exit_code":   code,
+		"duration_ms": time.Since(p.started).Milliseconds(),
+		"timed_out":   timedOut,
+	}
+	p.s.SetEngineMeta(result)
+	_, _ = p.s.PublishEvent(events.EventKindMetrics, result)
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return code, err
+	}
+	return code, nil
+}
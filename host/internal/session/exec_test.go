@@ -0,0 +1,144 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+func TestParseExecOptions(t *testing.T) {
+	bad := []map[string]interface{}{
+		{},
+		{"command": "ls", "argv": []interface{}{"ls"}},
+		{"argv": []interface{}{"ls", 1}},
+		{"argv": []interface{}{""}},
+		{"command": "ls", "timeout_seconds": -1},
+		{"command": "ls", "timeout_seconds": "10"},
+	}
+	for _, args := range bad {
+		if _, err := parseExecOptions(args); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("args=%v err=%v want ErrInvalidArgs", args, err)
+		}
+	}
+	opts, err := parseExecOptions(map[string]interface{}{"argv": []interface{}{"make", "test"}, "timeout_seconds": 1.5})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(opts.Argv) != 2 || opts.Timeout != 1500*time.Millisecond {
+		t.Fatalf("opts=%+v", opts)
+	}
+}
+
+// waitExited waits for s to exit and returns its exit code.
+func waitExited(t *testing.T, s *Session) int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if state, code := s.State(); state == "exited" {
+			return code
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job did not exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecEngine_StreamsAndExitCode(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "exec", "job", map[string]interface{}{
+		"command": "echo out; echo err >&2; exit 3",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if code := waitExited(t, s); code != 3 {
+		t.Fatalf("exit code=%d", code)
+	}
+	streams := map[string]string{}
+	for _, ev := range s.ReplayEventsLastN(100) {
+		if ev.Kind != events.EventKindAssistant {
+			continue
+		}
+		var p struct {
+			Stream string `json:"stream"`
+			Data   string `json:"data"`
+		}
+		_ = json.Unmarshal(ev.Payload, &p)
+		streams[p.Stream] += p.Data
+	}
+	if streams["stdout"] != "out\n" || streams["stderr"] != "err\n" {
+		t.Fatalf("streams=%q", streams)
+	}
+	meta, _ := s.Info()["engine_meta"].(map[string]any)
+	if meta["exit_code"] != 3 || meta["timed_out"] != false || meta["command"] == nil {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+	if _, ok := meta["duration_ms"].(int64); !ok {
+		t.Fatalf("duration_ms=%v", meta["duration_ms"])
+	}
+}
+
+func TestExecEngine_Timeout(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "exec", "", map[string]interface{}{
+		"argv":            []interface{}{"sh", "-c", "sleep 30 & wait"},
+		"timeout_seconds": 0.2,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if code := waitExited(t, s); code != timedOutExitCode {
+		t.Fatalf("exit code=%d", code)
+	}
+	meta, _ := s.Info()["engine_meta"].(map[string]any)
+	if meta["timed_out"] != true {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+}
+
+func TestExecEngine_BackgroundChildDoesNotHoldJob(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "exec", "", map[string]interface{}{
+		"command": "sleep 1000 & echo started",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	start := time.Now()
+	if code := waitExited(t, s); code != 0 {
+		t.Fatalf("exit code=%d", code)
+	}
+	if d := time.Since(start); d > execDrainTimeout {
+		t.Fatalf("job took %s to complete", d)
+	}
+	if out := string(s.Replay(0)); out != "started\n" {
+		t.Fatalf("output=%q", out)
+	}
+}
+
+// The job result lands in engine_meta while clients list the session; run with -race.
+func TestExecEngine_ResultWhileListing(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "exec", "job", map[string]interface{}{"command": "true"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for {
+		if _, err := json.Marshal(s.Info()); err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		if state, _ := s.State(); state == "exited" {
+			break
+		}
+	}
+	waitExited(t, s)
+	if meta, _ := s.Info()["engine_meta"].(map[string]any); meta["exit_code"] != 0 {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet used by ULIDs (no I, L, O, U).
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// idGenerator produces ULID-style session IDs: a 48-bit millisecond timestamp followed by
+// 80 random bits, encoded as 26 Crockford base32 characters. IDs sort lexically by creation
+// time and stay unique across host restarts. Within the same millisecond the random part is
+// incremented so IDs remain strictly increasing.
+type idGenerator struct {
+	mu     sync.Mutex
+	lastMS uint64
+	last   [10]byte
+}
+
+func (g *idGenerator) next(now time.Time) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(now.UnixMilli())
+	if ms <= g.lastMS {
+		ms = g.lastMS
+		if !incrementBytes(g.last[:]) {
+			// Random part overflowed within one millisecond; borrow the next one.
+			ms++
+			if _, err := rand.Read(g.last[:]); err != nil {
+				return "", err
+			}
+		}
+	} else if _, err := rand.Read(g.last[:]); err != nil {
+		return "", err
+	}
+	g.lastMS = ms
+
+	var raw [16]byte
+	raw[0] = byte(ms >> 40)
+	raw[1] = byte(ms >> 32)
+	raw[2] = byte(ms >> 24)
+	raw[3] = byte(ms >> 16)
+	raw[4] = byte(ms >> 8)
+	raw[5] = byte(ms)
+	copy(raw[6:], g.last[:])
+	return encodeULID(raw), nil
+}
+
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID renders 128 bits as 26 base32 characters (the first carries only 3 bits).
+func encodeULID(raw [16]byte) string {
+	var out [26]byte
+	// Walk the 130-bit big-endian value (two leading zero bits) five bits at a time.
+	for i := 0; i < 26; i++ {
+		bit := i*5 - 2
+		v := 0
+		for j := 0; j < 5; j++ {
+			v <<= 1
+			pos := bit + j
+			if pos < 0 {
+				continue
+			}
+			if raw[pos/8]&(0x80>>(pos%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockford[v]
+	}
+	return string(out[:])
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+func TestInterrupt_PTY(t *testing.T) {
+	requirePTY(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "shell", "", map[string]interface{}{"shell": "sh"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	if err := s.WriteInput([]byte("sleep 30; echo slept\n")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := s.Interrupt(); err != nil {
+		t.Fatalf("interrupt: %v", err)
+	}
+	waitEvent(t, s, events.EventKindStatus, `"interrupted"`)
+	if err := s.WriteInput([]byte("echo after-$((1+1))\n")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(s.Replay(0)), "after-2") {
+		if time.Now().After(deadline) {
+			t.Fatalf("shell still busy after interrupt; output=%q", s.Replay(0))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if strings.Contains(string(s.Replay(0)), "\nslept\r\n") {
+		t.Fatalf("SIGINT did not stop the foreground command: %q", s.Replay(0))
+	}
+}
+
+func TestInterrupt_Codex(t *testing.T) {
+	fakeCodex(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "codex", "", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	if err := s.Interrupt(); !errors.Is(err, ErrIdle) {
+		t.Fatalf("interrupt without a turn: err=%v", err)
+	}
+	if err := s.WriteInput([]byte("wait")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Interrupt(); err != nil {
+		t.Fatalf("interrupt: %v", err)
+	}
+	waitEvent(t, s, events.EventKindStatus, `"interrupted"`)
+	waitEvent(t, s, events.EventKindThinkingDone, "")
+	// The thread survives: the next message is a new turn.
+	if err := s.WriteInput([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, s, events.EventKindAssistant, "echo: hello")
+	if state, _ := s.State(); state != "running" {
+		t.Fatalf("state=%s", state)
+	}
+}
+
+func TestInterrupt_Cursor(t *testing.T) {
+	fakeCursorAgent(t)
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "cursor", "", map[string]interface{}{"prompt": "slow"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	if err := s.WriteInput([]byte("queued")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Interrupt(); err != nil {
+		t.Fatalf("interrupt: %v", err)
+	}
+	waitEvent(t, s, events.EventKindStatus, `"interrupted"`)
+	// The killed run is not reported as a failure and the queued message is dropped.
+	if err := s.WriteInput([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	got := waitAssistant(t, s, 1)
+	if len(got) != 1 || got[0] != "echo: next" {
+		t.Fatalf("assistant=%q", got)
+	}
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		if ev.Kind == events.EventKindError {
+			t.Fatalf("unexpected error event %s", ev.Payload)
+		}
+	}
+}
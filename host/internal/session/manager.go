@@ -2,20 +2,39 @@ package session
 
 import (
 	"context"
+	"log"
+	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"sync"
-	"sync/atomic"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/holder"
+	"github.com/ericbosch/cli-remote-control/host/internal/limits"
+	"github.com/ericbosch/cli-remote-control/host/internal/logrotate"
+	"github.com/ericbosch/cli-remote-control/host/internal/sandbox"
 )
 
 // Manager creates and tracks sessions.
 type Manager struct {
 	mu        sync.RWMutex
 	sessions  map[string]*Session
-	counter   atomic.Uint64
+	starting  map[string]bool // ids whose files are claimed but that are not in sessions yet
+	ids       idGenerator
 	logDir    string
 	eventsDir string
 	bufKB     int
+	registry  *registry
+	persistMu sync.Mutex // orders snapshots with their writes, so an older one is never saved last
+	holderDir string
+	engines   *EngineRegistry
+	logOpts   logrotate.Options
+	limitCtl  *limits.Controller
+	limits    limits.Limits
+	sandbox   sandbox.Policy
+	codex     CodexPolicy
+	usage     *usageLedger
+	attach    attachmentLimits
 }
 
 // NewManager creates a session manager. bufKB is the ring buffer size per session in KB.
@@ -28,16 +47,197 @@ func NewManager(logDir string, bufKB int, eventsDir string) *Manager {
 	}
 	return &Manager{
 		sessions:  make(map[string]*Session),
+		starting:  make(map[string]bool),
 		logDir:    logDir,
 		eventsDir: eventsDir,
 		bufKB:     bufKB,
+		registry:  newRegistry(eventsDir),
+		usage:     newUsageLedger(eventsDir),
+		attach:    attachmentLimits{maxBytes: DefaultAttachmentMaxBytes, quota: DefaultAttachmentQuota},
+		engines:   DefaultEngines(),
+	}
+}
+
+// Engines returns the registry sessions are created from. Engines registered on it become
+// available to Create.
+func (m *Manager) Engines() *EngineRegistry {
+	return m.engines
+}
+
+// EnableDetached makes new PTY sessions run under a detached holder process with its socket in
+// dir, so they survive host restarts. Restore reconnects to holders that are still alive.
+func (m *Manager) EnableDetached(dir string) {
+	m.mu.Lock()
+	m.holderDir = dir
+	m.mu.Unlock()
+}
+
+// SetLogRotation sets how the logs of sessions created (or reattached) from now on are rotated.
+func (m *Manager) SetLogRotation(opts logrotate.Options) {
+	m.mu.Lock()
+	m.logOpts = opts
+	m.mu.Unlock()
+}
+
+// SetResourceLimits sets the controller sessions' resource limits are enforced with (nil: rlimits
+// only) and the default limits of new sessions, which args.limits overrides per session.
+func (m *Manager) SetResourceLimits(ctl *limits.Controller, defaults limits.Limits) {
+	m.mu.Lock()
+	m.limitCtl, m.limits = ctl, defaults
+	m.mu.Unlock()
+}
+
+// SetSandbox sets the sandbox policy of new sessions.
+func (m *Manager) SetSandbox(p sandbox.Policy) {
+	m.mu.Lock()
+	m.sandbox = p
+	m.mu.Unlock()
+}
+
+// SetCodexPolicy sets the codex settings new codex sessions may choose.
+func (m *Manager) SetCodexPolicy(p CodexPolicy) {
+	m.mu.Lock()
+	m.codex = p
+	m.mu.Unlock()
+}
+
+// SetAttachmentLimits sets the size limits on the uploads of new sessions: maxBytes per file and
+// quota for all files of a session.
+func (m *Manager) SetAttachmentLimits(maxBytes, quota int64) {
+	m.mu.Lock()
+	m.attach = attachmentLimits{maxBytes: maxBytes, quota: quota}
+	m.mu.Unlock()
+}
+
+func (m *Manager) attachmentDir(id string) string {
+	return filepath.Join(m.eventsDir, "attachments", id)
+}
+
+// removeAttachments deletes the uploads of session id. They are only of use while it runs.
+func (m *Manager) removeAttachments(id string) {
+	if err := os.RemoveAll(m.attachmentDir(id)); err != nil {
+		log.Printf("session %s: remove attachments: %v", id, err)
+	}
+}
+
+// pruneAttachments deletes the uploads of every session that is not running, e.g. those left
+// by sessions that were still running when the host stopped.
+func (m *Manager) pruneAttachments() {
+	entries, err := os.ReadDir(filepath.Join(m.eventsDir, "attachments"))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if s := m.Get(e.Name()); s != nil {
+			if state, _ := s.State(); state == "running" {
+				continue
+			}
+		}
+		m.removeAttachments(e.Name())
+	}
+}
+
+// RunLogJanitor enforces retention on the log directory every interval until ctx is done. The
+// live files of running sessions, and of sessions still being created, are never deleted.
+func (m *Manager) RunLogJanitor(ctx context.Context, retention logrotate.Retention, interval time.Duration) {
+	j := &logrotate.Janitor{
+		Dir:       m.logDir,
+		Retention: retention,
+		Active:    m.activeIDs,
+	}
+	j.Run(ctx, interval)
+}
+
+// activeIDs returns the ids of sessions that are running or being created.
+func (m *Manager) activeIDs() map[string]bool {
+	m.mu.RLock()
+	ids := make(map[string]bool, len(m.sessions)+len(m.starting))
+	for id := range m.starting {
+		ids[id] = true
+	}
+	list := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		list = append(list, s)
+	}
+	m.mu.RUnlock()
+	for _, s := range list {
+		if state, _ := s.State(); state != "exited" {
+			ids[s.ID] = true
+		}
+	}
+	return ids
+}
+
+// Restore loads the session registry written by a previous run of the host. Restored sessions are
+// listed as exited and replay their persisted event history; they are never restarted. Sessions
+// whose detached holder is still alive are reattached and keep running.
+func (m *Manager) Restore() error {
+	recs, err := m.registry.load()
+	if err != nil {
+		return err
+	}
+	// Holders are dialed without m.mu held; a dial may wait on an unresponsive socket.
+	m.mu.RLock()
+	var todo []registryRecord
+	for _, rec := range recs {
+		if _, ok := m.sessions[rec.ID]; rec.ID != "" && !ok {
+			todo = append(todo, rec)
+		}
+	}
+	m.mu.RUnlock()
+	restored := make([]*Session, 0, len(todo))
+	for _, rec := range todo {
+		if rec.State == "running" && rec.Holder != "" {
+			if conn, err := holder.Dial(rec.Holder); err == nil {
+				s, err := reattachSession(rec, conn, m.logDir, m.eventsDir, m.bufKB, m.sessionOptions(rec.ID))
+				if err == nil {
+					s.reopenLimits(m.limitCtl)
+					restored = append(restored, s)
+					continue
+				}
+				conn.Close()
+				log.Printf("reattach session %s failed: %v", rec.ID, err)
+			}
+		}
+		restored = append(restored, restoreSession(rec, m.logDir, m.eventsDir, m.bufKB))
+	}
+	var live []*Session
+	m.mu.Lock()
+	for _, s := range restored {
+		if _, ok := m.sessions[s.ID]; ok {
+			continue
+		}
+		m.sessions[s.ID] = s
+		if s.proc != nil {
+			live = append(live, s)
+		}
+	}
+	m.mu.Unlock()
+	for _, s := range live {
+		go m.run(s)
+	}
+	m.pruneAttachments()
+	// Records of sessions that were running when the host stopped are rewritten as exited.
+	if len(recs) > 0 {
+		m.persist()
 	}
+	return nil
+}
+
+// sessionOptions returns the manager settings a session with the given ID is created with.
+func (m *Manager) sessionOptions(id string) sessionOptions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return sessionOptions{holderDir: m.holderDir, logOpts: m.logOpts, limitCtl: m.limitCtl, limits: m.limits, sandbox: m.sandbox, codex: m.codex, usage: m.usage, persist: m.persist,
+		attachDir: m.attachmentDir(id), attach: m.attach}
 }
 
 // Create starts a new session with the given engine and optional name.
 func (m *Manager) Create(ctx context.Context, engine, name string, args map[string]interface{}) (*Session, error) {
-	id := m.nextID()
-	sid := idString(id)
+	sid, err := m.ids.next(time.Now())
+	if err != nil {
+		return nil, err
+	}
 	if name == "" {
 		name = "session-" + sid
 	}
@@ -45,14 +245,26 @@ func (m *Manager) Create(ctx context.Context, engine, name string, args map[stri
 	if ctx != nil {
 		sessCtx = context.WithoutCancel(ctx)
 	}
-	s, err := NewSession(sessCtx, sid, name, engine, args, m.logDir, m.eventsDir, m.bufKB)
+	m.mu.Lock()
+	m.starting[sid] = true
+	m.mu.Unlock()
+	s, err := newSession(sessCtx, m.engines, sid, name, engine, args, m.logDir, m.eventsDir, m.bufKB, m.sessionOptions(sid))
 	if err != nil {
+		m.mu.Lock()
+		delete(m.starting, sid)
+		m.mu.Unlock()
+		m.removeAttachments(sid)
 		return nil, err
 	}
+	s.mu.Lock()
+	s.args = args
+	s.mu.Unlock()
 	m.mu.Lock()
+	delete(m.starting, sid)
 	m.sessions[sid] = s
 	m.mu.Unlock()
-	go s.Run()
+	m.persist()
+	go m.run(s)
 	return s, nil
 }
 
@@ -74,6 +286,32 @@ func (m *Manager) List() []*Session {
 	return out
 }
 
+// RecordingPath returns the asciicast recording of session id. Recordings outlive the session
+// entry, so terminated sessions can still be downloaded as long as the file exists.
+func (m *Manager) RecordingPath(id string) (string, error) {
+	if !validSessionID(id) {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(m.logDir, id+".cast")
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// validSessionID reports whether id is safe to use in file names (ULIDs and legacy IDs).
+func validSessionID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 // Terminate stops a session and removes it from the manager.
 func (m *Manager) Terminate(id string) error {
 	m.mu.Lock()
@@ -83,13 +321,28 @@ func (m *Manager) Terminate(id string) error {
 	if s == nil {
 		return ErrNotFound
 	}
-	return s.Terminate()
+	err := s.Terminate()
+	m.removeAttachments(id)
+	m.persist()
+	return err
 }
 
-func (m *Manager) nextID() uint64 {
-	return m.counter.Add(1)
+// run waits for s to exit; Run removes its uploads and records its final state.
+func (m *Manager) run(s *Session) {
+	s.Run()
 }
 
-func idString(n uint64) string {
-	return strconv.FormatUint(n, 36)
+// persist writes the registry for all sessions currently tracked by the manager.
+func (m *Manager) persist() {
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+	list := m.List()
+	recs := make([]registryRecord, 0, len(list))
+	for _, s := range list {
+		recs = append(recs, s.record())
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Created.Before(recs[j].Created) })
+	if err := m.registry.save(recs); err != nil {
+		log.Printf("session registry persist failed: %v", err)
+	}
 }
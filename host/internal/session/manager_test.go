@@ -2,11 +2,16 @@ package session
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/creack/pty"
+	"github.com/ericbosch/cli-remote-control/host/internal/logrotate"
 )
 
 func requirePTY(t *testing.T) {
@@ -68,12 +73,154 @@ func TestManager_TerminateNotFound(t *testing.T) {
 	}
 }
 
-func TestIdString(t *testing.T) {
-	if idString(1) != "1" {
-		t.Errorf("idString(1)=%s", idString(1))
+func TestIDGeneratorSortableAndUnique(t *testing.T) {
+	var g idGenerator
+	now := time.UnixMilli(1700000000000)
+	prev := ""
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		ts := now
+		if i%100 == 0 {
+			ts = now.Add(time.Duration(i) * time.Millisecond)
+		}
+		id, err := g.next(ts)
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		if len(id) != 26 {
+			t.Fatalf("id %q len=%d want=26", id, len(id))
+		}
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+		if id <= prev {
+			t.Fatalf("ids not increasing: %q after %q", id, prev)
+		}
+		prev = id
 	}
-	if idString(36) != "10" {
-		t.Errorf("idString(36)=%s", idString(36))
+
+	var raw [16]byte
+	raw[5] = 1
+	if got := encodeULID(raw); got != "0000000001"+"0000000000000000" {
+		t.Fatalf("encodeULID timestamp=1 got %q", got)
+	}
+}
+
+func TestNewSessionRefusesExistingLog(t *testing.T) {
+	logDir := t.TempDir()
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	if err := os.WriteFile(filepath.Join(logDir, "dup.log"), []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewSession(context.Background(), "dup", "dup", "shell", nil, logDir, eventsDir, 8)
+	if !errors.Is(err, ErrSessionExists) {
+		t.Fatalf("NewSession err=%v want ErrSessionExists", err)
+	}
+}
+
+func TestManager_FailedStartReleasesFiles(t *testing.T) {
+	logDir := t.TempDir()
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	m := NewManager(logDir, 8, eventsDir)
+	// The exec engine rejects a job without a command only once its files are claimed.
+	if _, err := m.Create(context.Background(), "exec", "", nil); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("create err=%v want ErrInvalidArgs", err)
+	}
+	for _, dir := range []string{logDir, eventsDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("failed session left %d files in %s, e.g. %s", len(entries), dir, entries[0].Name())
+		}
+	}
+}
+
+// gateEngine is an echoEngine whose Start waits for release, after reporting the session id.
+type gateEngine struct {
+	echoEngine
+	started chan string
+	release chan struct{}
+}
+
+func (g gateEngine) Start(ctx context.Context, s *Session, args map[string]interface{}) (Process, error) {
+	g.started <- s.ID
+	<-g.release
+	return g.echoEngine.Start(ctx, s, args)
+}
+
+func TestManager_LogJanitorKeepsStartingSessions(t *testing.T) {
+	logDir := t.TempDir()
+	m := NewManager(logDir, 8, filepath.Join(t.TempDir(), "events"))
+	gate := gateEngine{started: make(chan string), release: make(chan struct{})}
+	m.Engines().Register(gate)
+	created := make(chan *Session, 1)
+	go func() {
+		s, err := m.Create(context.Background(), "echo", "", nil)
+		if err != nil {
+			t.Errorf("create: %v", err)
+		}
+		created <- s
+	}()
+	id := <-gate.started
+
+	// Any file is over the size limit; the claimed log of the starting session must stay.
+	j := &logrotate.Janitor{Dir: logDir, Retention: logrotate.Retention{MaxTotalBytes: 1}, Active: m.activeIDs}
+	if err := os.WriteFile(filepath.Join(logDir, "01OLDSESSION.log"), []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := j.Sweep()
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0]) != "01OLDSESSION.log" {
+		t.Fatalf("removed=%v", removed)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, id+".log")); err != nil {
+		t.Fatalf("log of the starting session removed: %v", err)
+	}
+
+	close(gate.release)
+	s := <-created
+	if s == nil {
+		return
+	}
+	defer stopSession(t, m, s)
+	if !m.activeIDs()[id] {
+		t.Fatal("running session not active")
+	}
+}
+
+func TestClaimSessionFilesIsExclusive(t *testing.T) {
+	logDir := t.TempDir()
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- claimSessionFiles("race", logDir, eventsDir) }()
+	}
+	won := 0
+	for i := 0; i < cap(errs); i++ {
+		switch err := <-errs; {
+		case err == nil:
+			won++
+		case !errors.Is(err, ErrSessionExists):
+			t.Fatalf("claim err=%v want ErrSessionExists", err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("%d claims of one id succeeded, want 1", won)
+	}
+
+	if err := os.WriteFile(filepath.Join(eventsDir, "old.jsonl"), []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := claimSessionFiles("old", logDir, eventsDir); !errors.Is(err, ErrSessionExists) {
+		t.Fatalf("claim over existing events err=%v want ErrSessionExists", err)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "old.log")); !os.IsNotExist(err) {
+		t.Fatalf("refused claim left its log behind: %v", err)
 	}
 }
 
@@ -92,3 +239,82 @@ func TestNewManager_CreatesLogDir(t *testing.T) {
 		t.Errorf("log dir not created: %v", err)
 	}
 }
+
+func TestManager_RestoreListsPastSessionsAsExited(t *testing.T) {
+	requirePTY(t)
+
+	logDir := t.TempDir()
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	m := NewManager(logDir, 8, eventsDir)
+	s, err := m.Create(context.Background(), "shell", "past", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	lastSeq := s.LastEventSeq()
+	if lastSeq == 0 {
+		t.Fatal("expected at least one event")
+	}
+
+	// Simulate a host restart while the session is still running.
+	m2 := NewManager(logDir, 8, eventsDir)
+	if err := m2.Restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	got := m2.Get(s.ID)
+	if got == nil {
+		t.Fatal("restored session not found")
+	}
+	info := got.Info()
+	if info["state"] != "exited" || info["name"] != "past" || info["restored"] != true {
+		t.Fatalf("unexpected restored info: %+v", info)
+	}
+	if got.LastEventSeq() < lastSeq {
+		t.Fatalf("restored last_seq=%d want>=%d", got.LastEventSeq(), lastSeq)
+	}
+	if len(got.ReplayEventsFromSeq(0)) == 0 {
+		t.Fatal("expected persisted events to replay")
+	}
+
+	_ = m.Terminate(s.ID)
+	if err := m2.Terminate(s.ID); err != nil {
+		t.Fatalf("terminate restored: %v", err)
+	}
+	m3 := NewManager(logDir, 8, eventsDir)
+	if err := m3.Restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if m3.Get(s.ID) != nil {
+		t.Fatal("terminated session should not be restored")
+	}
+}
+
+func TestManager_RegistryLeavesOutSecretArgs(t *testing.T) {
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	m := NewManager(t.TempDir(), 8, eventsDir)
+	m.Engines().Register(echoEngine{})
+	s, err := m.Create(context.Background(), "echo", "e", map[string]interface{}{
+		"prompt":       "the secret plan",
+		"env":          map[string]interface{}{"TOKEN": "hunter2", "A": "b"},
+		"record_input": true,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer m.Terminate(s.ID)
+
+	b, err := os.ReadFile(filepath.Join(eventsDir, registryFileName))
+	if err != nil {
+		t.Fatalf("read registry: %v", err)
+	}
+	if strings.Contains(string(b), "secret plan") || strings.Contains(string(b), "hunter2") {
+		t.Fatalf("registry contains secrets: %s", b)
+	}
+	recs, err := m.registry.load()
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("recs=%+v err=%v", recs, err)
+	}
+	args := recs[0].Args
+	if !reflect.DeepEqual(args["env"], []interface{}{"A", "TOKEN"}) || args["record_input"] != true {
+		t.Fatalf("args=%v", args)
+	}
+}
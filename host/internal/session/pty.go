@@ -0,0 +1,194 @@
+package session
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/creack/pty"
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/ericbosch/cli-remote-control/host/internal/holder"
+	"github.com/ericbosch/cli-remote-control/host/internal/vt"
+)
+
+// PTYs start at the classic 80x24 so the emulated screen matches until a client resizes.
+const (
+	defaultCols      = 80
+	defaultRows      = 24
+	screenScrollback = 1000
+)
+
+// ptyProcess is a process attached to a pseudo-terminal. It is either started in-process
+// (localPTY) or owned by a detached holder process (*holder.Conn) that survives host restarts.
+type ptyProcess interface {
+	io.ReadWriteCloser
+	Resize(cols, rows int) error
+	Wait() (exitCode int, err error)
+	Kill() error
+	// Interrupt sends SIGINT to the terminal's foreground process group.
+	Interrupt() error
+	// Pid is the process whose tree runs the session: the child, or its holder (0 if unknown).
+	Pid() int
+}
+
+type localPTY struct {
+	ptmx *os.File
+	cmd  *exec.Cmd
+}
+
+func (p *localPTY) Read(b []byte) (int, error)  { return p.ptmx.Read(b) }
+func (p *localPTY) Write(b []byte) (int, error) { return p.ptmx.Write(b) }
+func (p *localPTY) Close() error                { return p.ptmx.Close() }
+
+func (p *localPTY) Resize(cols, rows int) error {
+	return pty.Setsize(p.ptmx, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+}
+
+func (p *localPTY) Wait() (int, error) {
+	err := p.cmd.Wait()
+	return exitCodeOf(err), err
+}
+
+func (p *localPTY) Pid() int { return p.cmd.Process.Pid }
+
+func (p *localPTY) Interrupt() error { return holder.SignalForeground(p.ptmx, syscall.SIGINT) }
+
+func (p *localPTY) Kill() error {
+	if p.cmd.Process == nil {
+		return nil
+	}
+	return p.cmd.Process.Kill()
+}
+
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exit, ok := err.(*exec.ExitError); ok {
+		if status, ok := exit.Sys().(interface{ ExitStatus() int }); ok {
+			return status.ExitStatus()
+		}
+	}
+	return 0
+}
+
+// ptyProc is the Process of PTY engines: input is written verbatim and every output chunk is
+// published as an assistant event with stream "stdout".
+type ptyProc struct {
+	s    *Session
+	term ptyProcess
+}
+
+func (p *ptyProc) SendInput(data []byte) error {
+	_, err := p.term.Write(data)
+	if err == nil {
+		_, _ = p.s.PublishEvent(events.EventKindUser, map[string]any{"data": string(data)})
+	}
+	return err
+}
+
+func (p *ptyProc) Interrupt() error { return p.term.Interrupt() }
+
+func (p *ptyProc) Stop() error { return p.term.Kill() }
+
+func (p *ptyProc) Wait() (int, error) { return p.term.Wait() }
+
+func (p *ptyProc) Resize(cols, rows int) error { return p.term.Resize(cols, rows) }
+
+func (p *ptyProc) Close() error { return p.term.Close() }
+
+// StartPTY starts cmd in a pseudo-terminal attached to s and returns its Process. When the
+// session's manager runs detached sessions, the PTY is owned by a holder process instead of the
+// host so it survives restarts.
+func (s *Session) StartPTY(cmd *exec.Cmd) (Process, error) {
+	if err := s.prepareCmd(cmd); err != nil {
+		return nil, err
+	}
+	term, initial, sock, err := startPTY(cmd, s.ID, s.holderDir)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.holderSock = sock
+	s.screen = vt.New(defaultCols, defaultRows, screenScrollback)
+	s.mu.Unlock()
+	s.trackProcess(term.Pid())
+
+	s.emitPTYOutput(initial)
+	go s.copyOutput(term)
+	return &ptyProc{s: s, term: term}, nil
+}
+
+// startPTY starts cmd in a PTY. When holderDir is set the PTY is owned by a detached holder
+// process (see internal/holder) so the session keeps running across host restarts; the output
+// the holder buffered before we attached is returned as the initial chunk.
+func startPTY(cmd *exec.Cmd, id string, holderDir string) (ptyProcess, []byte, string, error) {
+	if holderDir == "" {
+		ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: defaultCols, Rows: defaultRows})
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return &localPTY{ptmx: ptmx, cmd: cmd}, nil, "", nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	dir, err := filepath.Abs(holderDir)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	spec := holder.Spec{
+		ID:   id,
+		Dir:  dir,
+		Path: cmd.Path,
+		Env:  cmd.Env,
+		Cwd:  cmd.Dir,
+		Cols: defaultCols,
+		Rows: defaultRows,
+	}
+	if len(cmd.Args) > 1 {
+		spec.Args = cmd.Args[1:]
+	}
+	conn, err := holder.Spawn(exe, spec)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	sock, _, _ := holder.Paths(dir, id)
+	return conn, conn.Replay(), sock, nil
+}
+
+func (s *Session) copyOutput(term io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := term.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			s.emitPTYOutput(chunk)
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("session %s read error: %v", s.ID, err)
+			}
+			break
+		}
+	}
+}
+
+// emitPTYOutput writes a PTY output chunk to the legacy stream and publishes it as an event.
+func (s *Session) emitPTYOutput(chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	s.WriteOutput(chunk)
+	_, _ = s.PublishEvent(events.EventKindAssistant, map[string]any{
+		"stream": "stdout",
+		"data":   string(chunk),
+	})
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+const registryFileName = "registry.json"
+
+// registryRecord is the persisted description of a session. It is enough to list a past session
+// after a restart and to locate its persisted event history.
+type registryRecord struct {
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Engine     string                 `json:"engine"`
+	Args       map[string]interface{} `json:"args,omitempty"`
+	Created    time.Time              `json:"created"`
+	State      string                 `json:"state"`
+	ExitCode   int                    `json:"exit_code"`
+	EngineMeta map[string]any         `json:"engine_meta,omitempty"`
+	Holder     string                 `json:"holder,omitempty"` // socket of a detached PTY holder
+	Usage      *Usage                 `json:"usage,omitempty"`  // token usage reported by the engine
+}
+
+// registry stores session records as a single JSON file next to the events JSONL files.
+type registry struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newRegistry(dir string) *registry {
+	return &registry{path: filepath.Join(dir, registryFileName)}
+}
+
+func (r *registry) load() ([]registryRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := os.ReadFile(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var recs []registryRecord
+	if err := json.Unmarshal(b, &recs); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// save atomically replaces the registry file with recs.
+func (r *registry) save(recs []registryRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(recs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// record returns the registry record describing s.
+func (s *Session) record() registryRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var usage *Usage
+	if s.usage != (Usage{}) {
+		u := s.usage
+		usage = &u
+	}
+	return registryRecord{
+		ID:         s.ID,
+		Name:       s.Name,
+		Engine:     s.Engine,
+		Args:       recordArgs(s.args),
+		Created:    s.Created,
+		State:      s.state,
+		ExitCode:   s.exitCode,
+		EngineMeta: maps.Clone(s.engineMeta),
+		Holder:     s.holderSock,
+		Usage:      usage,
+	}
+}
+
+// recordArgs returns the args of a session as stored in its registry record. The registry is
+// plain text on disk, so the prompt is left out and env is reduced to its names, as in engine_meta.
+func recordArgs(args map[string]interface{}) map[string]interface{} {
+	out := maps.Clone(args)
+	delete(out, "prompt")
+	if env, ok := out["env"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(env))
+		for k := range env {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		out["env"] = names
+	}
+	return out
+}
+
+// restoreSession rebuilds an exited session from its registry record. Its event buffer is seeded
+// from the persisted JSONL history so /ws/events/{id} can replay it, and its legacy ring buffer
+// from the tail of the session log.
+func restoreSession(rec registryRecord, logDir string, eventsDir string, bufKB int) *Session {
+	if bufKB <= 0 {
+		bufKB = defaultBufKB
+	}
+	s := &Session{
+		ID:         rec.ID,
+		Name:       rec.Name,
+		Engine:     rec.Engine,
+		Created:    rec.Created,
+		state:      "exited",
+		exitCode:   rec.ExitCode,
+		restored:   true,
+		args:       rec.Args,
+		engineMeta: rec.EngineMeta,
+		ring:       NewRingBuffer(bufKB * 1024),
+		eventsBuf:  events.NewBuffer(2048),
+		closed:     true,
+		cancel:     func() {},
+		done:       make(chan struct{}),
+	}
+	close(s.done)
+	if rec.Usage != nil {
+		s.usage = *rec.Usage
+	}
+	// A session that was still running when the host went away has no known exit status,
+	// unless its detached holder recorded one.
+	if rec.State != "exited" {
+		s.exitCode = -1
+		if code, ok := holderExitCode(rec); ok {
+			s.exitCode = code
+		}
+		// Nothing reattaches to the holder any more; its exit file is now recorded in the registry.
+		if rec.Holder != "" {
+			removeHolderExit(rec.Holder, rec.ID)
+		}
+	}
+	if eventsDir != "" {
+		if store, err := events.NewJSONLStore(eventsDir); err == nil {
+			s.eventsStore = store
+			if tail, err := store.LoadTail(rec.ID, 2048); err == nil {
+				s.eventsBuf.Restore(tail)
+			} else {
+				log.Printf("events restore failed (session=%s): %v", rec.ID, err)
+			}
+		}
+	}
+	if tail, err := readFileTail(filepath.Join(logDir, rec.ID+".log"), int64(bufKB)*1024); err == nil {
+		s.ring.Write(tail)
+	}
+	return s
+}
+
+func readFileTail(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	off := st.Size() - max
+	if off < 0 {
+		off = 0
+	}
+	return io.ReadAll(io.NewSectionReader(f, off, st.Size()-off))
+}
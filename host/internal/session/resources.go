@@ -0,0 +1,113 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/ericbosch/cli-remote-control/host/internal/limits"
+)
+
+// limitsInterval is how often the resource usage of limited sessions is published.
+var limitsInterval = 10 * time.Second
+
+// wrapLimits makes cmd run under the session's resource limits (see limits.Group.Wrap).
+func (s *Session) wrapLimits(cmd *exec.Cmd) error {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	if s.limits == nil {
+		return nil
+	}
+	if err := s.limits.Wrap(cmd); err != nil {
+		return fmt.Errorf("resource limits: %w", err)
+	}
+	return nil
+}
+
+// trackProcess records a started process for usage sampling.
+func (s *Session) trackProcess(pid int) {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	if s.limits != nil {
+		s.limits.Track(pid)
+	}
+}
+
+// monitorLimits publishes the session's resource usage every limitsInterval until it exits.
+func (s *Session) monitorLimits() {
+	t := time.NewTicker(limitsInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			s.sampleLimits(true)
+		}
+	}
+}
+
+// sampleLimits reads the session's usage, publishes an error event for every limit hit since the
+// previous sample and, if publish is set, the usage as a metrics event.
+func (s *Session) sampleLimits(publish bool) {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	if s.limits == nil {
+		return
+	}
+	u, err := s.limits.Usage()
+	if err != nil {
+		return
+	}
+	prev := s.limitsSeen
+	s.limitsSeen = u
+	// An OOM kill implies memory.max was reached; report it once.
+	switch {
+	case u.OOMKills > prev.OOMKills:
+		s.publishLimitHit("limit_memory", "memory limit reached: process killed by the OOM killer")
+	case u.MemoryMax > prev.MemoryMax:
+		s.publishLimitHit("limit_memory", "memory limit reached")
+	}
+	if u.PidsMax > prev.PidsMax {
+		s.publishLimitHit("limit_pids", "process limit reached: fork refused")
+	}
+	if publish {
+		_, _ = s.PublishEvent(events.EventKindMetrics, map[string]any{"resources": u, "limits": s.limits.Info()})
+	}
+}
+
+func (s *Session) publishLimitHit(code, msg string) {
+	_, _ = s.PublishEvent(events.EventKindError, map[string]any{"message": msg, "code": code})
+}
+
+// closeLimits reports limit hits since the last sample and removes the session's group.
+func (s *Session) closeLimits() {
+	if s.limits == nil {
+		return
+	}
+	s.sampleLimits(false)
+	s.limitsMu.Lock()
+	g := s.limits
+	s.limits = nil
+	s.limitsMu.Unlock()
+	if err := g.Close(); err != nil {
+		log.Printf("session %s: remove resource limits group: %v", s.ID, err)
+	}
+}
+
+// reopenLimits attaches a reattached session to the group it was started in, if it still exists.
+// Sessions started without limits never had one, so the controller is not set up for them.
+func (s *Session) reopenLimits(ctl *limits.Controller) {
+	s.mu.RLock()
+	limited := s.engineMeta["limits"] != nil
+	s.mu.RUnlock()
+	if !limited {
+		return
+	}
+	if g := ctl.Open(s.ID); g != nil {
+		s.limits = g
+		go s.monitorLimits()
+	}
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+	"github.com/ericbosch/cli-remote-control/host/internal/limits"
+)
+
+func TestSessionLimits_Rlimits(t *testing.T) {
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.SetResourceLimits(nil, limits.Limits{NoFile: 128})
+	if _, err := m.Create(context.Background(), "exec", "", map[string]interface{}{
+		"command": "true", "limits": map[string]interface{}{"nofile": "64"},
+	}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("invalid limits err=%v", err)
+	}
+	s, err := m.Create(context.Background(), "exec", "", map[string]interface{}{
+		"command": "ulimit -n", "limits": map[string]interface{}{"nofile": float64(64)},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	waitExited(t, s)
+	if got := strings.TrimSpace(string(s.Replay(0))); got != "64" {
+		t.Fatalf("ulimit -n = %q, want the session override", got)
+	}
+	meta, _ := s.Info()["engine_meta"].(map[string]any)
+	info, _ := meta["limits"].(map[string]any)
+	if info["mode"] != limits.ModeRlimit || info["nofile"] != uint64(64) {
+		t.Fatalf("engine_meta.limits=%v", info)
+	}
+}
+
+func TestSessionLimits_PublishesHits(t *testing.T) {
+	parent := t.TempDir()
+	for name, content := range map[string]string{"cgroup.controllers": "memory pids", "cgroup.procs": "", "cgroup.subtree_control": ""} {
+		if err := os.WriteFile(filepath.Join(parent, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctl := limits.NewController(parent)
+	if ctl == nil {
+		t.Fatal("fake cgroup not used")
+	}
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.SetResourceLimits(ctl, limits.Limits{MemoryMB: 64})
+	s, err := m.Create(context.Background(), "exec", "", map[string]interface{}{"command": "sleep 5"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+
+	dir := filepath.Join(parent, "sessions", s.ID)
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("memory.current", "4096\n")
+	write("memory.events", "max 1\noom_kill 0\n")
+	write("pids.events", "max 0\n")
+	s.sampleLimits(true)
+	write("memory.events", "max 2\noom_kill 1\n")
+	s.sampleLimits(false)
+
+	var errs []string
+	var usage bool
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		switch ev.Kind {
+		case events.EventKindError:
+			errs = append(errs, string(ev.Payload))
+		case events.EventKindMetrics:
+			usage = usage || strings.Contains(string(ev.Payload), `"memory_bytes":4096`)
+		}
+	}
+	if len(errs) != 2 || !strings.Contains(errs[0], `"limit_memory"`) || !strings.Contains(errs[1], "OOM killer") {
+		t.Fatalf("error events=%v", errs)
+	}
+	if !usage {
+		t.Fatal("no metrics event with the memory usage")
+	}
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/sandbox"
+)
+
+// sandboxAgentPaths are the directories agent engines keep their login and state in. Inside a
+// sandbox they stay writable, and these engines keep network access by default since they talk to
+// their provider.
+var sandboxAgentPaths = map[string][]string{
+	"codex":  {"$CODEX_HOME", "~/.codex"},
+	"cursor": {"~/.cursor", "~/.config/cursor"},
+}
+
+// parseSandboxArgs decides whether a session for engine is sandboxed from args.sandbox and
+// args.sandbox_network under the host policy, and returns its options (nil when unsandboxed).
+func parseSandboxArgs(policy sandbox.Policy, engine string, args map[string]interface{}) (*sandbox.Options, error) {
+	var flags [2]*bool
+	for i, key := range []string{"sandbox", "sandbox_network"} {
+		v, ok := args[key]
+		if !ok || v == nil {
+			continue
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s must be a boolean", ErrInvalidArgs, key)
+		}
+		flags[i] = &b
+	}
+	enabled, err := policy.Enabled(flags[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArgs, err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	if _, err := sandbox.Find(); err != nil {
+		return nil, err
+	}
+	agentPaths, agent := sandboxAgentPaths[engine]
+	opts := &sandbox.Options{Network: agent, Hide: policy.Hide}
+	if flags[1] != nil {
+		opts.Network = *flags[1]
+	}
+	opts.Workspace, _ = args["workspacePath"].(string)
+	if opts.Workspace != "" {
+		if hidden, ok := opts.HiddenBy(opts.Workspace); ok {
+			return nil, fmt.Errorf("%w: workspace %s is inside %s, which is hidden from sandboxes", ErrInvalidArgs, opts.Workspace, hidden)
+		}
+	}
+	home, _ := os.UserHomeDir()
+	for _, p := range agentPaths {
+		p = os.ExpandEnv(p)
+		if rest, ok := strings.CutPrefix(p, "~/"); ok && home != "" {
+			p = filepath.Join(home, rest)
+		}
+		if filepath.IsAbs(p) {
+			opts.Writable = append(opts.Writable, p)
+		}
+	}
+	return opts, nil
+}
+
+// sandboxMeta describes the session's sandbox for engine_meta.
+func sandboxMeta(opts *sandbox.Options) map[string]any {
+	meta := map[string]any{"network": opts.Network}
+	if opts.Workspace != "" {
+		meta["workspace"] = opts.Workspace
+	}
+	return meta
+}
+
+// prepareCmd confines cmd, which an engine is about to start, to the session's sandbox and
+// resource limits. Engines call it for every process they start.
+func (s *Session) prepareCmd(cmd *exec.Cmd) error {
+	if s.sandbox != nil {
+		if err := sandbox.Wrap(cmd, *s.sandbox); err != nil {
+			return err
+		}
+	}
+	return s.wrapLimits(cmd)
+}
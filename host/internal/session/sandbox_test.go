@@ -0,0 +1,115 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/limits"
+	"github.com/ericbosch/cli-remote-control/host/internal/sandbox"
+)
+
+// fakeBwrap puts a bwrap on PATH that logs its arguments to the returned file and runs the
+// program after "--" without any isolation.
+func fakeBwrap(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	logPath := filepath.Join(t.TempDir(), "bwrap.args")
+	script := "#!/bin/sh\necho \"$@\" > " + logPath + "\nwhile [ \"$1\" != -- ]; do shift; done\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "bwrap"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+func TestSessionSandbox(t *testing.T) {
+	argsLog := fakeBwrap(t)
+	ws := t.TempDir()
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.SetSandbox(sandbox.Policy{Mode: sandbox.ModeEnforce, Hide: []string{ws + "/.run"}})
+	m.SetResourceLimits(nil, limits.Limits{NoFile: 64})
+
+	if _, err := m.Create(context.Background(), "exec", "", map[string]interface{}{"command": "true", "sandbox": false}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("opt-out under enforce: err=%v", err)
+	}
+	s, err := m.Create(context.Background(), "exec", "", map[string]interface{}{
+		"command": "pwd; ulimit -n", "workspacePath": ws,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	waitExited(t, s)
+	// Limits are applied outside the sandbox and inherited by the sandboxed program.
+	if got := string(s.Replay(0)); got != ws+"\n64\n" {
+		t.Fatalf("output=%q", got)
+	}
+	b, err := os.ReadFile(argsLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := string(b)
+	for _, want := range []string{"--unshare-all", "--ro-bind / /", "--bind " + ws + " " + ws, "--chdir " + ws, "-- /"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("bwrap args %q missing %q", args, want)
+		}
+	}
+	if strings.Contains(args, "--share-net") {
+		t.Errorf("jobs should not get network by default: %q", args)
+	}
+	meta, _ := s.Info()["engine_meta"].(map[string]any)
+	if sb, _ := meta["sandbox"].(map[string]any); sb["network"] != false || sb["workspace"] != ws {
+		t.Fatalf("engine_meta.sandbox=%v", meta["sandbox"])
+	}
+}
+
+func TestSessionSandbox_WorkspaceInsideHiddenPath(t *testing.T) {
+	fakeBwrap(t)
+	state := t.TempDir()
+	ws := filepath.Join(state, "sessions")
+	if err := os.Mkdir(ws, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.SetSandbox(sandbox.Policy{Mode: sandbox.ModeOn, Hide: []string{state}})
+	if _, err := m.Create(context.Background(), "exec", "", map[string]interface{}{"command": "true", "workspacePath": ws}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("workspace inside a hidden path: err=%v want ErrInvalidArgs", err)
+	}
+	// Unsandboxed sessions see the host as it is.
+	s, err := m.Create(context.Background(), "exec", "", map[string]interface{}{"command": "true", "workspacePath": ws, "sandbox": false})
+	if err != nil {
+		t.Fatalf("create unsandboxed: %v", err)
+	}
+	waitExited(t, s)
+}
+
+func TestSessionSandbox_Unavailable(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	m.SetSandbox(sandbox.Policy{Mode: sandbox.ModeOn})
+	if _, err := m.Create(context.Background(), "exec", "", map[string]interface{}{"command": "true"}); !errors.Is(err, sandbox.ErrUnavailable) {
+		t.Fatalf("err=%v want ErrUnavailable", err)
+	}
+}
+
+func TestParseSandboxArgs_AgentDefaults(t *testing.T) {
+	fakeBwrap(t)
+	t.Setenv("CODEX_HOME", "/srv/codex")
+	opts, err := parseSandboxArgs(sandbox.Policy{Mode: sandbox.ModeOn}, "codex", map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.Network || len(opts.Writable) != 2 || opts.Writable[0] != "/srv/codex" {
+		t.Fatalf("codex sandbox=%+v", opts)
+	}
+	opts, err = parseSandboxArgs(sandbox.Policy{Mode: sandbox.ModeOn}, "codex", map[string]interface{}{"sandbox_network": false})
+	if err != nil || opts.Network {
+		t.Fatalf("sandbox_network override: %+v, %v", opts, err)
+	}
+	if _, err := parseSandboxArgs(sandbox.Policy{}, "shell", map[string]interface{}{"sandbox": "yes"}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("non-boolean sandbox: err=%v", err)
+	}
+}
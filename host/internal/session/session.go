@@ -4,24 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/creack/pty"
-	"github.com/ericbosch/cli-remote-control/host/internal/codexrpc"
 	"github.com/ericbosch/cli-remote-control/host/internal/events"
-	"github.com/ericbosch/cli-remote-control/host/internal/policy"
+	"github.com/ericbosch/cli-remote-control/host/internal/limits"
+	"github.com/ericbosch/cli-remote-control/host/internal/logrotate"
+	"github.com/ericbosch/cli-remote-control/host/internal/sandbox"
+	"github.com/ericbosch/cli-remote-control/host/internal/vt"
 )
 
 const defaultBufKB = 64
 
-// Session represents a single PTY session (e.g. shell).
+// Session represents a single engine session (e.g. a shell PTY or a codex thread).
 type Session struct {
 	ID      string
 	Name    string
@@ -31,115 +32,204 @@ type Session struct {
 	mu          sync.RWMutex
 	state       string // "running", "exited"
 	exitCode    int
+	restored    bool // loaded from the registry after a host restart
+	args        map[string]interface{}
 	engineMeta  map[string]any
-	ptmx        *os.File
-	cmd         *exec.Cmd
-	logFile     *os.File
+	proc        Process
+	holderDir   string // when set, PTYs are owned by detached holders in this directory
+	holderSock  string // socket of the detached holder owning the PTY, if any
+	logFile     *logrotate.File
+	cast        *castRecorder // asciicast v2 recording next to the log; nil if it could not be opened
 	ring        *RingBuffer
+	screen      *vt.Terminal // emulated screen of PTY sessions; nil for structured engines
+	outMu       sync.Mutex   // orders PTY output with its events; see ScreenSnapshot
 	eventsBuf   *events.Buffer
 	eventsStore *events.JSONLStore
 	subs        map[chan []byte]struct{}
 	eventSubs   map[chan events.SessionEvent]struct{}
+	control     control // input lock among attached WebSocket clients
 	closed      bool
+	sandbox     *sandbox.Options // nil when the session is not sandboxed
+	codexPolicy CodexPolicy      // codex settings the session may choose
+	usage       Usage            // token usage reported by the engine
+	usageDirty  bool             // usage changed since the registry record was saved
+	rateLimits  *RateLimits      // latest rate limits reported by the engine
+	usageLedger *usageLedger     // host-wide usage; nil when not kept
+	persist     func()           // saves the session's registry record; nil when not kept
+	attach      attachments      // uploaded files its messages can reference
+	limitsMu    sync.Mutex       // guards limits and limitsSeen
+	limits      *limits.Group    // resource limits of the session's processes; nil when unlimited
+	limitsSeen  limits.Usage     // last sample, to detect limit hits
 	cancel      context.CancelFunc
 	done        chan struct{}
-
-	codex         *codexrpc.Client
-	codexThreadID string
 }
 
-// NewSession creates a session for the given engine. Caller must call Run().
+// NewSession creates a session for one of the built-in engines. Caller must call Run().
+// It refuses to reuse an ID that already has a log or events file, so persisted history of
+// different sessions is never mixed.
 func NewSession(ctx context.Context, id, name, engine string, args map[string]interface{}, logDir string, eventsDir string, bufKB int) (*Session, error) {
-	switch engine {
-	case "codex":
-		return newCodexSession(ctx, id, name, args, logDir, eventsDir, bufKB)
-	case "cursor":
-		s, err := newCursorSession(ctx, id, name, args, logDir, eventsDir, bufKB)
-		if err != nil {
-			log.Printf("cursor engine unavailable (%v); falling back to shell PTY mock", err)
-			return newShellSession(ctx, id, name, "cursor-mock", logDir, eventsDir, bufKB)
-		}
-		return s, nil
-	default:
-		return newShellSession(ctx, id, name, engine, logDir, eventsDir, bufKB)
-	}
+	return newSession(ctx, DefaultEngines(), id, name, engine, args, logDir, eventsDir, bufKB, sessionOptions{})
 }
 
-// newShellSession starts a bash shell in a PTY.
-func newShellSession(ctx context.Context, id, name, engine, logDir string, eventsDir string, bufKB int) (*Session, error) {
-	if bufKB <= 0 {
-		bufKB = defaultBufKB
+// sessionOptions are the manager-wide settings a session is started with.
+type sessionOptions struct {
+	holderDir string // when set, PTY engines run under a detached holder process (see internal/holder)
+	logOpts   logrotate.Options
+	limitCtl  *limits.Controller
+	limits    limits.Limits // host default resource limits; args.limits overrides them
+	sandbox   sandbox.Policy
+	codex     CodexPolicy
+	usage     *usageLedger
+	persist   func() // rewrites the session registry, e.g. when the usage totals change
+	attachDir string // where the session's uploads are stored
+	attach    attachmentLimits
+}
+
+// newSession is NewSession with an explicit engine registry and manager options.
+func newSession(ctx context.Context, engines *EngineRegistry, id, name, engine string, args map[string]interface{}, logDir string, eventsDir string, bufKB int, opts sessionOptions) (*Session, error) {
+	eng, ok := engines.Get(engine)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEngine, engine)
 	}
-	ctx, cancel := context.WithCancel(ctx)
-	s := &Session{
-		ID:        id,
-		Name:      name,
-		Engine:    engine,
-		Created:   time.Now(),
-		state:     "running",
-		ring:      NewRingBuffer(bufKB * 1024),
-		eventsBuf: events.NewBuffer(2048),
-		subs:      make(map[chan []byte]struct{}),
-		eventSubs: make(map[chan events.SessionEvent]struct{}),
-		cancel:    cancel,
-		done:      make(chan struct{}),
+	override, err := limits.Parse(args["limits"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArgs, err)
 	}
-	if eventsDir != "" {
-		if store, err := events.NewJSONLStore(eventsDir); err == nil {
-			s.eventsStore = store
-		} else {
-			log.Printf("events persistence disabled (dir=%s): %v", eventsDir, err)
-		}
+	lim := opts.limits.Merge(override)
+	sandboxOpts, err := parseSandboxArgs(opts.sandbox, engine, args)
+	if err != nil {
+		return nil, err
 	}
-	if err := os.MkdirAll(logDir, 0750); err != nil {
-		cancel()
+	if err := claimSessionFiles(id, logDir, eventsDir); err != nil {
 		return nil, err
 	}
-	logPath := filepath.Join(logDir, id+".log")
-	lf, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	ctx, cancel := context.WithCancel(ctx)
+	s, err := newSessionBase(id, name, engine, time.Now(), logDir, eventsDir, bufKB, opts.logOpts, cancel)
 	if err != nil {
-		cancel()
+		releaseSessionFiles(id, logDir, eventsDir)
 		return nil, err
 	}
-	s.logFile = lf
-	// Start an interactive shell with a predictable prompt and without user dotfiles.
-	// This improves UX (prompt visible) and reduces surprise from local config.
-	cmd := exec.CommandContext(ctx, "bash", "--noprofile", "--norc", "-i")
-	env, _ := policy.EngineEnv(os.Environ())
-	cmd.Env = append(env,
-		"TERM=xterm-256color",
-		"PS1=rc$ ",
-		"HISTFILE=/dev/null",
-		"HISTSIZE=0",
-		"HISTFILESIZE=0",
-	)
-	ptmx, err := pty.Start(cmd)
+	s.applyOptions(opts)
+	s.sandbox = sandboxOpts
+	if !lim.IsZero() {
+		if s.limits, err = opts.limitCtl.NewGroup(id, lim); err != nil {
+			s.logFile.Close()
+			s.cast.close()
+			s.cancel()
+			releaseSessionFiles(id, logDir, eventsDir)
+			return nil, fmt.Errorf("resource limits: %w", err)
+		}
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	if s.cast != nil {
+		// Input may contain secrets typed at prompts, so it is only recorded on request.
+		s.cast.recordInput, _ = args["record_input"].(bool)
+	}
+	proc, err := eng.Start(ctx, s, args)
 	if err != nil {
-		lf.Close()
-		cancel()
+		s.logFile.Close()
+		s.cast.close()
+		s.closeLimits()
+		s.cancel()
+		releaseSessionFiles(id, logDir, eventsDir)
 		return nil, err
 	}
-	s.ptmx = ptmx
-	s.cmd = cmd
-
-	go s.copyOutput(lf)
+	s.mu.Lock()
+	s.proc = proc
+	s.mu.Unlock()
 	_, _ = s.PublishEvent(events.EventKindStatus, map[string]any{"state": "running"})
+	if s.sandbox != nil {
+		s.SetEngineMeta(map[string]any{"sandbox": sandboxMeta(s.sandbox)})
+	}
+	if s.limits != nil {
+		s.SetEngineMeta(map[string]any{"limits": s.limits.Info()})
+		go s.monitorLimits()
+	}
 	return s, nil
 }
 
-// newCursorSession starts the Cursor CLI agent in a PTY.
-// It uses the official "agent" entrypoint and relies on browser-based login.
-// If the agent binary is missing or fails to start, this returns an error so the caller can fall back.
-func newCursorPTYSession(ctx context.Context, id, name string, args map[string]interface{}, logDir string, eventsDir string, bufKB int) (*Session, error) {
+// applyOptions sets the manager-wide settings a session keeps for its whole life.
+func (s *Session) applyOptions(opts sessionOptions) {
+	s.holderDir = opts.holderDir
+	s.codexPolicy = opts.codex
+	s.usageLedger = opts.usage
+	s.persist = opts.persist
+	s.attach.root, s.attach.limits = opts.attachDir, opts.attach
+}
+
+// claimSessionFiles creates the empty log and event log of a new session. Both are created
+// exclusively, so of two sessions racing for one ID only the first gets its files; files left
+// by an earlier session are never reused either way.
+func claimSessionFiles(id, logDir string, eventsDir string) error {
+	if id == "" {
+		return errors.New("session id required")
+	}
+	if err := os.MkdirAll(logDir, 0o750); err != nil {
+		return err
+	}
+	logPath := filepath.Join(logDir, id+".log")
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s.log", ErrSessionExists, id)
+	} else if err != nil {
+		return err
+	}
+	f.Close()
+	release := func() { os.Remove(logPath) }
+	// The recording is opened later; the claimed log keeps other sessions from racing for it.
+	if _, err := os.Stat(filepath.Join(logDir, id+".cast")); err == nil {
+		release()
+		return fmt.Errorf("%w: %s.cast", ErrSessionExists, id)
+	} else if !os.IsNotExist(err) {
+		release()
+		return err
+	}
+	if eventsDir == "" {
+		return nil
+	}
+	store, err := events.NewJSONLStore(eventsDir)
+	if err != nil {
+		// Persistence is best-effort; the constructor logs and continues without it.
+		return nil
+	}
+	if err := store.Create(id); errors.Is(err, fs.ErrExist) {
+		release()
+		return fmt.Errorf("%w: %s.jsonl", ErrSessionExists, id)
+	} else if err != nil {
+		release()
+		return err
+	}
+	return nil
+}
+
+// releaseSessionFiles removes the files of a session that failed to start: the log and event log
+// claimed by claimSessionFiles and the recording opened next to the log. No registry record
+// refers to them.
+func releaseSessionFiles(id, logDir string, eventsDir string) {
+	paths := []string{filepath.Join(logDir, id+".log"), filepath.Join(logDir, id+".cast")}
+	if eventsDir != "" {
+		paths = append(paths, filepath.Join(eventsDir, id+".jsonl"))
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.Printf("session %s: remove %s: %v", id, p, err)
+		}
+	}
+}
+
+// newSessionBase sets up the state shared by all engines: buffers, event persistence and the
+// session log (appended to when it exists). cancel is called when the session ends.
+func newSessionBase(id, name, engine string, created time.Time, logDir string, eventsDir string, bufKB int, logOpts logrotate.Options, cancel context.CancelFunc) (*Session, error) {
 	if bufKB <= 0 {
 		bufKB = defaultBufKB
 	}
-	ctx, cancel := context.WithCancel(ctx)
 	s := &Session{
 		ID:        id,
 		Name:      name,
-		Engine:    "cursor",
-		Created:   time.Now(),
+		Engine:    engine,
+		Created:   created,
 		state:     "running",
 		ring:      NewRingBuffer(bufKB * 1024),
 		eventsBuf: events.NewBuffer(2048),
@@ -155,106 +245,28 @@ func newCursorPTYSession(ctx context.Context, id, name string, args map[string]i
 			log.Printf("events persistence disabled (dir=%s): %v", eventsDir, err)
 		}
 	}
-	if err := os.MkdirAll(logDir, 0750); err != nil {
+	if err := os.MkdirAll(logDir, 0o750); err != nil {
 		cancel()
 		return nil, err
 	}
 	logPath := filepath.Join(logDir, id+".log")
-	lf, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	lf, err := logrotate.Open(logPath, logOpts)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
 	s.logFile = lf
-
-	workspacePath, _ := args["workspacePath"].(string)
-	prompt, _ := args["prompt"].(string)
-
-	ep, err := detectCursorEngineEntrypoint(ctx)
-	if err != nil {
-		lf.Close()
-		cancel()
-		return nil, err
-	}
-
-	cmdArgs := []string{}
-	cmdArgs = append(cmdArgs, ep.ArgsPrefix...)
-	if prompt != "" && ep.SupportsPromptFlag {
-		cmdArgs = append(cmdArgs, "-p", prompt)
-	}
-
-	cmd := exec.CommandContext(ctx, ep.Bin, cmdArgs...)
-	if workspacePath != "" {
-		cmd.Dir = workspacePath
-	}
-	env, _ := policy.EngineEnv(os.Environ())
-	cmd.Env = append(env, "TERM=xterm-256color")
-
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		lf.Close()
-		cancel()
-		// Wrap error to signal cursor unavailability; caller will fall back.
-		return nil, errors.New("failed to start cursor engine")
-	}
-	s.ptmx = ptmx
-	s.cmd = cmd
-	s.engineMeta = map[string]any{
-		"cursor_engine_entrypoint": ep.Name,
-		"cursor_engine_mode":       "pty",
-	}
-
-	go s.copyOutput(lf)
-	_, _ = s.PublishEvent(events.EventKindStatus, map[string]any{"state": "running"})
+	s.cast = openSessionCast(logDir, id, s.Created, name, logOpts.MaxBytes)
 	return s, nil
 }
 
-func (s *Session) copyOutput(logFile *os.File) {
-	buf := make([]byte, 4096)
-	for {
-		n, err := s.ptmx.Read(buf)
-		if n > 0 {
-			chunk := make([]byte, n)
-			copy(chunk, buf[:n])
-
-			s.mu.Lock()
-			s.ring.Write(chunk)
-			logFile.Write(chunk)
-			for ch := range s.subs {
-				select {
-				case ch <- chunk:
-				default:
-				}
-			}
-			s.mu.Unlock()
-
-			_, _ = s.PublishEvent(events.EventKindAssistant, map[string]any{
-				"stream": "stdout",
-				"data":   string(chunk),
-			})
-		}
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("session %s read error: %v", s.ID, err)
-			}
-			break
-		}
-	}
-}
-
-// Run waits for the process to exit and updates state.
+// Run waits for the process to exit and updates state. Once Done is closed, the session's final
+// state is saved and it writes no more files.
 func (s *Session) Run() {
 	defer close(s.done)
-	err := s.cmd.Wait()
-
-	exitCode := 0
-	if err != nil {
-		if exit, ok := err.(*exec.ExitError); ok {
-			if status, ok := exit.Sys().(interface{ ExitStatus() int }); ok {
-				exitCode = status.ExitStatus()
-			}
-		}
-	}
+	exitCode, _ := s.proc.Wait()
+	// Report a limit hit that ended the process (e.g. an OOM kill) before the exit status.
+	s.closeLimits()
 
 	s.mu.Lock()
 	s.state = "exited"
@@ -264,12 +276,14 @@ func (s *Session) Run() {
 	_, _ = s.PublishEvent(events.EventKindStatus, map[string]any{"state": "exited", "exit_code": exitCode})
 
 	s.mu.Lock()
-	if s.ptmx != nil {
-		s.ptmx.Close()
+	if c, ok := s.proc.(io.Closer); ok {
+		c.Close()
 	}
+	s.cleanupHolder()
 	if s.logFile != nil {
 		s.logFile.Close()
 	}
+	s.cast.close()
 	s.closed = true
 	for ch := range s.subs {
 		close(ch)
@@ -281,53 +295,137 @@ func (s *Session) Run() {
 	s.eventSubs = nil
 	s.mu.Unlock()
 	s.cancel()
+	// Uploads are only of use while the session runs.
+	if root := s.attach.root; root != "" {
+		if err := os.RemoveAll(root); err != nil {
+			log.Printf("session %s: remove attachments: %v", s.ID, err)
+		}
+	}
+	if s.persist != nil {
+		s.persist()
+	}
+}
+
+// Done returns a channel that is closed once the session has exited and its final state is saved.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
 }
 
-// WriteInput sends input to the PTY.
+// WriteInput sends input to the engine: raw bytes for PTY engines, a message for structured ones.
 func (s *Session) WriteInput(data []byte) error {
 	s.mu.RLock()
-	codex := s.codex
-	threadID := s.codexThreadID
 	closed := s.closed
-	ptmx := s.ptmx
+	proc := s.proc
 	s.mu.RUnlock()
 
-	if closed {
+	if closed || proc == nil {
 		return io.ErrClosedPipe
 	}
-	if codex != nil {
-		text := string(data)
-		text = strings.TrimSpace(text)
-		if text == "" {
-			return nil
-		}
-		if threadID == "" {
-			return errors.New("codex thread not initialized")
-		}
-		if err := s.codexStartTurn(text); err != nil {
-			return err
-		}
-		_, _ = s.PublishEvent(events.EventKindUser, map[string]any{"data": text})
-		return nil
+	if err := proc.SendInput(data); err != nil {
+		return err
 	}
-	if ptmx == nil {
+	s.cast.input(data)
+	return nil
+}
+
+// WriteTurn sends a message like WriteInput, changing the model settings from this message on and
+// attaching uploaded files. Engines that take neither return ErrInvalidArgs.
+func (s *Session) WriteTurn(data []byte, opts TurnOptions) error {
+	s.mu.RLock()
+	closed := s.closed
+	proc := s.proc
+	s.mu.RUnlock()
+
+	if closed || proc == nil {
 		return io.ErrClosedPipe
 	}
-	_, err := ptmx.Write(data)
-	if err == nil {
-		_, _ = s.PublishEvent(events.EventKindUser, map[string]any{"data": string(data)})
+	tc, ok := proc.(TurnConfigurer)
+	if !ok {
+		return fmt.Errorf("%w: the %s engine does not take a model, effort or attachments per message", ErrInvalidArgs, s.Engine)
 	}
-	return err
+	if err := tc.SendTurn(data, opts); err != nil {
+		return err
+	}
+	s.cast.input(data)
+	return nil
 }
 
-// Resize sets the PTY window size.
+// Resize sets the PTY window size. It is a no-op for engines without a PTY.
 func (s *Session) Resize(cols, rows int) error {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	if s.ptmx == nil {
+	proc := s.proc
+	s.mu.RUnlock()
+	r, ok := proc.(Resizer)
+	if !ok {
 		return nil
 	}
-	return pty.Setsize(s.ptmx, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+	if err := r.Resize(cols, rows); err != nil {
+		return err
+	}
+	if s.screen != nil {
+		s.screen.Resize(cols, rows)
+	}
+	s.cast.resize(cols, rows)
+	return nil
+}
+
+// Interrupt stops the engine's current operation (an agent turn, the foreground program of a
+// PTY) without ending the session, and announces it with an "interrupted" status event.
+func (s *Session) Interrupt() error {
+	s.mu.RLock()
+	closed := s.closed
+	proc := s.proc
+	s.mu.RUnlock()
+	if closed || proc == nil {
+		return io.ErrClosedPipe
+	}
+	if err := proc.Interrupt(); err != nil {
+		return err
+	}
+	_, _ = s.PublishEvent(events.EventKindStatus, map[string]any{"state": "interrupted"})
+	return nil
+}
+
+// SetEngineMeta records engine-specific details reported as engine_meta in Info(). The map is
+// replaced rather than updated in place: Info() and registry records hand it out and encode it
+// after the lock is released, so a published map is never written again.
+func (s *Session) SetEngineMeta(meta map[string]any) {
+	s.mu.Lock()
+	next := make(map[string]any, len(s.engineMeta)+len(meta))
+	for k, v := range s.engineMeta {
+		next[k] = v
+	}
+	for k, v := range meta {
+		next[k] = v
+	}
+	s.engineMeta = next
+	s.mu.Unlock()
+}
+
+// WriteOutput appends raw output to the legacy stream: the replay ring buffer, the session log and
+// /ws/sessions subscribers. Engines publish structured events separately with PublishEvent.
+func (s *Session) WriteOutput(chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	s.mu.Lock()
+	if s.ring != nil {
+		s.ring.Write(chunk)
+	}
+	if s.logFile != nil {
+		_, _ = s.logFile.Write(chunk)
+	}
+	if s.screen != nil {
+		_, _ = s.screen.Write(chunk)
+	}
+	s.cast.output(chunk)
+	for ch := range s.subs {
+		select {
+		case ch <- chunk:
+		default:
+		}
+	}
+	s.mu.Unlock()
 }
 
 // Subscribe returns a channel that receives output chunks. Caller must call Unsubscribe.
@@ -368,6 +466,40 @@ func (s *Session) Unsubscribe(ch chan []byte) {
 	s.mu.Unlock()
 }
 
+// SubscribeWithReplay is Subscribe plus the output to show before the first chunk: the rendered
+// screen for PTY sessions (see vt.Terminal.Snapshot), otherwise the ring buffer tail. Both are
+// taken atomically so no output is lost or repeated between them.
+func (s *Session) SubscribeWithReplay(limit int) (chan []byte, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan []byte, 64)
+	if !s.closed {
+		s.subs[ch] = struct{}{}
+	} else {
+		close(ch)
+	}
+	if s.screen != nil {
+		return ch, s.screen.Snapshot()
+	}
+	return ch, s.ring.Snapshot(limit)
+}
+
+// ScreenSnapshot returns the rendered screen of a PTY session, its size and the seq of the last
+// event it reflects: every stdout event with seq <= the returned one is already part of the
+// snapshot. ok is false for sessions without a screen.
+func (s *Session) ScreenSnapshot() (snap []byte, cols, rows int, seq uint64, ok bool) {
+	if s.screen == nil {
+		return nil, 0, 0, 0, false
+	}
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	s.mu.RLock()
+	snap = s.screen.Snapshot()
+	cols, rows = s.screen.Size()
+	s.mu.RUnlock()
+	return snap, cols, rows, s.LastEventSeq(), true
+}
+
 // Replay returns the last N bytes from the ring buffer.
 func (s *Session) Replay(limit int) []byte {
 	return s.ring.Snapshot(limit)
@@ -403,17 +535,13 @@ func (s *Session) State() (state string, exitCode int) {
 
 // Terminate kills the session process.
 func (s *Session) Terminate() error {
-	s.mu.Lock()
-	if s.cmd == nil || s.cmd.Process == nil {
-		s.mu.Unlock()
+	s.mu.RLock()
+	proc := s.proc
+	s.mu.RUnlock()
+	if proc == nil {
 		return nil
 	}
-	proc := s.cmd.Process
-	s.mu.Unlock()
-	// Kill process group for shell and children
-	if proc != nil {
-		_ = proc.Kill()
-	}
+	_ = proc.Stop()
 	select {
 	case <-s.done:
 	case <-time.After(2 * time.Second):
@@ -426,6 +554,8 @@ func (s *Session) Info() map[string]interface{} {
 	s.mu.RLock()
 	state, code := s.state, s.exitCode
 	meta := s.engineMeta
+	restored := s.restored
+	usage, rateLimits := s.usage, s.rateLimits
 	s.mu.RUnlock()
 	out := map[string]interface{}{
 		"id":        s.ID,
@@ -439,6 +569,19 @@ func (s *Session) Info() map[string]interface{} {
 	if meta != nil && len(meta) > 0 {
 		out["engine_meta"] = meta
 	}
+	if restored {
+		out["restored"] = true
+	}
+	if usage != (Usage{}) {
+		out["usage"] = usage
+	}
+	if rateLimits != nil {
+		out["rate_limits"] = rateLimits
+	}
+	if clients, controller := s.Clients(); len(clients) > 0 {
+		out["clients"] = clients
+		out["controller"] = controller
+	}
 	return out
 }
 
@@ -447,6 +590,27 @@ func (s *Session) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s.Info())
 }
 
+// broadcastEvent sends an event to the current subscribers only: it has no seq and is neither
+// buffered for replay nor persisted.
+func (s *Session) broadcastEvent(kind events.EventKind, payload any) {
+	raw, err := events.MarshalPayload(payload)
+	if err != nil {
+		return
+	}
+	ev := events.SessionEvent{SessionID: s.ID, Engine: s.Engine, TsMS: events.NowMS(), Kind: kind, Payload: raw}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	for ch := range s.eventSubs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
 func (s *Session) PublishEvent(kind events.EventKind, payload any) (events.SessionEvent, error) {
 	if s.eventsBuf == nil {
 		return events.SessionEvent{}, nil
@@ -469,13 +633,13 @@ func (s *Session) PublishEvent(kind events.EventKind, payload any) (events.Sessi
 		}
 	}
 
+	// Sends happen under the lock: Run closes the subscriber channels once the session has closed.
 	s.mu.RLock()
-	subs := make([]chan events.SessionEvent, 0, len(s.eventSubs))
-	for ch := range s.eventSubs {
-		subs = append(subs, ch)
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ev, nil
 	}
-	s.mu.RUnlock()
-	for _, ch := range subs {
+	for ch := range s.eventSubs {
 		select {
 		case ch <- ev:
 		default:
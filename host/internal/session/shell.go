@@ -0,0 +1,232 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/policy"
+)
+
+func init() {
+	registerBuiltin(shellEngine{})
+}
+
+// shellAllowlist lists the shells a session may select with args.shell.
+var shellAllowlist = []string{"bash", "zsh", "fish", "sh"}
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// shellEngine runs an interactive shell in a PTY. It is always available (bash is the default).
+type shellEngine struct{}
+
+func (shellEngine) Name() string { return "shell" }
+
+func (shellEngine) Detect(context.Context) EngineInfo {
+	var found []string
+	for _, name := range shellAllowlist {
+		if _, err := exec.LookPath(name); err == nil {
+			found = append(found, name)
+		}
+	}
+	return EngineInfo{
+		Name:         "shell",
+		Available:    true,
+		Capabilities: Capabilities{PTY: true, Interrupt: true},
+		Detail:       "shells: " + strings.Join(found, ", "),
+	}
+}
+
+func (shellEngine) Start(ctx context.Context, s *Session, args map[string]interface{}) (Process, error) {
+	opts, err := parseShellOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	return startShell(ctx, s, opts)
+}
+
+// shellOptions are the args accepted by the shell engine:
+//
+//	shell    one of shellAllowlist (default "bash")
+//	rc       load the user's rc files and prompt (default false: clean shell with PS1 "rc$ ")
+//	login    start a login shell (default false); it reads the profile, so it implies rc and
+//	         rc:false with login:true is rejected
+//	command  a command line typed into the shell once it has started
+//	env      extra environment variables (object of strings)
+type shellOptions struct {
+	Shell     string
+	RC        bool
+	Login     bool
+	Command   string
+	Env       map[string]string
+	Workspace string
+}
+
+func parseShellOptions(args map[string]interface{}) (shellOptions, error) {
+	opts := shellOptions{Shell: "bash"}
+	if v, ok := args["shell"]; ok {
+		name, _ := v.(string)
+		if !isAllowedShell(name) {
+			return opts, fmt.Errorf("%w: shell must be one of %s", ErrInvalidArgs, strings.Join(shellAllowlist, ", "))
+		}
+		opts.Shell = name
+	}
+	rcSet := false
+	for key, dst := range map[string]*bool{"rc": &opts.RC, "login": &opts.Login} {
+		if v, ok := args[key]; ok {
+			b, ok := v.(bool)
+			if !ok {
+				return opts, fmt.Errorf("%w: %s must be a boolean", ErrInvalidArgs, key)
+			}
+			*dst = b
+			rcSet = rcSet || key == "rc"
+		}
+	}
+	if opts.Login {
+		// Skipping rc files (bash --noprofile --norc) would contradict -l.
+		if rcSet && !opts.RC {
+			return opts, fmt.Errorf("%w: login requires rc; a login shell loads the profile", ErrInvalidArgs)
+		}
+		opts.RC = true
+	}
+	if v, ok := args["command"]; ok {
+		cmd, ok := v.(string)
+		if !ok || strings.ContainsAny(cmd, "\r\n") {
+			return opts, fmt.Errorf("%w: command must be a single-line string", ErrInvalidArgs)
+		}
+		opts.Command = strings.TrimSpace(cmd)
+	}
+	env, err := parseEnvArg(args)
+	if err != nil {
+		return opts, err
+	}
+	opts.Env = env
+	opts.Workspace, _ = args["workspacePath"].(string)
+	return opts, nil
+}
+
+// parseEnvArg parses args.env, an object of extra environment variables.
+func parseEnvArg(args map[string]interface{}) (map[string]string, error) {
+	v, ok := args["env"]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: env must be an object of strings", ErrInvalidArgs)
+	}
+	env := make(map[string]string, len(m))
+	for k, val := range m {
+		str, ok := val.(string)
+		if !ok || !envNameRe.MatchString(k) {
+			return nil, fmt.Errorf("%w: env must be an object of strings with valid variable names", ErrInvalidArgs)
+		}
+		env[k] = str
+	}
+	return env, nil
+}
+
+func isAllowedShell(name string) bool {
+	for _, s := range shellAllowlist {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// shellArgv returns the flags that start opts.Shell interactively, optionally skipping rc files.
+func shellArgv(opts shellOptions) []string {
+	var argv []string
+	if !opts.RC {
+		switch opts.Shell {
+		case "bash":
+			argv = append(argv, "--noprofile", "--norc")
+		case "zsh":
+			argv = append(argv, "-f")
+		case "fish":
+			argv = append(argv, "--no-config")
+		}
+	}
+	if opts.Login {
+		argv = append(argv, "-l")
+	}
+	return append(argv, "-i")
+}
+
+// startShell starts an interactive shell in a PTY.
+func startShell(ctx context.Context, s *Session, opts shellOptions) (Process, error) {
+	if opts.Shell == "" {
+		opts.Shell = "bash"
+	}
+	cmd := exec.CommandContext(ctx, opts.Shell, shellArgv(opts)...)
+	if opts.Workspace != "" {
+		cmd.Dir = opts.Workspace
+	}
+	env := append(os.Environ(), "TERM=xterm-256color")
+	if !opts.RC {
+		// Without rc files, use a predictable prompt and keep history out of the user's files.
+		env = append(env,
+			"PS1=rc$ ",
+			"HISTFILE=/dev/null",
+			"HISTSIZE=0",
+			"HISTFILESIZE=0",
+		)
+	}
+	envKeys := make([]string, 0, len(opts.Env))
+	for k, v := range opts.Env {
+		env = append(env, k+"="+v)
+		envKeys = append(envKeys, k)
+	}
+	sort.Strings(envKeys)
+	// Session env goes through the same policy as the host env (e.g. *_API_KEY is dropped).
+	env, removed := policy.EngineEnv(env)
+	cmd.Env = env
+
+	proc, err := s.StartPTY(cmd)
+	if err != nil {
+		return nil, err
+	}
+	meta := map[string]any{
+		"shell": filepath.Base(opts.Shell),
+		"rc":    opts.RC,
+		"login": opts.Login,
+	}
+	if opts.Command != "" {
+		meta["command"] = opts.Command
+	}
+	if len(envKeys) > 0 {
+		// Only names are reported; values may be sensitive.
+		meta["env"] = envKeys
+	}
+	if dropped := intersect(envKeys, removed); len(dropped) > 0 {
+		meta["env_removed"] = dropped
+	}
+	s.SetEngineMeta(meta)
+	if opts.Command != "" {
+		if err := proc.SendInput([]byte(opts.Command + "\n")); err != nil {
+			_ = proc.Stop()
+			return nil, err
+		}
+	}
+	return proc, nil
+}
+
+func intersect(a, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, v := range b {
+		set[v] = true
+	}
+	var out []string
+	for _, v := range a {
+		if set[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseShellOptions(t *testing.T) {
+	bad := []map[string]interface{}{
+		{"shell": "python"},
+		{"shell": "/bin/bash"},
+		{"login": "yes"},
+		{"command": "ls\nrm -rf /"},
+		{"env": map[string]interface{}{"BAD-NAME": "x"}},
+		{"env": map[string]interface{}{"N": 1}},
+		{"login": true, "rc": false},
+	}
+	for _, args := range bad {
+		if _, err := parseShellOptions(args); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("args=%v err=%v want ErrInvalidArgs", args, err)
+		}
+	}
+
+	opts, err := parseShellOptions(map[string]interface{}{"shell": "zsh", "rc": true, "login": true, "command": " make dev "})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if opts.Shell != "zsh" || !opts.RC || !opts.Login || opts.Command != "make dev" {
+		t.Fatalf("opts=%+v", opts)
+	}
+
+	// A login shell loads the profile, so login alone implies rc.
+	opts, err = parseShellOptions(map[string]interface{}{"login": true})
+	if err != nil {
+		t.Fatalf("parse login: %v", err)
+	}
+	if !opts.RC || !opts.Login {
+		t.Fatalf("login opts=%+v", opts)
+	}
+	if got := shellArgv(opts); !reflect.DeepEqual(got, []string{"-l", "-i"}) {
+		t.Fatalf("login argv=%v", got)
+	}
+}
+
+func TestShellArgv(t *testing.T) {
+	cases := []struct {
+		opts shellOptions
+		want []string
+	}{
+		{shellOptions{Shell: "bash"}, []string{"--noprofile", "--norc", "-i"}},
+		{shellOptions{Shell: "bash", RC: true, Login: true}, []string{"-l", "-i"}},
+		{shellOptions{Shell: "zsh"}, []string{"-f", "-i"}},
+		{shellOptions{Shell: "fish"}, []string{"--no-config", "-i"}},
+	}
+	for _, c := range cases {
+		if got := shellArgv(c.opts); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("shellArgv(%+v)=%v want %v", c.opts, got, c.want)
+		}
+	}
+}
+
+func TestShellEngine_CommandAndEnv(t *testing.T) {
+	requirePTY(t)
+
+	m := NewManager(t.TempDir(), 8, filepath.Join(t.TempDir(), "events"))
+	s, err := m.Create(context.Background(), "shell", "", map[string]interface{}{
+		"shell":   "sh",
+		"command": "echo value=$RC_TEST_VAR key=${RC_TEST_API_KEY:-unset}",
+		"env": map[string]interface{}{
+			"RC_TEST_VAR":     "hello",
+			"RC_TEST_API_KEY": "secret",
+		},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer m.Terminate(s.ID)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(s.Replay(0)), "value=hello key=unset") {
+		if time.Now().After(deadline) {
+			t.Fatalf("output=%q", s.Replay(0))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	meta, _ := s.Info()["engine_meta"].(map[string]any)
+	if meta["shell"] != "sh" || meta["rc"] != false {
+		t.Fatalf("engine_meta=%v", meta)
+	}
+	if !reflect.DeepEqual(meta["env"], []string{"RC_TEST_API_KEY", "RC_TEST_VAR"}) ||
+		!reflect.DeepEqual(meta["env_removed"], []string{"RC_TEST_API_KEY"}) {
+		t.Fatalf("engine_meta env=%v removed=%v", meta["env"], meta["env_removed"])
+	}
+}
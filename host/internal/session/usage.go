@@ -0,0 +1,262 @@
+package session
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+const usageFileName = "usage.json"
+
+// usageRetention is how long the host keeps per-day usage.
+const usageRetention = 400 * 24 * time.Hour
+
+// usageSaveDelay batches the ledger writes of a stream of usage reports.
+const usageSaveDelay = 5 * time.Second
+
+// Usage is token usage reported by an agent engine. Fields an engine does not report stay zero.
+type Usage struct {
+	InputTokens           int64 `json:"input_tokens"`
+	CachedInputTokens     int64 `json:"cached_input_tokens"`
+	OutputTokens          int64 `json:"output_tokens"`
+	ReasoningOutputTokens int64 `json:"reasoning_output_tokens"`
+	TotalTokens           int64 `json:"total_tokens"`
+	DurationMS            int64 `json:"duration_ms"` // time spent in turns, for engines that report it
+}
+
+func (u *Usage) add(o Usage) {
+	u.InputTokens += o.InputTokens
+	u.CachedInputTokens += o.CachedInputTokens
+	u.OutputTokens += o.OutputTokens
+	u.ReasoningOutputTokens += o.ReasoningOutputTokens
+	u.TotalTokens += o.TotalTokens
+	u.DurationMS += o.DurationMS
+}
+
+// RateLimitWindow is the state of one rate-limit window of the subscription an engine runs on.
+type RateLimitWindow struct {
+	UsedPercent   float64 `json:"used_percent"`
+	WindowMinutes int64   `json:"window_minutes,omitempty"`
+	ResetsAt      int64   `json:"resets_at,omitempty"` // unix seconds
+}
+
+// RateLimits are the rate limits an engine last reported. Codex reports a short (primary) and a
+// long (secondary) window.
+type RateLimits struct {
+	Primary   *RateLimitWindow `json:"primary,omitempty"`
+	Secondary *RateLimitWindow `json:"secondary,omitempty"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// ReportUsage adds u to the session's and the host's usage totals and publishes it as a metrics
+// event; extra adds engine-specific fields to the event. The session's totals are saved with its
+// registry record at the end of the turn (see saveUsage) or when the session exits, so they
+// outlive a host restart.
+func (s *Session) ReportUsage(u Usage, extra map[string]any) {
+	s.mu.Lock()
+	s.usage.add(u)
+	s.usageDirty = true
+	total := s.usage
+	s.mu.Unlock()
+	s.usageLedger.add(s.Engine, time.Now(), u)
+	payload := map[string]any{"token_usage": u, "session_usage": total}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	_, _ = s.PublishEvent(events.EventKindMetrics, payload)
+}
+
+// saveUsage saves the session's registry record if its usage changed since the last save. Engines
+// call it at the end of each turn, so the reports streamed during a turn cost one write.
+func (s *Session) saveUsage() {
+	s.mu.Lock()
+	dirty := s.usageDirty
+	s.usageDirty = false
+	s.mu.Unlock()
+	if dirty && s.persist != nil {
+		s.persist()
+	}
+}
+
+// ReportRateLimits records the engine's latest rate limits for Info and GET /api/usage and
+// publishes them as a metrics event.
+func (s *Session) ReportRateLimits(rl RateLimits) {
+	rl.UpdatedAt = time.Now().UTC()
+	s.mu.Lock()
+	s.rateLimits = &rl
+	s.mu.Unlock()
+	s.usageLedger.setRateLimits(s.Engine, rl)
+	_, _ = s.PublishEvent(events.EventKindMetrics, map[string]any{"rate_limits": rl})
+}
+
+// usageLedger keeps the host's token usage per day (in the host's time zone) and engine, and the
+// latest rate limits of each engine, in a JSON file next to the session registry. Changes are
+// saved usageSaveDelay after the first one, and by Flush. A nil ledger discards everything.
+type usageLedger struct {
+	mu    sync.Mutex
+	path  string
+	data  usageData
+	dirty bool
+	timer *time.Timer // pending save
+}
+
+type usageData struct {
+	Days       map[string]map[string]Usage `json:"days"`        // date → engine → usage
+	RateLimits map[string]RateLimits       `json:"rate_limits"` // by engine
+}
+
+func newUsageLedger(dir string) *usageLedger {
+	l := &usageLedger{path: filepath.Join(dir, usageFileName)}
+	if b, err := os.ReadFile(l.path); err == nil {
+		if err := json.Unmarshal(b, &l.data); err != nil {
+			log.Printf("usage ledger %s: %v", l.path, err)
+		}
+	}
+	return l
+}
+
+func (l *usageLedger) add(engine string, at time.Time, u Usage) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.data.Days == nil {
+		l.data.Days = make(map[string]map[string]Usage)
+	}
+	date := at.Format(time.DateOnly)
+	day := l.data.Days[date]
+	if day == nil {
+		day = make(map[string]Usage)
+		l.data.Days[date] = day
+		oldest := at.Add(-usageRetention).Format(time.DateOnly)
+		for d := range l.data.Days {
+			if d < oldest {
+				delete(l.data.Days, d)
+			}
+		}
+	}
+	total := day[engine]
+	total.add(u)
+	day[engine] = total
+	l.changedLocked()
+}
+
+func (l *usageLedger) setRateLimits(engine string, rl RateLimits) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.data.RateLimits == nil {
+		l.data.RateLimits = make(map[string]RateLimits)
+	}
+	l.data.RateLimits[engine] = rl
+	l.changedLocked()
+}
+
+// changedLocked schedules a save of the ledger unless one is pending.
+func (l *usageLedger) changedLocked() {
+	l.dirty = true
+	if l.timer == nil {
+		l.timer = time.AfterFunc(usageSaveDelay, l.flush)
+	}
+}
+
+// flush saves pending changes now.
+func (l *usageLedger) flush() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if l.dirty {
+		l.saveLocked()
+		l.dirty = false
+	}
+}
+
+// saveLocked atomically replaces the ledger file; failures are logged, as usage is best effort.
+func (l *usageLedger) saveLocked() {
+	b, err := json.MarshalIndent(l.data, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(l.path), 0o700)
+	}
+	if err == nil {
+		tmp := l.path + ".tmp"
+		if err = os.WriteFile(tmp, b, 0o600); err == nil {
+			err = os.Rename(tmp, l.path)
+		}
+	}
+	if err != nil {
+		log.Printf("usage ledger %s: %v", l.path, err)
+	}
+}
+
+// UsageReport is the host's usage over the last days, for GET /api/usage.
+type UsageReport struct {
+	Days       []DayUsage            `json:"days"`    // days with usage, newest first
+	Engines    map[string]Usage      `json:"engines"` // totals over Days
+	Total      Usage                 `json:"total"`
+	RateLimits map[string]RateLimits `json:"rate_limits"` // latest, by engine
+}
+
+// DayUsage is the usage of one day.
+type DayUsage struct {
+	Date    string           `json:"date"` // YYYY-MM-DD in the host's time zone
+	Total   Usage            `json:"total"`
+	Engines map[string]Usage `json:"engines"`
+}
+
+// report rolls up the usage of the days days up to and including now's.
+func (l *usageLedger) report(now time.Time, days int) UsageReport {
+	r := UsageReport{Days: []DayUsage{}, Engines: map[string]Usage{}, RateLimits: map[string]RateLimits{}}
+	if l == nil {
+		return r
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	from := now.AddDate(0, 0, 1-days).Format(time.DateOnly)
+	to := now.Format(time.DateOnly)
+	for date, engines := range l.data.Days {
+		if date < from || date > to {
+			continue
+		}
+		d := DayUsage{Date: date, Engines: map[string]Usage{}}
+		for engine, u := range engines {
+			d.Engines[engine] = u
+			d.Total.add(u)
+			e := r.Engines[engine]
+			e.add(u)
+			r.Engines[engine] = e
+		}
+		r.Total.add(d.Total)
+		r.Days = append(r.Days, d)
+	}
+	sort.Slice(r.Days, func(i, j int) bool { return r.Days[i].Date > r.Days[j].Date })
+	for engine, rl := range l.data.RateLimits {
+		r.RateLimits[engine] = rl
+	}
+	return r
+}
+
+// FlushUsage saves usage that is still pending; the host calls it when it shuts down.
+func (m *Manager) FlushUsage() {
+	m.usage.flush()
+}
+
+// Usage reports the host's token usage over the last days days (today included) and the latest
+// rate limits of each engine.
+func (m *Manager) Usage(days int) UsageReport {
+	return m.usage.report(time.Now(), days)
+}
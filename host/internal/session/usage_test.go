@@ -0,0 +1,110 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ericbosch/cli-remote-control/host/internal/events"
+)
+
+func TestCodexUsage(t *testing.T) {
+	fakeCodex(t)
+	logDir := t.TempDir()
+	eventsDir := filepath.Join(t.TempDir(), "events")
+	m := NewManager(logDir, 8, eventsDir)
+	s, err := m.Create(context.Background(), "codex", "", map[string]interface{}{"prompt": "usage"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer s.Terminate()
+	waitEvent(t, s, events.EventKindMetrics, "rate_limits")
+
+	var metrics []map[string]any
+	for _, ev := range s.ReplayEventsFromSeq(0) {
+		if ev.Kind == events.EventKindMetrics {
+			var p map[string]any
+			_ = json.Unmarshal(ev.Payload, &p)
+			metrics = append(metrics, p)
+		}
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("metrics events=%v", metrics)
+	}
+	if last, _ := metrics[1]["token_usage"].(map[string]any); last["total_tokens"] != float64(50) || metrics[1]["thread_total_tokens"] != float64(150) || metrics[1]["context_window"] != float64(200000) {
+		t.Fatalf("second usage event=%v", metrics[1])
+	}
+	if total, _ := metrics[1]["session_usage"].(map[string]any); total["total_tokens"] != float64(150) {
+		t.Fatalf("session_usage=%v", metrics[1]["session_usage"])
+	}
+
+	want := Usage{InputTokens: 130, CachedInputTokens: 40, OutputTokens: 20, ReasoningOutputTokens: 10, TotalTokens: 150}
+	if got := s.Info()["usage"]; got != want {
+		t.Fatalf("session usage=%+v", got)
+	}
+	rl, _ := s.Info()["rate_limits"].(*RateLimits)
+	if rl == nil || *rl.Primary != (RateLimitWindow{UsedPercent: 42.5, WindowMinutes: 300, ResetsAt: 1700003600}) || rl.Secondary.UsedPercent != 7 {
+		t.Fatalf("rate limits=%+v", s.Info()["rate_limits"])
+	}
+
+	r := m.Usage(7)
+	if len(r.Days) != 1 || r.Days[0].Date != time.Now().Format(time.DateOnly) || r.Days[0].Engines["codex"] != want || r.Total != want || r.Engines["codex"] != want {
+		t.Fatalf("report=%+v", r)
+	}
+	if r.RateLimits["codex"].Primary.UsedPercent != 42.5 {
+		t.Fatalf("report rate limits=%+v", r.RateLimits)
+	}
+
+	// The ledger is written after a delay or on shutdown, not on every report.
+	waitEvent(t, s, events.EventKindThinkingDone, "")
+	if _, err := os.Stat(filepath.Join(eventsDir, usageFileName)); !os.IsNotExist(err) {
+		t.Fatalf("usage ledger written before a flush: %v", err)
+	}
+	m.FlushUsage()
+
+	// Host usage and the session's totals survive a restart.
+	m2 := NewManager(logDir, 8, eventsDir)
+	if err := m2.Restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if r := m2.Usage(1); r.Total != want {
+		t.Fatalf("report after restart=%+v", r)
+	}
+	if got := m2.Get(s.ID).Info()["usage"]; got != want {
+		t.Fatalf("restored session usage=%+v", got)
+	}
+}
+
+func TestUsageLedgerReport(t *testing.T) {
+	l := newUsageLedger(t.TempDir())
+	defer l.flush()
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.Local) }
+	l.add("codex", day(1), Usage{TotalTokens: 1})
+	l.add("codex", day(9), Usage{TotalTokens: 10})
+	l.add("cursor", day(9), Usage{TotalTokens: 20, DurationMS: 300})
+	l.add("codex", day(10), Usage{TotalTokens: 100})
+
+	r := l.report(day(10), 2)
+	want := UsageReport{
+		Days: []DayUsage{
+			{Date: "2026-03-10", Total: Usage{TotalTokens: 100}, Engines: map[string]Usage{"codex": {TotalTokens: 100}}},
+			{Date: "2026-03-09", Total: Usage{TotalTokens: 30, DurationMS: 300}, Engines: map[string]Usage{"codex": {TotalTokens: 10}, "cursor": {TotalTokens: 20, DurationMS: 300}}},
+		},
+		Engines:    map[string]Usage{"codex": {TotalTokens: 110}, "cursor": {TotalTokens: 20, DurationMS: 300}},
+		Total:      Usage{TotalTokens: 130, DurationMS: 300},
+		RateLimits: map[string]RateLimits{},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("report=%+v\nwant %+v", r, want)
+	}
+
+	// Days past the retention are dropped once a new day starts.
+	l.add("codex", day(1).Add(usageRetention+24*time.Hour), Usage{TotalTokens: 1})
+	if _, ok := l.data.Days["2026-03-01"]; ok {
+		t.Fatal("expired day kept")
+	}
+}
@@ -0,0 +1,456 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateOSC
+	stateOSCEscape
+	stateString // DCS, SOS, PM, APC: ignored until ST
+	stateStringEscape
+)
+
+const maxOSCLen = 4096
+
+// parser is a byte-oriented ANSI/VT escape sequence parser (after the DEC/xterm state machine,
+// simplified). UTF-8 sequences split across writes are carried over.
+type parser struct {
+	state        parserState
+	utf8         []byte
+	private      byte // CSI private marker: ? > < =
+	params       []byte
+	intermediate []byte
+	osc          []byte
+}
+
+func (p *parser) feed(t *Terminal, b []byte) {
+	if len(p.utf8) > 0 {
+		b = append(p.utf8, b...)
+		p.utf8 = nil
+	}
+	for i := 0; i < len(b); {
+		c := b[i]
+		if p.state == stateGround && c >= 0x80 {
+			if !utf8.FullRune(b[i:]) {
+				p.utf8 = append([]byte(nil), b[i:]...)
+				return
+			}
+			r, n := utf8.DecodeRune(b[i:])
+			i += n
+			if r >= 0x80 && r < 0xa0 {
+				continue // C1 controls are not used in UTF-8 streams
+			}
+			t.print(r)
+			continue
+		}
+		i++
+		p.step(t, c)
+	}
+}
+
+func (p *parser) step(t *Terminal, c byte) {
+	// CAN and SUB abort any sequence; ESC starts a new one (except where it may begin ST).
+	switch {
+	case c == 0x18 || c == 0x1a:
+		p.state = stateGround
+		return
+	case c == 0x1b && p.state != stateOSC && p.state != stateString:
+		p.enterEscape()
+		return
+	}
+	switch p.state {
+	case stateGround:
+		if c < 0x20 || c == 0x7f {
+			p.control(t, c)
+			return
+		}
+		t.print(rune(c))
+	case stateEscape:
+		p.escape(t, c)
+	case stateEscapeIntermediate:
+		if c >= 0x20 && c <= 0x2f {
+			p.intermediate = append(p.intermediate, c)
+			return
+		}
+		if c < 0x20 {
+			p.control(t, c)
+			return
+		}
+		p.escapeDispatch(t, c)
+		p.state = stateGround
+	case stateCSI:
+		switch {
+		case c < 0x20:
+			p.control(t, c)
+		case c >= '0' && c <= ';':
+			p.params = append(p.params, c)
+		case c >= '<' && c <= '?':
+			if len(p.params) == 0 && p.private == 0 {
+				p.private = c
+			}
+		case c >= 0x20 && c <= 0x2f:
+			p.intermediate = append(p.intermediate, c)
+		case c >= 0x40 && c <= 0x7e:
+			p.csiDispatch(t, c)
+			p.state = stateGround
+		}
+	case stateOSC:
+		switch c {
+		case 0x07:
+			p.oscDispatch(t)
+			p.state = stateGround
+		case 0x1b:
+			p.state = stateOSCEscape
+		default:
+			if len(p.osc) < maxOSCLen {
+				p.osc = append(p.osc, c)
+			}
+		}
+	case stateOSCEscape:
+		if c == '\\' {
+			p.oscDispatch(t)
+			p.state = stateGround
+			return
+		}
+		p.enterEscape()
+		p.escape(t, c)
+	case stateString:
+		if c == 0x1b {
+			p.state = stateStringEscape
+		}
+	case stateStringEscape:
+		if c == '\\' {
+			p.state = stateGround
+			return
+		}
+		p.state = stateString
+	}
+}
+
+func (p *parser) enterEscape() {
+	p.state = stateEscape
+	p.private = 0
+	p.params = p.params[:0]
+	p.intermediate = p.intermediate[:0]
+}
+
+func (p *parser) control(t *Terminal, c byte) {
+	switch c {
+	case '\b':
+		if t.cur.x > 0 {
+			t.cur.x--
+		}
+		t.cur.pendingWrap = false
+	case '\t':
+		t.cur.x = min((t.cur.x/8+1)*8, t.cols-1)
+		t.cur.pendingWrap = false
+	case '\n', '\v', '\f':
+		t.index()
+		t.cur.pendingWrap = false
+	case '\r':
+		t.cur.x = 0
+		t.cur.pendingWrap = false
+	case 0x0e, 0x0f:
+		// SO/SI (G1/G0 shift) are rarely used; only G0 designation is tracked.
+	}
+}
+
+func (p *parser) escape(t *Terminal, c byte) {
+	switch {
+	case c == '[':
+		p.state = stateCSI
+	case c == ']':
+		p.state = stateOSC
+		p.osc = p.osc[:0]
+	case c == 'P' || c == 'X' || c == '^' || c == '_':
+		p.state = stateString
+	case c >= 0x20 && c <= 0x2f:
+		p.intermediate = append(p.intermediate, c)
+		p.state = stateEscapeIntermediate
+	case c < 0x20:
+		p.control(t, c)
+	default:
+		p.escapeDispatch(t, c)
+		p.state = stateGround
+	}
+}
+
+func (p *parser) escapeDispatch(t *Terminal, c byte) {
+	if len(p.intermediate) > 0 {
+		// ESC ( X designates the G0 character set; DEC line drawing is '0'.
+		if p.intermediate[0] == '(' {
+			t.cur.charset = c
+		}
+		return
+	}
+	switch c {
+	case '7':
+		t.saveCursor()
+	case '8':
+		t.restoreCursor()
+	case 'D':
+		t.index()
+	case 'E':
+		t.cur.x = 0
+		t.index()
+	case 'M':
+		t.reverseIndex()
+	case 'c':
+		t.reset(t.cols, t.rows)
+		t.scrollback = nil
+	}
+}
+
+func (p *parser) oscDispatch(t *Terminal) {
+	cmd, arg, _ := strings.Cut(string(p.osc), ";")
+	if cmd == "0" || cmd == "2" {
+		t.title = arg
+	}
+}
+
+// csiParams splits the parameter bytes into parameters and their ':' subparameters. Missing
+// values are -1.
+func (p *parser) csiParams() [][]int {
+	if len(p.params) == 0 {
+		return nil
+	}
+	var out [][]int
+	for _, field := range strings.Split(string(p.params), ";") {
+		var sub []int
+		for _, s := range strings.Split(field, ":") {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				n = -1
+			}
+			if n > 65535 {
+				n = 65535
+			}
+			sub = append(sub, n)
+		}
+		out = append(out, sub)
+	}
+	return out
+}
+
+// param returns parameter i, or def when it is missing or zero (for counts) / missing (for modes).
+func param(ps [][]int, i, def int) int {
+	if i >= len(ps) || ps[i][0] <= 0 {
+		return def
+	}
+	return ps[i][0]
+}
+
+func (p *parser) csiDispatch(t *Terminal, final byte) {
+	ps := p.csiParams()
+	if len(p.intermediate) > 0 {
+		return // e.g. DECSCUSR (CSI Ps SP q), DECSTR (CSI ! p): not needed for the screen
+	}
+	if p.private == '?' {
+		if final == 'h' || final == 'l' {
+			for _, m := range ps {
+				t.setPrivateMode(m[0], final == 'h')
+			}
+		}
+		return
+	}
+	if p.private != 0 {
+		return
+	}
+	if final != 'm' && final != 'h' && final != 'l' {
+		t.cur.pendingWrap = false
+	}
+	switch final {
+	case '@':
+		t.insertChars(param(ps, 0, 1))
+	case 'A':
+		y := max(t.cur.y-param(ps, 0, 1), 0)
+		if t.cur.y >= t.top {
+			y = max(y, t.top)
+		}
+		t.cur.y = y
+	case 'B', 'e':
+		y := min(t.cur.y+param(ps, 0, 1), t.rows-1)
+		if t.cur.y <= t.bottom {
+			y = min(y, t.bottom)
+		}
+		t.cur.y = y
+	case 'C', 'a':
+		t.cur.x = min(t.cur.x+param(ps, 0, 1), t.cols-1)
+	case 'D':
+		t.cur.x = max(t.cur.x-param(ps, 0, 1), 0)
+	case 'E':
+		t.cur.x = 0
+		t.cur.y = min(t.cur.y+param(ps, 0, 1), t.bottom)
+	case 'F':
+		t.cur.x = 0
+		t.cur.y = max(t.cur.y-param(ps, 0, 1), t.top)
+	case 'G', '`':
+		t.cur.x = min(param(ps, 0, 1), t.cols) - 1
+	case 'H', 'f':
+		t.moveTo(param(ps, 1, 1)-1, param(ps, 0, 1)-1)
+	case 'I':
+		for i := 0; i < param(ps, 0, 1); i++ {
+			t.cur.x = min((t.cur.x/8+1)*8, t.cols-1)
+		}
+	case 'J':
+		t.eraseDisplay(max(param(ps, 0, 0), 0))
+	case 'K':
+		t.eraseLine(max(param(ps, 0, 0), 0))
+	case 'L':
+		t.insertLines(param(ps, 0, 1))
+	case 'M':
+		t.deleteLines(param(ps, 0, 1))
+	case 'P':
+		t.deleteChars(param(ps, 0, 1))
+	case 'S':
+		t.scrollUp(param(ps, 0, 1))
+	case 'T':
+		t.scrollDown(param(ps, 0, 1))
+	case 'X':
+		t.eraseCells(t.cur.y, t.cur.x, t.cur.x+param(ps, 0, 1))
+	case 'b':
+		if t.lastPrinted != 0 {
+			for i := min(param(ps, 0, 1), t.cols*t.rows); i > 0; i-- {
+				t.print(t.lastPrinted)
+			}
+		}
+	case 'd':
+		t.moveTo(t.cur.x, param(ps, 0, 1)-1)
+	case 'h', 'l':
+		for _, m := range ps {
+			if m[0] == 4 {
+				t.insert = final == 'h'
+			}
+		}
+	case 'm':
+		t.sgr(ps)
+	case 'r':
+		top, bottom := param(ps, 0, 1)-1, param(ps, 1, t.rows)-1
+		if bottom >= t.rows {
+			bottom = t.rows - 1
+		}
+		if top < bottom {
+			t.top, t.bottom = top, bottom
+			t.moveTo(0, 0)
+		}
+	case 's':
+		t.saveCursor()
+	case 'u':
+		t.restoreCursor()
+	}
+}
+
+func (t *Terminal) sgr(ps [][]int) {
+	if len(ps) == 0 {
+		t.cur.attr = Attr{}
+		return
+	}
+	for i := 0; i < len(ps); i++ {
+		n := ps[i][0]
+		switch {
+		case n <= 0:
+			t.cur.attr = Attr{}
+		case n == 1:
+			t.cur.attr.Flags |= AttrBold
+		case n == 2:
+			t.cur.attr.Flags |= AttrDim
+		case n == 3:
+			t.cur.attr.Flags |= AttrItalic
+		case n == 4:
+			if len(ps[i]) > 1 && ps[i][1] == 0 {
+				t.cur.attr.Flags &^= AttrUnderline
+			} else {
+				t.cur.attr.Flags |= AttrUnderline
+			}
+		case n == 5 || n == 6:
+			t.cur.attr.Flags |= AttrBlink
+		case n == 7:
+			t.cur.attr.Flags |= AttrInverse
+		case n == 8:
+			t.cur.attr.Flags |= AttrHidden
+		case n == 9:
+			t.cur.attr.Flags |= AttrStrike
+		case n == 21 || n == 24:
+			t.cur.attr.Flags &^= AttrUnderline
+		case n == 22:
+			t.cur.attr.Flags &^= AttrBold | AttrDim
+		case n == 23:
+			t.cur.attr.Flags &^= AttrItalic
+		case n == 25:
+			t.cur.attr.Flags &^= AttrBlink
+		case n == 27:
+			t.cur.attr.Flags &^= AttrInverse
+		case n == 28:
+			t.cur.attr.Flags &^= AttrHidden
+		case n == 29:
+			t.cur.attr.Flags &^= AttrStrike
+		case n >= 30 && n <= 37:
+			t.cur.attr.FG = PaletteColor(uint8(n - 30))
+		case n == 38:
+			var c Color
+			c, i = extendedColor(ps, i)
+			t.cur.attr.FG = c
+		case n == 39:
+			t.cur.attr.FG = 0
+		case n >= 40 && n <= 47:
+			t.cur.attr.BG = PaletteColor(uint8(n - 40))
+		case n == 48:
+			var c Color
+			c, i = extendedColor(ps, i)
+			t.cur.attr.BG = c
+		case n == 49:
+			t.cur.attr.BG = 0
+		case n >= 90 && n <= 97:
+			t.cur.attr.FG = PaletteColor(uint8(n - 90 + 8))
+		case n >= 100 && n <= 107:
+			t.cur.attr.BG = PaletteColor(uint8(n - 100 + 8))
+		}
+	}
+}
+
+// extendedColor parses 38/48 color arguments in either the ';' form (38;5;n / 38;2;r;g;b) or the
+// ':' form (38:5:n / 38:2:[cs]:r:g:b). It returns the color and the index of the last parameter
+// consumed.
+func extendedColor(ps [][]int, i int) (Color, int) {
+	byte8 := func(v int) uint8 { return uint8(max(0, min(v, 255))) }
+	if sub := ps[i]; len(sub) > 1 {
+		switch sub[1] {
+		case 5:
+			if len(sub) > 2 {
+				return PaletteColor(byte8(sub[2])), i
+			}
+		case 2:
+			rgb := sub[2:]
+			if len(rgb) == 4 {
+				rgb = rgb[1:] // colorspace id
+			}
+			if len(rgb) == 3 {
+				return RGBColor(byte8(rgb[0]), byte8(rgb[1]), byte8(rgb[2])), i
+			}
+		}
+		return 0, i
+	}
+	if i+1 >= len(ps) {
+		return 0, i
+	}
+	switch ps[i+1][0] {
+	case 5:
+		if i+2 < len(ps) {
+			return PaletteColor(byte8(ps[i+2][0])), i + 2
+		}
+	case 2:
+		if i+4 < len(ps) {
+			return RGBColor(byte8(ps[i+2][0]), byte8(ps[i+3][0]), byte8(ps[i+4][0])), i + 4
+		}
+	}
+	return 0, len(ps) - 1
+}
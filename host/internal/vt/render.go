@@ -0,0 +1,177 @@
+package vt
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Snapshot renders the terminal as a byte stream that, written to a terminal of the same size,
+// reproduces the current state: scrollback, screen contents and attributes, the alternate screen,
+// scroll region, cursor position and visibility, title and input modes (cursor keys, mouse
+// reporting, bracketed paste). It starts with a full reset (ESC c).
+func (t *Terminal) Snapshot() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("\x1bc")
+	if t.title != "" {
+		b.WriteString("\x1b]2;" + t.title + "\x07")
+	}
+	// Scrollback and the primary screen are written as consecutive lines, so the client scrolls
+	// the older lines into its own scrollback.
+	for _, l := range t.scrollback {
+		writeLine(&b, l)
+		b.WriteString("\x1b[0m\r\n")
+	}
+	for i, l := range t.primary {
+		writeLine(&b, l)
+		b.WriteString("\x1b[0m")
+		if i < len(t.primary)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	if t.altActive {
+		b.WriteString("\x1b[?1049h\x1b[H\x1b[2J")
+		for i, l := range t.alt {
+			b.WriteString("\x1b[" + strconv.Itoa(i+1) + ";1H")
+			writeLine(&b, l)
+			b.WriteString("\x1b[0m")
+		}
+	}
+	if t.top != 0 || t.bottom != t.rows-1 {
+		b.WriteString("\x1b[" + strconv.Itoa(t.top+1) + ";" + strconv.Itoa(t.bottom+1) + "r")
+	}
+	for _, m := range sortedModes(t.modes) {
+		b.WriteString("\x1b[?" + strconv.Itoa(m) + "h")
+	}
+	if !t.autowrap {
+		b.WriteString("\x1b[?7l")
+	}
+	if t.insert {
+		b.WriteString("\x1b[4h")
+	}
+	if t.cur.origin {
+		// Origin mode makes CUP relative to the region; position the cursor in absolute terms first.
+		b.WriteString("\x1b[" + strconv.Itoa(t.cur.y+1) + ";" + strconv.Itoa(t.cur.x+1) + "H\x1b[?6h")
+		b.WriteString("\x1b[" + strconv.Itoa(t.cur.y-t.top+1) + ";" + strconv.Itoa(t.cur.x+1) + "H")
+	} else {
+		b.WriteString("\x1b[" + strconv.Itoa(t.cur.y+1) + ";" + strconv.Itoa(t.cur.x+1) + "H")
+	}
+	if t.cur.charset == '0' {
+		b.WriteString("\x1b(0")
+	}
+	b.WriteString(sgrString(t.cur.attr))
+	if t.cursorHidden {
+		b.WriteString("\x1b[?25l")
+	}
+	return []byte(b.String())
+}
+
+func sortedModes(m map[int]bool) []int {
+	out := make([]int, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// writeLine renders one line, omitting trailing blank cells with the default background.
+func writeLine(b *strings.Builder, l []Cell) {
+	end := len(l)
+	for end > 0 && (l[end-1].Ch == ' ' && l[end-1].Attr == Attr{}) {
+		end--
+	}
+	cur := Attr{}
+	for _, c := range l[:end] {
+		if c.Ch == 0 {
+			continue // right half of a wide character
+		}
+		if c.Attr != cur {
+			b.WriteString(sgrString(c.Attr))
+			cur = c.Attr
+		}
+		b.WriteRune(c.Ch)
+	}
+}
+
+// sgrString returns the SGR sequence that sets exactly a.
+func sgrString(a Attr) string {
+	parts := []string{"0"}
+	for i, code := range []string{"1", "2", "3", "4", "5", "7", "8", "9"} {
+		if a.Flags&(1<<i) != 0 {
+			parts = append(parts, code)
+		}
+	}
+	if a.FG != 0 {
+		parts = append(parts, colorParams(a.FG, 30, 90, 38))
+	}
+	if a.BG != 0 {
+		parts = append(parts, colorParams(a.BG, 40, 100, 48))
+	}
+	return "\x1b[" + strings.Join(parts, ";") + "m"
+}
+
+func colorParams(c Color, base, brightBase, ext int) string {
+	v := int(c & colorValue)
+	if c&colorRGB != 0 {
+		return strconv.Itoa(ext) + ";2;" + strconv.Itoa(v>>16&0xff) + ";" + strconv.Itoa(v>>8&0xff) + ";" + strconv.Itoa(v&0xff)
+	}
+	switch {
+	case v < 8:
+		return strconv.Itoa(base + v)
+	case v < 16:
+		return strconv.Itoa(brightBase + v - 8)
+	}
+	return strconv.Itoa(ext) + ";5;" + strconv.Itoa(v)
+}
+
+// runeWidth returns the number of cells r occupies: 0 for combining marks and other zero-width
+// characters, 2 for East Asian wide characters and emoji, 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0:
+		return 0
+	case r < 0x300:
+		return 1
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case isWide(r):
+		return 2
+	}
+	return 1
+}
+
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec}, {0x23f0, 0x23f0},
+	{0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615}, {0x2648, 0x2653}, {0x267f, 0x267f},
+	{0x2693, 0x2693}, {0x26a1, 0x26a1}, {0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5},
+	{0x26ce, 0x26ce}, {0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b}, {0x2728, 0x2728},
+	{0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797},
+	{0x27b0, 0x27b0}, {0x27bf, 0x27bf}, {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55},
+	{0x2e80, 0x303e}, {0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19}, {0xfe30, 0xfe6f},
+	{0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x16fe0, 0x16fe4}, {0x17000, 0x18cff}, {0x1b000, 0x1b2ff},
+	{0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf}, {0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a},
+	{0x1f200, 0x1f251}, {0x1f300, 0x1f64f}, {0x1f680, 0x1f6ff}, {0x1f7e0, 0x1f7eb},
+	{0x1f90c, 0x1f9ff}, {0x1fa70, 0x1faff}, {0x20000, 0x3fffd},
+}
+
+func isWide(r rune) bool {
+	lo, hi := 0, len(wideRanges)
+	for lo < hi {
+		m := (lo + hi) / 2
+		switch {
+		case r < wideRanges[m][0]:
+			hi = m
+		case r > wideRanges[m][1]:
+			lo = m + 1
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,560 @@
+// Package vt is a minimal headless terminal emulator. It keeps the screen state of a PTY session
+// (cells, attributes, cursor, modes, alternate screen and scrollback) so a client that attaches
+// late can be sent a rendered snapshot instead of a raw output tail that may start in the middle
+// of an escape sequence.
+//
+// It implements the subset of xterm used by shells and common full-screen programs; unknown
+// sequences are parsed and ignored. Device status queries are not answered: the attached client
+// terminal already does that.
+package vt
+
+import "sync"
+
+// Color is a cell color: 0 is the terminal default, otherwise either a palette index or a 24-bit
+// RGB value tagged with colorPalette or colorRGB.
+type Color uint32
+
+const (
+	colorPalette Color = 1 << 24
+	colorRGB     Color = 2 << 24
+	colorValue   Color = 1<<24 - 1
+)
+
+// PaletteColor returns the palette color n (0-255).
+func PaletteColor(n uint8) Color { return colorPalette | Color(n) }
+
+// RGBColor returns a 24-bit color.
+func RGBColor(r, g, b uint8) Color {
+	return colorRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// Attribute flags.
+const (
+	AttrBold uint16 = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrInverse
+	AttrHidden
+	AttrStrike
+)
+
+// Attr is the rendition of a cell.
+type Attr struct {
+	FG, BG Color
+	Flags  uint16
+}
+
+// Cell is one character cell. The right half of a double-width character has Ch == 0.
+type Cell struct {
+	Ch   rune
+	Attr Attr
+}
+
+var blankCell = Cell{Ch: ' '}
+
+type cursor struct {
+	x, y        int
+	attr        Attr
+	pendingWrap bool
+	origin      bool
+	charset     byte
+}
+
+// passthroughModes are DEC private modes the emulator only records so a snapshot can restore
+// them on the client: cursor keys, mouse reporting, focus events and bracketed paste.
+var passthroughModes = map[int]bool{1: true, 9: true, 1000: true, 1002: true, 1003: true, 1004: true, 1005: true, 1006: true, 1015: true, 2004: true}
+
+// Terminal is a headless terminal. It is safe for concurrent use.
+type Terminal struct {
+	mu sync.Mutex
+
+	cols, rows int
+	primary    [][]Cell
+	alt        [][]Cell
+	lines      [][]Cell // primary or alt
+	altActive  bool
+
+	cur          cursor
+	savedPrimary cursor
+	savedAlt     cursor
+	top, bottom  int // scroll region, inclusive
+
+	autowrap     bool
+	insert       bool
+	cursorHidden bool
+	modes        map[int]bool
+	title        string
+	lastPrinted  rune
+
+	scrollback    [][]Cell
+	maxScrollback int
+
+	p parser
+}
+
+// New returns a terminal of the given size that keeps up to scrollback lines scrolled off the
+// top of the primary screen.
+func New(cols, rows, scrollback int) *Terminal {
+	t := &Terminal{maxScrollback: scrollback}
+	t.reset(clampSize(cols), clampSize(rows))
+	return t
+}
+
+func clampSize(n int) int {
+	if n < 1 {
+		return 1
+	}
+	if n > 1000 {
+		return 1000
+	}
+	return n
+}
+
+func (t *Terminal) reset(cols, rows int) {
+	t.cols, t.rows = cols, rows
+	t.primary = newLines(cols, rows)
+	t.alt = nil
+	t.lines = t.primary
+	t.altActive = false
+	t.cur = cursor{}
+	t.savedPrimary = cursor{}
+	t.savedAlt = cursor{}
+	t.top, t.bottom = 0, rows-1
+	t.autowrap = true
+	t.insert = false
+	t.cursorHidden = false
+	t.modes = make(map[int]bool)
+	t.title = ""
+	t.p = parser{}
+}
+
+func newLines(cols, rows int) [][]Cell {
+	out := make([][]Cell, rows)
+	for i := range out {
+		out[i] = newLine(cols, Attr{})
+	}
+	return out
+}
+
+func newLine(cols int, a Attr) []Cell {
+	l := make([]Cell, cols)
+	for i := range l {
+		l[i] = Cell{Ch: ' ', Attr: Attr{BG: a.BG}}
+	}
+	return l
+}
+
+// Write feeds terminal output to the emulator. It never fails.
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.feed(t, p)
+	return len(p), nil
+}
+
+// Size returns the terminal size.
+func (t *Terminal) Size() (cols, rows int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cols, t.rows
+}
+
+// Title returns the window title last set with OSC 0 or 2.
+func (t *Terminal) Title() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.title
+}
+
+// AltScreen reports whether the alternate screen is active.
+func (t *Terminal) AltScreen() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.altActive
+}
+
+// Cursor returns the zero-based cursor position.
+func (t *Terminal) Cursor() (x, y int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cur.x, t.cur.y
+}
+
+// Lines returns the visible screen as text, one string per row with trailing blanks removed.
+func (t *Terminal) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]string, len(t.lines))
+	for i, l := range t.lines {
+		out[i] = lineText(l)
+	}
+	return out
+}
+
+// Scrollback returns the lines scrolled off the primary screen as text, oldest first.
+func (t *Terminal) Scrollback() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]string, len(t.scrollback))
+	for i, l := range t.scrollback {
+		out[i] = lineText(l)
+	}
+	return out
+}
+
+func lineText(l []Cell) string {
+	rs := make([]rune, 0, len(l))
+	for _, c := range l {
+		if c.Ch != 0 {
+			rs = append(rs, c.Ch)
+		}
+	}
+	end := len(rs)
+	for end > 0 && rs[end-1] == ' ' {
+		end--
+	}
+	return string(rs[:end])
+}
+
+// Resize changes the terminal size. Lines are truncated or padded, not reflowed. When the screen
+// shrinks, lines above the cursor move to scrollback so the cursor line stays visible.
+func (t *Terminal) Resize(cols, rows int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cols, rows = clampSize(cols), clampSize(rows)
+	if cols == t.cols && rows == t.rows {
+		return
+	}
+	t.primary = t.resizeLines(t.primary, cols, rows, !t.altActive, true)
+	if t.alt != nil {
+		t.alt = t.resizeLines(t.alt, cols, rows, t.altActive, false)
+	}
+	if t.altActive {
+		t.lines = t.alt
+	} else {
+		t.lines = t.primary
+	}
+	t.cols, t.rows = cols, rows
+	t.top, t.bottom = 0, rows-1
+	t.cur.x = min(t.cur.x, cols-1)
+	t.cur.y = min(t.cur.y, rows-1)
+	t.cur.pendingWrap = false
+	for _, c := range []*cursor{&t.savedPrimary, &t.savedAlt} {
+		c.x = min(c.x, cols-1)
+		c.y = min(c.y, rows-1)
+	}
+}
+
+func (t *Terminal) resizeLines(lines [][]Cell, cols, rows int, active, primary bool) [][]Cell {
+	if rows < len(lines) {
+		drop := 0
+		if active && t.cur.y >= rows {
+			drop = t.cur.y - rows + 1
+			t.cur.y -= drop
+		}
+		if primary {
+			for _, l := range lines[:drop] {
+				t.pushScrollback(l)
+			}
+		}
+		lines = lines[drop : drop+rows]
+	}
+	out := make([][]Cell, 0, rows)
+	for _, l := range lines {
+		if cols < len(l) {
+			l = l[:cols]
+			if l[cols-1].Ch == 0 {
+				l[cols-1] = blankCell
+			}
+		} else if cols > len(l) {
+			l = append(l, newLine(cols-len(l), Attr{})...)
+		}
+		out = append(out, l)
+	}
+	for len(out) < rows {
+		out = append(out, newLine(cols, Attr{}))
+	}
+	return out
+}
+
+func (t *Terminal) pushScrollback(l []Cell) {
+	if t.maxScrollback <= 0 {
+		return
+	}
+	t.scrollback = append(t.scrollback, l)
+	if over := len(t.scrollback) - t.maxScrollback; over > 0 {
+		t.scrollback = append([][]Cell(nil), t.scrollback[over:]...)
+	}
+}
+
+// print writes a printable rune at the cursor.
+func (t *Terminal) print(r rune) {
+	if t.cur.charset == '0' {
+		if m, ok := decSpecialGraphics[r]; ok {
+			r = m
+		}
+	}
+	w := runeWidth(r)
+	if w == 0 {
+		return
+	}
+	if t.cur.pendingWrap && t.autowrap {
+		t.cur.x = 0
+		t.index()
+	}
+	t.cur.pendingWrap = false
+	if w == 2 && t.cur.x == t.cols-1 {
+		if !t.autowrap || t.cols < 2 {
+			return
+		}
+		t.setCell(t.cur.x, t.cur.y, Cell{Ch: ' ', Attr: t.cur.attr})
+		t.cur.x = 0
+		t.index()
+	}
+	line := t.lines[t.cur.y]
+	if t.insert {
+		copy(line[t.cur.x+w:], line[t.cur.x:])
+	}
+	t.setCell(t.cur.x, t.cur.y, Cell{Ch: r, Attr: t.cur.attr})
+	if w == 2 {
+		t.setCell(t.cur.x+1, t.cur.y, Cell{Ch: 0, Attr: t.cur.attr})
+	}
+	t.lastPrinted = r
+	t.cur.x += w
+	if t.cur.x >= t.cols {
+		t.cur.x = t.cols - 1
+		t.cur.pendingWrap = t.autowrap
+	}
+}
+
+// setCell writes c and blanks the other half of any double-width character it overwrites.
+func (t *Terminal) setCell(x, y int, c Cell) {
+	line := t.lines[y]
+	if line[x].Ch == 0 && x > 0 && c.Ch != 0 {
+		line[x-1] = Cell{Ch: ' ', Attr: line[x-1].Attr}
+	}
+	if x+1 < len(line) && line[x+1].Ch == 0 && c.Ch != 0 && line[x].Ch != 0 && runeWidth(line[x].Ch) == 2 {
+		line[x+1] = Cell{Ch: ' ', Attr: line[x+1].Attr}
+	}
+	line[x] = c
+}
+
+func (t *Terminal) blank() Cell {
+	return Cell{Ch: ' ', Attr: Attr{BG: t.cur.attr.BG}}
+}
+
+// index moves the cursor down, scrolling the region when it is at the bottom margin.
+func (t *Terminal) index() {
+	if t.cur.y == t.bottom {
+		t.scrollUp(1)
+	} else if t.cur.y < t.rows-1 {
+		t.cur.y++
+	}
+}
+
+func (t *Terminal) reverseIndex() {
+	if t.cur.y == t.top {
+		t.scrollDown(1)
+	} else if t.cur.y > 0 {
+		t.cur.y--
+	}
+}
+
+func (t *Terminal) scrollUp(n int) {
+	n = min(n, t.bottom-t.top+1)
+	for i := 0; i < n; i++ {
+		if t.top == 0 && !t.altActive {
+			t.pushScrollback(t.lines[0])
+		}
+		copy(t.lines[t.top:t.bottom], t.lines[t.top+1:t.bottom+1])
+		t.lines[t.bottom] = newLine(t.cols, t.cur.attr)
+	}
+}
+
+func (t *Terminal) scrollDown(n int) {
+	n = min(n, t.bottom-t.top+1)
+	for i := 0; i < n; i++ {
+		copy(t.lines[t.top+1:t.bottom+1], t.lines[t.top:t.bottom])
+		t.lines[t.top] = newLine(t.cols, t.cur.attr)
+	}
+}
+
+func (t *Terminal) moveTo(x, y int) {
+	if t.cur.origin {
+		y += t.top
+		y = max(t.top, min(y, t.bottom))
+	}
+	t.cur.x = max(0, min(x, t.cols-1))
+	t.cur.y = max(0, min(y, t.rows-1))
+	t.cur.pendingWrap = false
+}
+
+func (t *Terminal) eraseCells(y, from, to int) {
+	line := t.lines[y]
+	for x := max(0, from); x < min(to, t.cols); x++ {
+		line[x] = t.blank()
+	}
+}
+
+func (t *Terminal) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.eraseCells(t.cur.y, t.cur.x, t.cols)
+		for y := t.cur.y + 1; y < t.rows; y++ {
+			t.eraseCells(y, 0, t.cols)
+		}
+	case 1:
+		t.eraseCells(t.cur.y, 0, t.cur.x+1)
+		for y := 0; y < t.cur.y; y++ {
+			t.eraseCells(y, 0, t.cols)
+		}
+	case 2:
+		for y := 0; y < t.rows; y++ {
+			t.eraseCells(y, 0, t.cols)
+		}
+	case 3:
+		t.scrollback = nil
+	}
+}
+
+func (t *Terminal) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		t.eraseCells(t.cur.y, t.cur.x, t.cols)
+	case 1:
+		t.eraseCells(t.cur.y, 0, t.cur.x+1)
+	case 2:
+		t.eraseCells(t.cur.y, 0, t.cols)
+	}
+}
+
+func (t *Terminal) insertLines(n int) {
+	if t.cur.y < t.top || t.cur.y > t.bottom {
+		return
+	}
+	top := t.top
+	t.top = t.cur.y
+	t.scrollDown(n)
+	t.top = top
+	t.cur.x = 0
+}
+
+func (t *Terminal) deleteLines(n int) {
+	if t.cur.y < t.top || t.cur.y > t.bottom {
+		return
+	}
+	top := t.top
+	t.top = t.cur.y
+	// Lines deleted inside the screen never go to scrollback.
+	alt := t.altActive
+	t.altActive = true
+	t.scrollUp(n)
+	t.altActive = alt
+	t.top = top
+	t.cur.x = 0
+}
+
+func (t *Terminal) insertChars(n int) {
+	line := t.lines[t.cur.y]
+	n = min(n, t.cols-t.cur.x)
+	copy(line[t.cur.x+n:], line[t.cur.x:])
+	t.eraseCells(t.cur.y, t.cur.x, t.cur.x+n)
+}
+
+func (t *Terminal) deleteChars(n int) {
+	line := t.lines[t.cur.y]
+	n = min(n, t.cols-t.cur.x)
+	copy(line[t.cur.x:], line[t.cur.x+n:])
+	t.eraseCells(t.cur.y, t.cols-n, t.cols)
+}
+
+func (t *Terminal) saveCursor() {
+	if t.altActive {
+		t.savedAlt = t.cur
+	} else {
+		t.savedPrimary = t.cur
+	}
+}
+
+func (t *Terminal) restoreCursor() {
+	if t.altActive {
+		t.cur = t.savedAlt
+	} else {
+		t.cur = t.savedPrimary
+	}
+	t.cur.x = min(t.cur.x, t.cols-1)
+	t.cur.y = min(t.cur.y, t.rows-1)
+}
+
+func (t *Terminal) enterAlt(saveCursor bool) {
+	if t.altActive {
+		return
+	}
+	if saveCursor {
+		t.savedPrimary = t.cur
+	}
+	t.alt = newLines(t.cols, t.rows)
+	t.lines = t.alt
+	t.altActive = true
+	t.top, t.bottom = 0, t.rows-1
+}
+
+func (t *Terminal) exitAlt(restoreCursor bool) {
+	if !t.altActive {
+		return
+	}
+	t.alt = nil
+	t.lines = t.primary
+	t.altActive = false
+	t.top, t.bottom = 0, t.rows-1
+	if restoreCursor {
+		t.restoreCursor()
+	}
+}
+
+func (t *Terminal) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 6:
+		t.cur.origin = on
+		t.moveTo(0, 0)
+	case 7:
+		t.autowrap = on
+	case 25:
+		t.cursorHidden = !on
+	case 47, 1047:
+		if on {
+			t.enterAlt(false)
+		} else {
+			t.exitAlt(false)
+		}
+	case 1048:
+		if on {
+			t.saveCursor()
+		} else {
+			t.restoreCursor()
+		}
+	case 1049:
+		if on {
+			t.enterAlt(true)
+		} else {
+			t.exitAlt(true)
+		}
+	default:
+		if passthroughModes[mode] {
+			if on {
+				t.modes[mode] = true
+			} else {
+				delete(t.modes, mode)
+			}
+		}
+	}
+}
+
+// decSpecialGraphics maps the DEC line drawing character set (ESC ( 0) to Unicode.
+var decSpecialGraphics = map[rune]rune{
+	'`': '◆', 'a': '▒', 'f': '°', 'g': '±', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└', 'n': '┼',
+	'o': '⎺', 'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤', 'v': '┴', 'w': '┬',
+	'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£', '~': '·',
+}
@@ -0,0 +1,172 @@
+package vt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func feed(t *Terminal, chunks ...string) {
+	for _, c := range chunks {
+		_, _ = t.Write([]byte(c))
+	}
+}
+
+func trimmed(lines []string) string {
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	return strings.Join(lines[:end], "|")
+}
+
+// assertSameState checks that replaying a's snapshot into a fresh terminal reproduces a.
+func assertSameState(t *testing.T, a *Terminal) *Terminal {
+	t.Helper()
+	cols, rows := a.Size()
+	b := New(cols, rows, 100)
+	_, _ = b.Write(a.Snapshot())
+	if !reflect.DeepEqual(a.primary, b.primary) {
+		t.Fatalf("primary differs:\n%q\n%q", a.Lines(), b.Lines())
+	}
+	if a.altActive != b.altActive || !reflect.DeepEqual(a.alt, b.alt) {
+		t.Fatalf("alt screen differs: %v %v", a.altActive, b.altActive)
+	}
+	if !reflect.DeepEqual(a.Scrollback(), b.Scrollback()) {
+		t.Fatalf("scrollback differs:\n%q\n%q", a.Scrollback(), b.Scrollback())
+	}
+	ax, ay := a.Cursor()
+	bx, by := b.Cursor()
+	if ax != bx || ay != by || a.cur.attr != b.cur.attr || a.cursorHidden != b.cursorHidden {
+		t.Fatalf("cursor differs: (%d,%d %+v) vs (%d,%d %+v)", ax, ay, a.cur.attr, bx, by, b.cur.attr)
+	}
+	if !reflect.DeepEqual(a.modes, b.modes) || a.top != b.top || a.bottom != b.bottom || a.title != b.title {
+		t.Fatalf("modes differ: %v/%d-%d/%q vs %v/%d-%d/%q", a.modes, a.top, a.bottom, a.title, b.modes, b.top, b.bottom, b.title)
+	}
+	return b
+}
+
+func TestTextWrapAndScrollback(t *testing.T) {
+	term := New(10, 3, 100)
+	feed(term, "line1\r\nline2\r\nline3\r\nabcdefghijKL")
+	if got := trimmed(term.Lines()); got != "line3|abcdefghij|KL" {
+		t.Fatalf("screen=%q", got)
+	}
+	if got := strings.Join(term.Scrollback(), "|"); got != "line1|line2" {
+		t.Fatalf("scrollback=%q", got)
+	}
+	if x, y := term.Cursor(); x != 2 || y != 2 {
+		t.Fatalf("cursor=(%d,%d)", x, y)
+	}
+	assertSameState(t, term)
+}
+
+func TestSplitSequencesAndUTF8(t *testing.T) {
+	term := New(20, 2, 0)
+	feed(term, "\x1b[3", "1mred\x1b", "[0m é", "\xe2", "\x82\xac")
+	if got := term.Lines()[0]; got != "red é€" {
+		t.Fatalf("line=%q", got)
+	}
+	if term.primary[0][0].Attr.FG != PaletteColor(1) || term.primary[0][3].Attr.FG != 0 {
+		t.Fatalf("attrs=%+v %+v", term.primary[0][0].Attr, term.primary[0][3].Attr)
+	}
+}
+
+func TestCursorMovementAndErase(t *testing.T) {
+	term := New(10, 4, 0)
+	feed(term, "aaaaaaaaaa\r\nbbbbbbbbbb\r\ncccccccccc")
+	feed(term, "\x1b[2;3H\x1b[K", "\x1b[1;5H\x1b[1K", "\x1b[4;1HX\x1b[2D\x1b[AY")
+	if got := trimmed(term.Lines()); got != "     aaaaa|bb|Yccccccccc|X" {
+		t.Fatalf("screen=%q", got)
+	}
+	feed(term, "\x1b[2J")
+	if got := trimmed(term.Lines()); got != "" {
+		t.Fatalf("after ED2=%q", got)
+	}
+}
+
+func TestAlternateScreen(t *testing.T) {
+	term := New(20, 4, 100)
+	feed(term, "$ vim file\r\n")
+	feed(term, "\x1b[?1049h\x1b[?1h\x1b[?1000h\x1b[H\x1b[2J\x1b[1;44mtitle bar\x1b[0m\x1b[3;5Hbody\x1b]2;vim - file\x07")
+	if !term.AltScreen() || trimmed(term.Lines()) != "title bar||    body" {
+		t.Fatalf("alt=%v screen=%q", term.AltScreen(), term.Lines())
+	}
+	b := assertSameState(t, term)
+	if b.Title() != "vim - file" {
+		t.Fatalf("title=%q", b.Title())
+	}
+
+	feed(term, "\x1b[?1000l\x1b[?1049l")
+	if term.AltScreen() || trimmed(term.Lines()) != "$ vim file" {
+		t.Fatalf("after exit: alt=%v screen=%q", term.AltScreen(), term.Lines())
+	}
+	if x, y := term.Cursor(); x != 0 || y != 1 {
+		t.Fatalf("cursor after exit=(%d,%d)", x, y)
+	}
+}
+
+func TestScrollRegionAndLineOps(t *testing.T) {
+	term := New(10, 5, 100)
+	feed(term, "header\r\n1\r\n2\r\n3\r\nfooter")
+	feed(term, "\x1b[2;4r\x1b[4;1H\n4")
+	if got := trimmed(term.Lines()); got != "header|2|3|4|footer" {
+		t.Fatalf("screen=%q", got)
+	}
+	if len(term.Scrollback()) != 0 {
+		t.Fatalf("region scroll must not touch scrollback: %q", term.Scrollback())
+	}
+	feed(term, "\x1b[2;1H\x1b[L")
+	if got := trimmed(term.Lines()); got != "header||2|3|footer" {
+		t.Fatalf("after IL=%q", got)
+	}
+	feed(term, "\x1b[M\x1b[M")
+	if got := trimmed(term.Lines()); got != "header|3|||footer" {
+		t.Fatalf("after DL=%q", got)
+	}
+	assertSameState(t, term)
+}
+
+func TestWideCharactersAndColors(t *testing.T) {
+	term := New(6, 2, 0)
+	feed(term, "\x1b[38;5;208m漢字\x1b[48;2;1;2;3mab\x1b[0mc")
+	if got := trimmed(term.Lines()); got != "漢字ab|c" {
+		t.Fatalf("screen=%q", got)
+	}
+	if term.primary[0][0].Attr.FG != PaletteColor(208) || term.primary[0][4].Attr.BG != RGBColor(1, 2, 3) {
+		t.Fatalf("attrs=%+v %+v", term.primary[0][0].Attr, term.primary[0][4].Attr)
+	}
+	feed(term, "\x1b[1;2Hx")
+	if got := term.Lines()[0]; got != " x字ab" {
+		t.Fatalf("overwrite half of wide char=%q", got)
+	}
+	assertSameState(t, term)
+}
+
+func TestResizeKeepsCursorLine(t *testing.T) {
+	term := New(10, 4, 100)
+	feed(term, "a\r\nb\r\nc\r\nd")
+	term.Resize(5, 2)
+	if got := trimmed(term.Lines()); got != "c|d" {
+		t.Fatalf("screen=%q", got)
+	}
+	if got := strings.Join(term.Scrollback(), "|"); got != "a|b" {
+		t.Fatalf("scrollback=%q", got)
+	}
+	if x, y := term.Cursor(); x != 1 || y != 1 {
+		t.Fatalf("cursor=(%d,%d)", x, y)
+	}
+	term.Resize(8, 3)
+	feed(term, "\r\nnew")
+	if got := trimmed(term.Lines()); got != "c|d|new" {
+		t.Fatalf("after grow=%q", got)
+	}
+}
+
+func TestLineDrawingCharset(t *testing.T) {
+	term := New(10, 1, 0)
+	feed(term, "\x1b(0lqqk\x1b(Bq")
+	if got := term.Lines()[0]; got != "┌──┐q" {
+		t.Fatalf("line=%q", got)
+	}
+}
@@ -59,6 +59,8 @@ export default function Terminal({ sessionId, session, onStatusChange }: Termina
   const [toolOutputs, setToolOutputs] = useState<Array<{ ts: number; seq: number; payload: any }>>([])
   const [inputText, setInputText] = useState('')
   const [rawMode, setRawMode] = useState(false)
+  // Input lock among attached clients: our client id and the current controller's.
+  const [control, setControl] = useState<{ you: string; controller: string }>({ you: '', controller: '' })
   const rawDisposeRef = useRef<{ dispose: () => void } | null>(null)
 
   useEffect(() => {
@@ -86,6 +88,14 @@ export default function Terminal({ sessionId, session, onStatusChange }: Termina
     ws.send(JSON.stringify({ type: 'input', data: text }))
   }, [])
 
+  const takeControl = useCallback(() => {
+    const ws = wsRef.current
+    if (!ws || ws.readyState !== WebSocket.OPEN) return
+    ws.send(JSON.stringify({ type: 'control', action: 'take' }))
+  }, [])
+
+  const isViewer = control.you !== '' && control.controller !== '' && control.controller !== control.you
+
   const sendLine = useCallback(() => {
     const ws = wsRef.current
     if (!ws || ws.readyState !== WebSocket.OPEN) return
@@ -141,6 +151,17 @@ export default function Terminal({ sessionId, session, onStatusChange }: Termina
           }
 
           switch (msg.kind) {
+            case 'screen': {
+              // Rendered terminal state sent on attach; the replay that follows omits the output it covers.
+              const payload = msg.payload || {}
+              const data = safeText(payload.data)
+              const term = xtermRef.current
+              if (term && data) {
+                term.reset()
+                term.write(data)
+              }
+              return
+            }
             case 'assistant': {
               const payload = msg.payload || {}
               const txt = safeText(payload.data)
@@ -183,6 +204,12 @@ export default function Terminal({ sessionId, session, onStatusChange }: Termina
             case 'status': {
               const payload = msg.payload || {}
               const state = safeText(payload.state)
+              if (state === 'control') {
+                const you = safeText(payload.you)
+                const controller = safeText(payload.controller)
+                setControl((prev) => ({ you: you || prev.you, controller }))
+                return
+              }
               const code = typeof payload.exit_code === 'number' ? payload.exit_code : undefined
               if (state) writeLine(`\r\n[status ${formatTS(msg.ts_ms)}] ${state}${code != null ? ` (exit ${code})` : ''}\r\n`)
               if (state === 'exited') {
@@ -308,6 +335,11 @@ export default function Terminal({ sessionId, session, onStatusChange }: Termina
               <button type="button" onClick={() => sendInput('\u0003')} disabled={status !== 'connected'}>
                 Ctrl+C
               </button>
+              {isViewer && (
+                <button type="button" onClick={takeControl} disabled={status !== 'connected'} title="Another client is typing in this session.">
+                  Take control
+                </button>
+              )}
               <button
                 type="button"
                 className={rawMode ? 'small-btn' : undefined}
@@ -324,6 +356,7 @@ export default function Terminal({ sessionId, session, onStatusChange }: Termina
             <span className={`status-banner ${statusColor}`}>{status}</span>
             <span className="status-meta">
               {session?.engine || 'unknown'} · {session?.state || 'unknown'} · seq {lastSeq}
+              {isViewer ? ' · viewing' : ''}
             </span>
           </div>
         </div>